@@ -0,0 +1,252 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package config parses network device configurations into a tree of
+// statements. It understands indentation-based configurations, such as those
+// produced by Cisco IOS, and brace-based configurations, such as those
+// produced by Junos. The resulting tree can be searched, split into sections,
+// and serialized back into either format or converted to and from Junos set
+// commands.
+package config
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// Node is a single configuration statement and the statements nested
+// beneath it. The root of a parsed configuration has no text.
+type Node struct {
+	Text     string
+	Children []*Node
+	Parent   *Node
+}
+
+// Add appends a child statement to n and returns it.
+func (n *Node) Add(text string) *Node {
+	child := &Node{Text: text, Parent: n}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// Child returns the first direct child of n whose text is exactly text, or
+// nil if there is none.
+func (n *Node) Child(text string) *Node {
+	for _, child := range n.Children {
+		if child.Text == text {
+			return child
+		}
+	}
+	return nil
+}
+
+// Section follows path from n, one child per element, and returns the node at
+// the end of it, or nil if any element is missing.
+func (n *Node) Section(path ...string) *Node {
+	node := n
+	for _, text := range path {
+		if node = node.Child(text); node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// Find returns every node beneath n whose text matches re, in document order.
+func (n *Node) Find(re *regexp.Regexp) []*Node {
+	var found []*Node
+	n.Walk(func(node *Node) {
+		if node != n && re.MatchString(node.Text) {
+			found = append(found, node)
+		}
+	})
+	return found
+}
+
+// Walk calls fn for n and each of its descendants in document order.
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+// Path returns the text of each node from the root down to n.
+func (n *Node) Path() []string {
+	var path []string
+	for node := n; node.Parent != nil; node = node.Parent {
+		path = append([]string{node.Text}, path...)
+	}
+	return path
+}
+
+// Indented serializes the statements beneath n in indentation-based format,
+// indenting nested statements by one space per level.
+func (n *Node) Indented() string {
+	var b strings.Builder
+	for _, child := range n.Children {
+		child.writeIndented(&b, 0)
+	}
+	return b.String()
+}
+
+func (n *Node) writeIndented(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat(" ", depth))
+	b.WriteString(n.Text)
+	b.WriteByte('\n')
+	for _, child := range n.Children {
+		child.writeIndented(b, depth+1)
+	}
+}
+
+// Braced serializes the statements beneath n in brace-based format, indenting
+// nested statements by four spaces per level.
+func (n *Node) Braced() string {
+	var b strings.Builder
+	for _, child := range n.Children {
+		child.writeBraced(&b, 0)
+	}
+	return b.String()
+}
+
+func (n *Node) writeBraced(b *strings.Builder, depth int) {
+	indent := strings.Repeat("    ", depth)
+	if len(n.Children) == 0 {
+		b.WriteString(indent + n.Text + ";\n")
+		return
+	}
+	b.WriteString(indent + n.Text + " {\n")
+	for _, child := range n.Children {
+		child.writeBraced(b, depth+1)
+	}
+	b.WriteString(indent + "}\n")
+}
+
+// Format is the syntax of a configuration.
+type Format int
+
+const (
+	Indented Format = iota // indentation-based, as shown by IOS
+	Braced                 // brace-based, as shown by Junos
+	Set                    // Junos set commands
+)
+
+// Parse parses config in format.
+func Parse(config string, format Format) (*Node, error) {
+	switch format {
+	case Indented:
+		return ParseIndented(config)
+	case Braced:
+		return ParseBraced(config)
+	case Set:
+		return ParseSet(config)
+	}
+	return nil, errors.Errorf("unknown configuration format %d", format)
+}
+
+// Commands returns the configuration commands that create the statements
+// beneath n: its indented lines for Indented, and its set commands for Braced
+// and Set, since brace-based configurations cannot be typed as they are
+// shown.
+func (n *Node) Commands(format Format) []string {
+	if format != Indented {
+		return n.SetCommands()
+	}
+	text := n.Indented()
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// banner matches the first line of an IOS banner, capturing the delimiter.
+var banner = regexp.MustCompile(`^banner\s+\S+\s+(\^C|\S)`)
+
+// ParseIndented parses an indentation-based configuration. A statement that is
+// indented further than the statement before it is nested beneath it. Blank
+// lines and "!" comment lines are skipped, and multi-line banners are kept
+// together as a single statement.
+func ParseIndented(config string) (*Node, error) {
+	root := &Node{}
+	type level struct {
+		indent int
+		node   *Node
+	}
+	stack := []level{{-1, root}}
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		text := strings.TrimLeft(line, " \t")
+		if text == "" || strings.HasPrefix(text, "!") {
+			continue
+		}
+		indent := len(line) - len(text)
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		if m := banner.FindStringSubmatch(text); m != nil {
+			body := text[len(m[0]):]
+			for !strings.Contains(body, m[1]) && scanner.Scan() {
+				body = scanner.Text()
+				text += "\n" + strings.TrimRight(body, "\r")
+			}
+		}
+		node := stack[len(stack)-1].node.Add(text)
+		stack = append(stack, level{indent, node})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read configuration")
+	}
+	return root, nil
+}
+
+// ParseBraced parses a brace-based configuration. Statements ending in "{"
+// open a block that is closed by "}", and statements ending in ";" are leaves.
+// Blank lines and "#" and "/* */" comment lines are skipped.
+func ParseBraced(config string) (*Node, error) {
+	root := &Node{}
+	node := root
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "", strings.HasPrefix(text, "#"), strings.HasPrefix(text, "/*"):
+			// Skip blank lines and comments.
+		case strings.HasSuffix(text, "{"):
+			node = node.Add(strings.TrimSpace(strings.TrimSuffix(text, "{")))
+		case text == "}":
+			if node == root {
+				return nil, errors.Errorf("line %d: unexpected closing brace", lineno)
+			}
+			node = node.Parent
+		default:
+			node.Add(strings.TrimSuffix(text, ";"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read configuration")
+	}
+	if node != root {
+		return nil, errors.Errorf("unclosed block %q", node.Text)
+	}
+	return root, nil
+}
@@ -0,0 +1,316 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package config_test contains tests, benchmarks, and examples for package
+// config.
+package config_test
+
+import (
+	"fmt"
+	"github.com/mwalto7/device/config"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func ExampleParseIndented() {
+	tree, err := config.ParseIndented(`hostname sw1
+!
+interface GigabitEthernet0/1
+ description uplink
+ switchport mode trunk
+!
+interface GigabitEthernet0/2
+ shutdown
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	intf := tree.Section("interface GigabitEthernet0/1")
+	fmt.Print(intf.Children[0].Text)
+	// Output: description uplink
+}
+
+func ExampleParseBraced() {
+	tree, err := config.ParseBraced(`system {
+    host-name r1;
+    services {
+        ssh;
+    }
+}
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(tree.Indented())
+	// Output:
+	// system
+	//  host-name r1
+	//  services
+	//   ssh
+}
+
+func ExampleNode_Find() {
+	tree, err := config.ParseIndented(`interface Vlan1
+ shutdown
+interface Vlan10
+ ip address 10.0.10.1 255.255.255.0
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, node := range tree.Find(regexp.MustCompile(`^ip address`)) {
+		fmt.Println(node.Path())
+	}
+	// Output: [interface Vlan10 ip address 10.0.10.1 255.255.255.0]
+}
+
+func ExampleNode_Braced() {
+	tree, err := config.ParseIndented(`interfaces
+ ge-0/0/0
+  unit 0
+   family inet
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(tree.Braced())
+	// Output:
+	// interfaces {
+	//     ge-0/0/0 {
+	//         unit 0 {
+	//             family inet;
+	//         }
+	//     }
+	// }
+}
+
+func ExampleParseIndented_banner() {
+	tree, err := config.ParseIndented(`banner motd ^C
+  Authorized access only
+^C
+hostname sw1
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(tree.Children))
+	fmt.Println(tree.Children[1].Text)
+	// Output:
+	// 2
+	// hostname sw1
+}
+
+func ExampleNode_SetCommands() {
+	tree, err := config.ParseBraced(`interfaces {
+    ge-0/0/0 {
+        description "to core";
+        unit 0 {
+            family inet {
+                address 10.0.0.1/24;
+            }
+        }
+    }
+}
+vlans {
+    inactive: v10 {
+        vlan-id 10;
+    }
+}
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, cmd := range tree.SetCommands() {
+		fmt.Println(cmd)
+	}
+	// Output:
+	// set interfaces ge-0/0/0 description "to core"
+	// set interfaces ge-0/0/0 unit 0 family inet address 10.0.0.1/24
+	// set vlans v10 vlan-id 10
+	// deactivate vlans v10
+}
+
+func ExampleParseSet() {
+	tree, err := config.ParseSet(`set system host-name r1
+set system services ssh
+set interfaces ge-0/0/0 unit 0 family inet address 10.0.0.1/24
+set interfaces ge-0/0/0 unit 0 description "mgmt"
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(tree.Braced())
+	// Output:
+	// system {
+	//     host-name r1;
+	//     services {
+	//         ssh;
+	//     }
+	// }
+	// interfaces {
+	//     ge-0/0/0 {
+	//         unit 0 {
+	//             family inet {
+	//                 address 10.0.0.1/24;
+	//             }
+	//             description "mgmt";
+	//         }
+	//     }
+	// }
+}
+
+func ExampleSanitize() {
+	fmt.Print(config.Sanitize(`hostname sw1
+enable secret 5 $1$abcd$efgh
+username admin privilege 15 secret 9 $9$xyz
+snmp-server community public RO
+tacacs-server host 10.0.0.5 key 7 0822455D0A16
+line vty 0 4
+ password 7 094F471A1A0A
+`))
+	// Output:
+	// hostname sw1
+	// enable secret 5 <removed>
+	// username admin privilege 15 secret 9 <removed>
+	// snmp-server community <removed> RO
+	// tacacs-server host 10.0.0.5 key 7 <removed>
+	// line vty 0 4
+	//  password 7 <removed>
+}
+
+func ExampleSanitize_junos() {
+	fmt.Print(config.Sanitize(`system {
+    root-authentication {
+        encrypted-password "$6$abc";
+    }
+}
+snmp {
+    community public {
+        authorization read-only;
+    }
+}
+`, config.JunosRules...))
+	// Output:
+	// system {
+	//     root-authentication {
+	//         encrypted-password <removed>;
+	//     }
+	// }
+	// snmp {
+	//     community <removed> {
+	//         authorization read-only;
+	//     }
+	// }
+}
+
+func ExampleMissing() {
+	running, err := config.ParseIndented(`hostname sw1
+interface GigabitEthernet0/1
+ description uplink
+ shutdown
+interface GigabitEthernet0/2
+ description users
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	intended, err := config.ParseIndented(`hostname sw1
+interface GigabitEthernet0/1
+ description uplink
+ no shutdown
+interface GigabitEthernet0/2
+ description users
+ shutdown
+ntp server 10.0.0.1
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, cmd := range config.Missing(running, intended).Commands(config.Indented) {
+		fmt.Println(cmd)
+	}
+	// Output:
+	// interface GigabitEthernet0/1
+	//  no shutdown
+	// interface GigabitEthernet0/2
+	//  shutdown
+	// ntp server 10.0.0.1
+}
+
+func ExampleMissing_set() {
+	running, err := config.ParseSet(`set system host-name r1
+set system ntp server 10.0.0.1
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	intended, err := config.ParseSet(`set system ntp server 10.0.0.1
+set system ntp server 10.0.0.2
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(config.Missing(running, intended).Commands(config.Set))
+	// Output: [set system ntp server 10.0.0.2]
+}
+
+func TestMissing(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        config.Format
+		running, want string
+		missing       []string
+	}{
+		{"present", config.Indented, "hostname sw1\ninterface Vlan1\n shutdown\n", "interface Vlan1\n shutdown\n", nil},
+		{"empty", config.Indented, "hostname sw1\n", "", nil},
+		{"new section", config.Indented, "hostname sw1\n", "router ospf 1\n network 10.0.0.0 0.0.0.255 area 0\n",
+			[]string{"router ospf 1", " network 10.0.0.0 0.0.0.255 area 0"}},
+		{"other section", config.Indented, "interface Vlan1\n shutdown\ninterface Vlan10\n", "interface Vlan10\n shutdown\n",
+			[]string{"interface Vlan10", " shutdown"}},
+		{"nested", config.Indented, "router bgp 65000\n address-family ipv4\n  neighbor 10.0.0.1 activate\n",
+			"router bgp 65000\n address-family ipv4\n  neighbor 10.0.0.1 activate\n  neighbor 10.0.0.2 activate\n",
+			[]string{"router bgp 65000", " address-family ipv4", "  neighbor 10.0.0.2 activate"}},
+		{"negation satisfied", config.Indented, "interface Vlan1\n description users\n", "interface Vlan1\n no shutdown\n", nil},
+		{"negation shown", config.Indented, "no ip http server\n", "no ip http server\n", nil},
+		{"negation needed", config.Indented, "ip http server\n", "no ip http server\n", []string{"no ip http server"}},
+		{"banner", config.Indented, "banner motd ^C\nWelcome\n^C\n", "banner motd ^C\nAuthorized use only\n^C\n",
+			[]string{"banner motd ^C", "Authorized use only", "^C"}},
+		{"set present", config.Set, "set system host-name r1\n", "set system host-name r1\n", nil},
+		{"set changed", config.Set, "set system host-name r1\n", "set system host-name r2\n", []string{"set system host-name r2"}},
+		{"braced", config.Braced, "system {\n    host-name r1;\n}\n", "system {\n    host-name r1;\n    time-zone UTC;\n}\n",
+			[]string{"set system time-zone UTC"}},
+	}
+	for _, tt := range tests {
+		running, err := config.Parse(tt.running, tt.format)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want, err := config.Parse(tt.want, tt.format)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := config.Missing(running, want).Commands(tt.format)
+		if strings.Join(got, "\n") != strings.Join(tt.missing, "\n") {
+			t.Errorf("%s: Missing = %q, want %q", tt.name, got, tt.missing)
+		}
+	}
+}
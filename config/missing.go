@@ -0,0 +1,69 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import "strings"
+
+// Missing returns the statements of want that have lacks, each beneath copies
+// of the sections that lead to it, so that the result's Commands enter the
+// right section before adding a statement. Statements are compared section by
+// section: "shutdown" beneath one interface does not stand in for "shutdown"
+// beneath another. Statements of have that want does not mention are ignored.
+//
+// A negated statement, such as "no shutdown", is present unless have holds the
+// statement it negates, since devices usually do not show negations.
+//
+// The root of the result has no children if nothing is missing.
+func Missing(have, want *Node) *Node {
+	root := &Node{}
+	missing(root, have, want)
+	return root
+}
+
+// missing adds to dst the children of want that have lacks.
+func missing(dst, have, want *Node) {
+	for _, child := range want.Children {
+		if negated := strings.TrimPrefix(child.Text, "no "); negated != child.Text && len(child.Children) == 0 {
+			if have.Child(child.Text) == nil && have.Child(negated) != nil {
+				dst.Add(child.Text)
+			}
+			continue
+		}
+		existing := have.Child(child.Text)
+		if existing == nil {
+			dst.adopt(child)
+			continue
+		}
+		section := &Node{Text: child.Text, Parent: dst}
+		missing(section, existing, child)
+		if len(section.Children) > 0 {
+			dst.Children = append(dst.Children, section)
+		}
+	}
+}
+
+// adopt appends a copy of node and its descendants to n.
+func (n *Node) adopt(node *Node) {
+	child := n.Add(node.Text)
+	for _, grandchild := range node.Children {
+		child.adopt(grandchild)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import "regexp"
+
+// Mask replaces secrets removed by Sanitize.
+const Mask = "<removed>"
+
+// Rule describes a secret to remove from a configuration. Pattern must capture
+// the text preceding the secret in its first group and may capture text that
+// follows it in a second group; everything else matched by Pattern is replaced
+// with Mask.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// IOSRules match secrets in Cisco IOS and IOS-like configurations.
+var IOSRules = []Rule{
+	{"enable", regexp.MustCompile(`(?m)^(\s*enable (?:secret|password)(?: \d+)?) \S+`)},
+	{"username", regexp.MustCompile(`(?m)^(\s*username \S+.*? (?:secret|password)(?: \d+)?) \S+`)},
+	{"line password", regexp.MustCompile(`(?m)^(\s*password(?: \d+)?) \S+`)},
+	{"snmp community", regexp.MustCompile(`(?m)^(\s*snmp-server community) \S+`)},
+	{"aaa server key", regexp.MustCompile(`(?m)^(\s*(?:tacacs-server|radius-server)(?: host \S+)?.*? key(?: \d+)?) \S+`)},
+	{"server key", regexp.MustCompile(`(?m)^(\s*key(?: \d+)?) \S+`)},
+	{"isakmp key", regexp.MustCompile(`(?m)^(\s*crypto isakmp key) \S+`)},
+	{"pre-shared key", regexp.MustCompile(`(?m)^(\s*pre-shared-key(?: local| remote)?(?: \d+)?) \S+`)},
+	{"ntp key", regexp.MustCompile(`(?m)^(\s*ntp authentication-key \d+ \S+) \S+`)},
+}
+
+// JunosRules match secrets in Junos configurations, in either brace-based or
+// set format. Junos always quotes these secrets, which keeps the rules from
+// matching IOS statements that share keywords.
+var JunosRules = []Rule{
+	{"password", regexp.MustCompile(`\b(encrypted-password|simple-password|secret) "[^"]*"`)},
+	{"authentication key", regexp.MustCompile(`\b(authentication-key) "[^"]*"`)},
+	{"pre-shared key", regexp.MustCompile(`\b(pre-shared-key (?:ascii-text|hexadecimal)) "[^"]*"`)},
+	{"snmp community", regexp.MustCompile(`(?m)^(\s*community) (?:"[^"]*"|[^\s;{]+)( \{)`)},
+	{"snmp community", regexp.MustCompile(`(?m)^(set snmp community) \S+`)},
+}
+
+// DefaultRules are the rules Sanitize applies when none are given.
+var DefaultRules = append(append([]Rule{}, IOSRules...), JunosRules...)
+
+// Sanitize masks the secrets in config matched by rules, or by DefaultRules if
+// no rules are given. Sanitized configurations are safe to store and share but
+// can no longer be applied to a device.
+func Sanitize(config string, rules ...Rule) string {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	for _, rule := range rules {
+		config = rule.Pattern.ReplaceAllString(config, "${1} "+Mask+"${2}")
+	}
+	return config
+}
@@ -0,0 +1,172 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// inactive prefixes Junos statements that are present but deactivated.
+const inactive = "inactive: "
+
+// SetCommands converts the statements beneath n into Junos set commands, one
+// per leaf statement. Deactivated statements are followed by the matching
+// deactivate command.
+func (n *Node) SetCommands() []string {
+	var cmds, deactivates []string
+	var walk func(node *Node, path []string)
+	walk = func(node *Node, path []string) {
+		text := strings.TrimPrefix(node.Text, inactive)
+		path = append(path[:len(path):len(path)], text)
+		if text != node.Text {
+			deactivates = append(deactivates, "deactivate "+strings.Join(path, " "))
+		}
+		if len(node.Children) == 0 {
+			for _, leaf := range expandList(path) {
+				cmds = append(cmds, "set "+leaf)
+			}
+			return
+		}
+		for _, child := range node.Children {
+			walk(child, path)
+		}
+	}
+	for _, child := range n.Children {
+		walk(child, nil)
+	}
+	return append(cmds, deactivates...)
+}
+
+// expandList expands a trailing Junos list, such as "members [ v10 v20 ]",
+// into one statement per element.
+func expandList(path []string) []string {
+	stmt := strings.Join(path, " ")
+	open := strings.Index(stmt, "[")
+	if open < 0 || !strings.HasSuffix(stmt, "]") {
+		return []string{stmt}
+	}
+	prefix := strings.TrimSpace(stmt[:open])
+	var stmts []string
+	for _, elem := range strings.Fields(stmt[open+1 : len(stmt)-1]) {
+		stmts = append(stmts, prefix+" "+elem)
+	}
+	return stmts
+}
+
+// keywords lists common Junos statements that take a single argument. ParseSet
+// keeps a keyword and its argument together as one statement, as Junos does in
+// its brace-based output.
+var keywords = map[string]bool{
+	"address": true, "area": true, "authentication-key": true, "community": true,
+	"description": true, "domain-name": true, "family": true, "filter": true,
+	"group": true, "host-name": true, "interface": true, "local-as": true,
+	"mtu": true, "neighbor": true, "next-hop": true, "peer-as": true,
+	"policy-statement": true, "prefix-list": true, "route": true,
+	"router-id": true, "term": true, "time-zone": true, "type": true,
+	"unit": true, "vlan-id": true,
+}
+
+// ParseSet parses Junos set commands into a tree that can be serialized in
+// brace-based format. Because set commands do not mark where one statement
+// ends and the next begins, each word is treated as its own level, except that
+// a known keyword is kept together with its argument. Blank lines and "#"
+// comments are skipped, and deactivate commands mark the named statement
+// inactive.
+func ParseSet(commands string) (*Node, error) {
+	root := &Node{}
+	scanner := bufio.NewScanner(strings.NewReader(commands))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := splitWords(line)
+		if len(words) < 2 {
+			return nil, errors.Errorf("line %d: incomplete command %q", lineno, line)
+		}
+		switch words[0] {
+		case "set":
+			insert(root, words[1:])
+		case "deactivate":
+			node := insert(root, words[1:])
+			if !strings.HasPrefix(node.Text, inactive) {
+				node.Text = inactive + node.Text
+			}
+		default:
+			return nil, errors.Errorf("line %d: unsupported command %q", lineno, words[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read set commands")
+	}
+	return root, nil
+}
+
+// insert adds the statement described by words beneath n, reusing statements
+// that already exist, and returns the last node on its path.
+func insert(n *Node, words []string) *Node {
+	for len(words) > 0 {
+		text := words[0]
+		used := 1
+		if keywords[words[0]] && len(words) > 1 {
+			text = words[0] + " " + words[1]
+			used = 2
+		}
+		words = words[used:]
+		child := n.Child(text)
+		if child == nil {
+			child = n.Child(inactive + text)
+		}
+		if child == nil {
+			child = n.Add(text)
+		}
+		n = child
+	}
+	return n
+}
+
+// splitWords splits a command into words, keeping double-quoted strings
+// together with their quotes.
+func splitWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			word.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t'):
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
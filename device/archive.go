@@ -0,0 +1,181 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ResultArchive stores the results of runs on disk, one directory per device
+// and run, in the layout most batch jobs build by hand:
+//
+//	<dir>/<host>/<timestamp>/<command>.txt
+//
+// The host is the device's Metadata.Name, or its address if it has none, and
+// the timestamp is when the session was opened, in UTC. Each run's directory
+// also holds manifest.json, its ResultManifest. It is safe for concurrent use.
+type ResultArchive struct {
+	dir string
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewResultArchive returns a ResultArchive that writes under dir, such as
+// "output".
+func NewResultArchive(dir string) *ResultArchive {
+	return &ResultArchive{dir: dir}
+}
+
+// ResultManifest describes the directory a ResultArchive wrote for one run.
+// It is stored there as manifest.json.
+type ResultManifest struct {
+	Device   string          `json:"device"`
+	Metadata Metadata        `json:"metadata"`
+	Start    time.Time       `json:"start"`
+	Duration string          `json:"duration"`
+	Files    []CollectedFile `json:"files"` // named relative to the run's directory
+}
+
+// Write stores result, returning the directory it was written to. Each
+// command's output is stored in a file named after the command; if the
+// output could not be told apart by command, or was spooled, it is stored
+// whole in output.txt.
+func (a *ResultArchive) Write(result *Result) (dir string, err error) {
+	defer func() {
+		if err != nil {
+			a.mu.Lock()
+			a.err = err
+			a.mu.Unlock()
+		}
+	}()
+	manifest := &ResultManifest{
+		Device:   result.Metadata.Name,
+		Metadata: result.Metadata,
+		Start:    result.Start,
+		Duration: result.Duration.String(),
+	}
+	if manifest.Device == "" && result.RemoteAddr != nil {
+		manifest.Device = result.RemoteAddr.String()
+	}
+	if dir, err = a.mkdir(manifest); err != nil {
+		return "", err
+	}
+
+	if result.Spool != "" || len(result.Commands) == 0 || result.Commands[0].Output == nil {
+		r, err := result.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		file := CollectedFile{Name: "output.txt", Duration: manifest.Duration}
+		if err := writeResultFile(dir, &file, r); err != nil {
+			return "", err
+		}
+		manifest.Files = append(manifest.Files, file)
+	} else {
+		used := make(map[string]int)
+		for _, cmd := range result.Commands {
+			name := fileName(cmd.Command)
+			if used[name]++; used[name] > 1 {
+				name = fmt.Sprintf("%s-%d", name, used[name])
+			}
+			file := CollectedFile{Command: cmd.Command, Name: name + ".txt", Duration: cmd.Duration.String()}
+			if err := writeResultFile(dir, &file, bytes.NewReader(cmd.Output)); err != nil {
+				return "", err
+			}
+			manifest.Files = append(manifest.Files, file)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode manifest")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644); err != nil {
+		return "", errors.Wrap(err, "failed to write manifest")
+	}
+	return dir, nil
+}
+
+// Err returns the most recent error encountered while writing results. Like
+// audit failures, they never cause Run to fail.
+func (a *ResultArchive) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// mkdir creates the directory of the run described by manifest. Runs on the
+// same device that start within the same millisecond get numbered suffixes.
+func (a *ResultArchive) mkdir(manifest *ResultManifest) (string, error) {
+	host := filepath.Join(a.dir, fileName(manifest.Device))
+	if err := os.MkdirAll(host, 0755); err != nil {
+		return "", errors.Wrap(err, "failed to create results directory")
+	}
+	base := filepath.Join(host, manifest.Start.UTC().Format("20060102T150405.000Z"))
+	dir := base
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", errors.Wrap(err, "failed to create results directory")
+		}
+		dir = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// writeResultFile writes what r holds to the file named by file in dir,
+// recording its size.
+func writeResultFile(dir string, file *CollectedFile, r io.Reader) error {
+	f, err := os.Create(filepath.Join(dir, file.Name))
+	if err != nil {
+		return errors.Wrap(err, "failed to write result")
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write result")
+	}
+	file.Bytes = n
+	return nil
+}
+
+// archive stores the result of a successful call to Run in the device's
+// ResultArchive, if it has one.
+func (d *Device) archive(result *Result, err error) {
+	if d.Archive != nil && err == nil {
+		d.Archive.Write(result)
+	}
+}
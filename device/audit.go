@@ -0,0 +1,124 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultAuditLog, if set, records the commands run on every device that does
+// not set its own AuditLog.
+var DefaultAuditLog *AuditLog
+
+// AuditLog writes an append-only record of the commands run on devices, one
+// JSON object per line. It is safe for concurrent use.
+type AuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewAuditLog returns an AuditLog that writes to w. To make the log
+// append-only on disk, open the file with os.O_APPEND.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{enc: json.NewEncoder(w)}
+}
+
+// AuditEntry is a single line of an AuditLog.
+type AuditEntry struct {
+	Time     time.Time `json:"timestamp"`
+	Operator string    `json:"operator"`
+	Device   string    `json:"device"`
+	Command  string    `json:"command"`
+	Result   string    `json:"result"` // "ok", or the error that stopped the run
+	Bytes    int       `json:"bytes"`  // length of the command's output, if known
+	Duration string    `json:"duration"`
+}
+
+// Write appends entry to the log.
+func (l *AuditLog) Write(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(entry); err != nil {
+		l.err = errors.Wrap(err, "failed to write audit log")
+		return l.err
+	}
+	return nil
+}
+
+// Err returns the most recent error encountered while writing the log. Audit
+// failures never cause Run to fail.
+func (l *AuditLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// audit records the outcome of a call to Run in the device's audit log.
+func (d *Device) audit(cmds []string, result *Result, err error) {
+	log := d.AuditLog
+	if log == nil {
+		log = DefaultAuditLog
+	}
+	if log == nil {
+		return
+	}
+	now := time.Now()
+	for i, cmd := range cmds {
+		entry := AuditEntry{
+			Time:     now,
+			Operator: d.operator(),
+			Device:   d.String(),
+			Command:  redact(cmd),
+			Result:   "ok",
+			Duration: "0s",
+		}
+		if err != nil {
+			entry.Result = redact(err.Error())
+		}
+		if result != nil {
+			entry.Time = result.Commands[i].Sent
+			entry.Bytes = len(result.Commands[i].Output)
+			entry.Duration = result.Commands[i].Duration.String()
+		}
+		log.Write(entry)
+	}
+}
+
+// secret matches the secret in a command that sets a password, such as the
+// "0 hunter2" of "username admin secret 0 hunter2", and what precedes it.
+var secret = regexp.MustCompile(`(?i)\b((?:password|secret|plain-text-password-value|encrypted-password)(?:\s+[0-9])?\s+)("[^"]*"|\S+)`)
+
+// accountPassword matches the password EXOS takes as a bare argument after
+// the user name in "create account admin bob hunter2", and what precedes it.
+var accountPassword = regexp.MustCompile(`(?i)\b(create\s+account\s+\S+\s+\S+\s+(?:encrypted\s+)?)("[^"]*"|\S+)`)
+
+// redact replaces the secrets in s with "<redacted>", so that commands can be
+// logged without the passwords they set.
+func redact(s string) string {
+	s = accountPassword.ReplaceAllString(s, "${1}<redacted>")
+	return secret.ReplaceAllString(s, "${1}<redacted>")
+}
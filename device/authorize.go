@@ -0,0 +1,79 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import "fmt"
+
+// Authorizer decides whether user may run cmd on d, for integration with
+// role-based access control or change-management systems. Run authorizes
+// every command before it starts a session, so a denial never leaves a change
+// half applied.
+type Authorizer interface {
+	Authorize(d *Device, user, cmd string) error
+}
+
+// AuthorizerFunc adapts an ordinary function to the Authorizer interface.
+type AuthorizerFunc func(d *Device, user, cmd string) error
+
+// Authorize calls f(d, user, cmd).
+func (f AuthorizerFunc) Authorize(d *Device, user, cmd string) error {
+	return f(d, user, cmd)
+}
+
+// AuthorizationError is returned by Run when an Authorizer denies a command.
+type AuthorizationError struct {
+	Device  string // the device's name or address
+	User    string
+	Command string
+	Err     error // the error returned by the Authorizer
+}
+
+func (e *AuthorizationError) Error() string {
+	return fmt.Sprintf("%s is not authorized to run %q on %s: %v", e.User, e.Command, e.Device, e.Err)
+}
+
+// Cause returns the error returned by the Authorizer.
+func (e *AuthorizationError) Cause() error { return e.Err }
+
+// Unwrap returns the error returned by the Authorizer.
+func (e *AuthorizationError) Unwrap() error { return e.Err }
+
+// operator returns the name commands are run on behalf of.
+func (d *Device) operator() string {
+	if d.Operator != "" {
+		return d.Operator
+	}
+	return d.client().User()
+}
+
+// authorize checks every command with the device's Authorizer, if it has one.
+func (d *Device) authorize(cmds []string) error {
+	if d.Authorizer == nil {
+		return nil
+	}
+	user := d.operator()
+	for _, cmd := range cmds {
+		if err := d.Authorizer.Authorize(d, user, cmd); err != nil {
+			return &AuthorizationError{Device: d.String(), User: user, Command: cmd, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Banner returns the text of the device's banner of kind, "login" or "motd",
+// or an empty string if it has none.
+func (d *Device) Banner(kind string) (string, error) {
+	c, err := d.bannerConfigurer()
+	if err != nil {
+		return "", err
+	}
+	return d.banner(c, kind)
+}
+
+// SetBanner sets the device's banner of kind, "login" or "motd", to text, or
+// removes it if text is empty, and confirms that the device shows the new
+// banner.
+func (d *Device) SetBanner(kind, text string) error {
+	c, err := d.bannerConfigurer()
+	if err != nil {
+		return err
+	}
+	if err := d.apply("set "+kind+" banners", c.SetBanner(kind, text)); err != nil {
+		return err
+	}
+	got, err := d.banner(c, kind)
+	if err != nil {
+		return err
+	}
+	if strings.Join(lines(got), "\n") != strings.Join(lines(text), "\n") {
+		return errors.Errorf("%s: %s banner is %q after setting it", d, kind, got)
+	}
+	return nil
+}
+
+// banner returns the text of the banner of kind with c.
+func (d *Device) banner(c drivers.BannerConfigurer, kind string) (string, error) {
+	cmd, parse := c.Banner(kind)
+	if cmd == "" {
+		return "", errors.Errorf("%s: driver has no %s banner", d, kind)
+	}
+	output, err := d.show(cmd)
+	if err != nil {
+		return "", err
+	}
+	return parse(output), nil
+}
+
+// bannerConfigurer returns the device's driver as a BannerConfigurer.
+func (d *Device) bannerConfigurer() (drivers.BannerConfigurer, error) {
+	if c, ok := d.driver().(drivers.BannerConfigurer); ok {
+		return c, nil
+	}
+	return nil, errors.Errorf("%s: driver cannot configure banners", d)
+}
@@ -0,0 +1,146 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bootstrap is the initial configuration of a factory-default device.
+type Bootstrap struct {
+	Hostname string
+
+	// Config holds commands, run in configuration mode, that give the device
+	// its management address and enable SSH on it, such as an interface's
+	// "ip address" and "crypto key generate rsa modulus 2048". They vary too
+	// much between platforms and sites for drivers to generate them.
+	Config []string
+
+	Users []drivers.LocalUser
+	Keys  map[string][]ssh.PublicKey // keys to authorize, by user name
+
+	// Addr is where the device accepts SSH connections once configured, such
+	// as "10.0.0.5:22", and ClientConfig is used to connect there.
+	Addr         string
+	ClientConfig *ssh.ClientConfig
+
+	// Timeout is how long to wait for the device to accept connections at
+	// Addr. It defaults to five minutes.
+	Timeout time.Duration
+}
+
+// Provision pushes the bootstrap configuration b to d, a session with a
+// factory-default device, typically logged in with its default credentials
+// or reached through a console server with Console. It then waits for the
+// device to accept SSH connections at b.Addr and returns a Device connected
+// there, named after b.Hostname and sharing d's driver and metadata.
+//
+// The configuration is sent in one session and is not confirmed, since the
+// session may be cut off by the change of address; connecting at b.Addr is
+// the confirmation.
+func (d *Device) Provision(b *Bootstrap) (*Device, error) {
+	if b.Addr == "" || b.ClientConfig == nil {
+		return nil, errors.New("bootstrap requires an address and a client configuration")
+	}
+	cmds, err := d.bootstrapCommands(b)
+	if err != nil {
+		return nil, err
+	}
+	// The session often ends badly once the device moves to its new
+	// address, so a failure here is reported only if the device does not
+	// turn up there.
+	_, pushErr := d.Configure(cmds...)
+
+	timeout := b.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	dialer := d.dialer
+	if dialer == nil {
+		dialer = defaultDialer
+	}
+	netdev, err := dialer.WaitForSSH(ctx, b.Addr, b.ClientConfig, 5*time.Second)
+	if err != nil {
+		if pushErr != nil {
+			return nil, errors.Wrap(pushErr, "failed to push bootstrap configuration")
+		}
+		return nil, err
+	}
+	netdev.Metadata = d.Metadata
+	if b.Hostname != "" {
+		netdev.Name = b.Hostname
+	}
+	netdev.Driver = d.Driver
+	netdev.notify(SeverityNotice, "config", "provisioned by %s", d.operator())
+	return netdev, nil
+}
+
+// bootstrapCommands returns the configuration commands that apply b with the
+// device's driver.
+func (d *Device) bootstrapCommands(b *Bootstrap) ([]string, error) {
+	drv := d.driver()
+	var cmds []string
+	if b.Hostname != "" {
+		c, ok := drv.(drivers.HostnameConfigurer)
+		if !ok {
+			return nil, errors.Errorf("%s: driver cannot set host names", d)
+		}
+		cmds = append(cmds, c.Hostname(b.Hostname).Commands...)
+	}
+	cmds = append(cmds, b.Config...)
+	if len(b.Users) == 0 && len(b.Keys) == 0 {
+		return cmds, nil
+	}
+	c, err := d.userConfigurer()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range b.Users {
+		change := c.CreateUser(user)
+		if len(change.Commands) == 0 {
+			return nil, errors.Errorf("%s: driver cannot create users", d)
+		}
+		cmds = append(cmds, change.Commands...)
+	}
+	names := make([]string, 0, len(b.Keys))
+	for name := range b.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, key := range b.Keys[name] {
+			change := c.AddSSHKey(name, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+			if len(change.Commands) == 0 {
+				return nil, errors.Errorf("%s: driver cannot install %s keys", d, key.Type())
+			}
+			cmds = append(cmds, change.Commands...)
+		}
+	}
+	return cmds, nil
+}
@@ -0,0 +1,167 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Breaker stops a Dialer from connecting to hosts that keep failing, so
+// that automation retrying a fleet does not trip account lockout policies on
+// TACACS+ or RADIUS servers. After Failures failed connections to a host
+// within Window, the breaker opens for the host: connections to it fail at
+// once with a BreakerOpenError until Cooldown has passed. A successful
+// connection forgets the host's failures.
+//
+// Only refused authentication, an AuthError, is counted as a failure, since
+// only that can count against an account. Hosts that are unreachable, busy,
+// or drop the handshake, as sshd does while it starts, are not counted.
+//
+// The zero value is ready to use, and a Breaker may be shared by several
+// Dialers.
+type Breaker struct {
+	Failures int           // defaults to 3
+	Window   time.Duration // defaults to 10 minutes
+	Cooldown time.Duration // defaults to 30 minutes
+
+	mu    sync.Mutex
+	hosts map[string]*hostFailures
+}
+
+// hostFailures records the recent failures of a host.
+type hostFailures struct {
+	times []time.Time
+	err   error     // the last failure
+	until time.Time // when the breaker closes again, if open
+}
+
+// BreakerOpenError is returned, possibly wrapped, when a connection is not
+// attempted because the breaker is open for the host.
+type BreakerOpenError struct {
+	Addr     string
+	Until    time.Time // when connections will be attempted again
+	Failures int
+	Err      error // the last failure
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("not connecting to %s until %s after %d failures: %v",
+		e.Addr, e.Until.Format(time.RFC3339), e.Failures, e.Err)
+}
+
+func (e *BreakerOpenError) Unwrap() error { return e.Err }
+
+// Tripped returns the hosts the breaker is open for, in address order, with
+// their last failures, for reporting them apart from other errors.
+func (b *Breaker) Tripped() []BreakerOpenError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var tripped []BreakerOpenError
+	now := time.Now()
+	for addr, host := range b.hosts {
+		if now.Before(host.until) {
+			tripped = append(tripped, BreakerOpenError{Addr: addr, Until: host.until, Failures: len(host.times), Err: host.err})
+		}
+	}
+	sort.Slice(tripped, func(i, j int) bool { return tripped[i].Addr < tripped[j].Addr })
+	return tripped
+}
+
+// Reset forgets the failures of the host at addr, closing the breaker for it,
+// for example once its credentials have been fixed.
+func (b *Breaker) Reset(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.hosts, addr)
+}
+
+// allow returns a BreakerOpenError if the breaker is open for addr.
+func (b *Breaker) allow(addr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if host := b.hosts[addr]; host != nil && time.Now().Before(host.until) {
+		return &BreakerOpenError{Addr: addr, Until: host.until, Failures: len(host.times), Err: host.err}
+	}
+	return nil
+}
+
+// record counts the outcome of a connection to addr. Errors other than an
+// AuthError are ignored.
+func (b *Breaker) record(addr string, err error) {
+	if _, ok := err.(*AuthError); err != nil && !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.hosts, addr)
+		return
+	}
+	if b.hosts == nil {
+		b.hosts = make(map[string]*hostFailures)
+	}
+	host := b.hosts[addr]
+	if host == nil {
+		host = &hostFailures{}
+		b.hosts[addr] = host
+	}
+	now := time.Now()
+	window, cooldown, failures := b.Window, b.Cooldown, b.Failures
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Minute
+	}
+	if failures <= 0 {
+		failures = 3
+	}
+	recent := host.times[:0]
+	for _, t := range host.times {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	host.times, host.err = append(recent, now), err
+	if len(host.times) >= failures {
+		host.until = now.Add(cooldown)
+	}
+}
+
+// connect is dial guarded by the dialer's Breaker, if any.
+func (dl *Dialer) connect(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if dl.Breaker == nil {
+		return dl.dial(ctx, addr, config)
+	}
+	if err := dl.Breaker.allow(addr); err != nil {
+		return nil, err
+	}
+	client, err := dl.dial(ctx, addr, config)
+	if ctx.Err() == nil {
+		dl.Breaker.record(addr, err)
+	}
+	return client, err
+}
@@ -0,0 +1,128 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"regexp"
+	"time"
+)
+
+// busy matches the messages devices and console servers send when every vty
+// line or session slot is taken.
+var busy = regexp.MustCompile(`(?i)all (?:vty |tty )?(?:lines|ports) (?:are )?(?:busy|in use)|` +
+	`no (?:free|available) (?:vty|tty|lines|sessions|ports)|too many (?:users|sessions|logins|connections)|` +
+	`maximum (?:number of )?(?:sessions|connections|users|logins)|(?:session|connection|login) limit|` +
+	`exceeded maxstartups`)
+
+// BusyError is returned, possibly wrapped, when a device refuses a connection
+// or session because it has no free vty lines, a common and usually transient
+// failure on large runs. Use errors.Cause to tell it apart.
+type BusyError struct {
+	Addr    string
+	Message string // what the device said, if anything
+	Err     error
+}
+
+func (e *BusyError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s has no free lines: %v", e.Addr, e.Err)
+	}
+	return fmt.Sprintf("%s has no free lines: %q", e.Addr, e.Message)
+}
+
+func (e *BusyError) Unwrap() error { return e.Err }
+
+// BusyRetry configures how connections and sessions refused with a BusyError
+// are retried.
+type BusyRetry struct {
+	Retries int           // attempts after the first; zero means none
+	Delay   time.Duration // before the first retry, doubled for each after; zero means 5 seconds
+}
+
+// wait sleeps before retry attempt, the first being zero, or returns the
+// error of ctx if it is done first.
+func (b BusyRetry) wait(ctx context.Context, attempt int) error {
+	delay := b.Delay
+	if delay <= 0 {
+		delay = 5 * time.Second
+	}
+	timer := time.NewTimer(delay << uint(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// busyError returns a BusyError for err if err, or the last line of the
+// output the device sent before it, shows the device has no free lines.
+// Otherwise it returns nil. Earlier output, such as a banner that mentions
+// session limits, is not looked at.
+func busyError(addr string, err error, output []byte) *BusyError {
+	if err == nil {
+		return nil
+	}
+	if openErr, ok := err.(*ssh.OpenChannelError); ok && openErr.Reason == ssh.ResourceShortage {
+		return &BusyError{Addr: addr, Message: openErr.Message, Err: err}
+	}
+	if last := lastLine(output); busy.Match(last) {
+		return &BusyError{Addr: addr, Message: string(last), Err: err}
+	}
+	if busy.MatchString(err.Error()) {
+		return &BusyError{Addr: addr, Err: err}
+	}
+	return nil
+}
+
+// lastLine returns the last line of output that is not blank, where devices
+// put the message they send before ending a session.
+func lastLine(output []byte) []byte {
+	output = bytes.TrimRight(output, " \t\r\n")
+	if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[i+1:]
+	}
+	return bytes.TrimSpace(output)
+}
+
+// headConn keeps the first bytes read from a connection, where servers put
+// any message sent before closing it.
+type headConn struct {
+	net.Conn
+	head []byte
+}
+
+func (c *headConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if room := 512 - len(c.head); room > 0 {
+		if room > n {
+			room = n
+		}
+		c.head = append(c.head, p[:room]...)
+	}
+	return n, err
+}
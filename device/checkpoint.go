@@ -0,0 +1,86 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Checkpoint saves the running configuration as the checkpoint name, to be
+// restored with Rollback.
+func (d *Device) Checkpoint(name string) error {
+	checkpointer, ok := d.driver().(drivers.Checkpointer)
+	if !ok || checkpointer.Checkpoint(name) == nil {
+		return errors.Errorf("%s: driver cannot save checkpoints", d)
+	}
+	return d.runChecked(checkpointer.Checkpoint(name))
+}
+
+// Rollback replaces the running configuration with the checkpoint name.
+func (d *Device) Rollback(name string) error {
+	checkpointer, ok := d.driver().(drivers.Checkpointer)
+	if !ok || checkpointer.Rollback(name) == nil {
+		return errors.Errorf("%s: driver cannot roll back to checkpoints", d)
+	}
+	return d.runChecked(checkpointer.Rollback(name))
+}
+
+// runChecked runs cmds in a session of their own and returns a RejectedError
+// if the output shows the device refused one.
+func (d *Device) runChecked(cmds []string) error {
+	result, err := d.runSession(cmds...)
+	if err != nil {
+		return err
+	}
+	return d.rejection(result)
+}
+
+// rejection returns a RejectedError, holding every line in which the device
+// reports that a command failed, as recognized by the driver, if the output
+// of result has any. Only the output of the commands run is checked where it can be told
+// apart from the rest of the session.
+func (d *Device) rejection(result *Result) error {
+	rejecter, ok := d.driver().(drivers.Rejecter)
+	if !ok || rejecter.Rejected() == nil {
+		return nil
+	}
+	outputs := [][]byte{result.Output}
+	if len(result.Commands) > 0 && result.Commands[0].Output != nil {
+		outputs = outputs[:0]
+		for _, cmd := range result.Commands {
+			outputs = append(outputs, cmd.Output)
+		}
+	}
+	var rejected []string
+	for _, output := range outputs {
+		for _, line := range lines(string(output)) {
+			if rejecter.Rejected().MatchString(line) {
+				rejected = append(rejected, strings.TrimSpace(line))
+			}
+		}
+	}
+	if rejected == nil {
+		return nil
+	}
+	return &RejectedError{Device: d.String(), Message: strings.Join(rejected, "; ")}
+}
@@ -0,0 +1,172 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CollectManifest describes an archive written by Collect. It is stored in the
+// archive as manifest.json.
+type CollectManifest struct {
+	Device   string          `json:"device"`
+	Metadata Metadata        `json:"metadata"`
+	Driver   string          `json:"driver"`
+	Profile  string          `json:"profile"`
+	Start    time.Time       `json:"start"`
+	Duration string          `json:"duration"`
+	Files    []CollectedFile `json:"files"`
+}
+
+// CollectedFile is the output of one command in a Collect archive.
+type CollectedFile struct {
+	Command  string `json:"command"`
+	Name     string `json:"name"` // path within the archive
+	Bytes    int64  `json:"bytes"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"` // why the command failed, if it did
+}
+
+// Collect runs the commands of the driver's diagnostics profile, such as
+// "basic" or "full", and writes their output to w as a gzipped tar archive
+// with one file per command and a manifest. Commands are run one at a time
+// and a command that fails is recorded in the manifest rather than stopping
+// the collection. If progress is not nil, it is called after each command.
+func (d *Device) Collect(w io.Writer, profile string, progress func(cmd string, done, total int)) (*CollectManifest, error) {
+	drv, ok := d.driver().(drivers.Diagnostician)
+	if !ok {
+		return nil, errors.Errorf("%s: driver has no diagnostics profiles", d)
+	}
+	cmds := drv.Diagnostics(profile)
+	if len(cmds) == 0 {
+		return nil, errors.Errorf("%s: driver has no %q diagnostics profile", d, profile)
+	}
+	manifest := &CollectManifest{
+		Device:   d.String(),
+		Metadata: d.Metadata,
+		Driver:   d.driver().Name(),
+		Profile:  profile,
+		Start:    time.Now(),
+	}
+	dir := fileName(manifest.Device)
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	for i, cmd := range cmds {
+		file := CollectedFile{Command: cmd, Name: path.Join(dir, fmt.Sprintf("%02d-%s.txt", i+1, fileName(cmd)))}
+		start := time.Now()
+		if err := d.collect(archive, &file); err != nil {
+			if _, ok := err.(archiveError); ok {
+				return nil, err
+			}
+			file.Error = err.Error()
+		}
+		file.Duration = time.Since(start).String()
+		manifest.Files = append(manifest.Files, file)
+		if progress != nil {
+			progress(cmd, i+1, len(cmds))
+		}
+	}
+	manifest.Duration = time.Since(manifest.Start).String()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode manifest")
+	}
+	if err := writeArchiveFile(archive, path.Join(dir, "manifest.json"), int64(len(data)), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive")
+	}
+	if err := gz.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive")
+	}
+	return manifest, nil
+}
+
+// archiveError is an error writing the archive itself, which stops Collect.
+type archiveError struct{ error }
+
+// collect runs the command of file in a session of its own and adds its
+// output to archive. Spooled output is copied from its file without being
+// read into memory.
+func (d *Device) collect(archive *tar.Writer, file *CollectedFile) error {
+	result, err := d.runSession(file.Command)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	var r io.Reader
+	switch {
+	case result.Spool != "":
+		f, err := os.Open(result.Spool)
+		if err != nil {
+			return errors.Wrap(err, "failed to open spooled output")
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return errors.Wrap(err, "failed to open spooled output")
+		}
+		file.Bytes, r = info.Size(), f
+	case result.Commands[0].Output != nil:
+		file.Bytes, r = int64(len(result.Commands[0].Output)), bytes.NewReader(result.Commands[0].Output)
+	default:
+		file.Bytes, r = int64(len(result.Output)), bytes.NewReader(result.Output)
+	}
+	return writeArchiveFile(archive, file.Name, file.Bytes, r)
+}
+
+// writeArchiveFile adds a file of size bytes read from r to archive.
+func writeArchiveFile(archive *tar.Writer, name string, size int64, r io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}
+	if err := archive.WriteHeader(header); err != nil {
+		return archiveError{errors.Wrap(err, "failed to write archive")}
+	}
+	if _, err := io.Copy(archive, r); err != nil {
+		return archiveError{errors.Wrap(err, "failed to write archive")}
+	}
+	return nil
+}
+
+// fileName turns s, such as a command or device name, into a file name by
+// replacing everything but letters, digits, dots, and hyphens with hyphens and
+// dropping leading dots.
+func fileName(s string) string {
+	return strings.TrimLeft(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, s), ".")
+}
@@ -0,0 +1,313 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPagerPattern matches the pager prompts of common platforms, such as
+// "--More--", "-- More --", "<--- More --->", "---(more)---", and
+// "---(more 45%)---".
+var DefaultPagerPattern = regexp.MustCompile(`(?i)(?:<?-+ ?\(?more(?: \d+%)?\)? ?-+>?|press any key to continue)\s*$`)
+
+// collector collects the output of a remote shell while the session is still
+// running, so that Run can react to what the device prints before the shell
+// exits.
+type collector struct {
+	stdin  io.Writer
+	prompt *regexp.Regexp // matches a line holding only a prompt
+	pager  *regexp.Regexp // nil disables pager handling
+
+	sent int64 // bytes written to stdin
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	base int // offset of buf in the output, after spooled lines
+	done bool
+	err  error
+
+	spool *spooler // nil holds all output in buf
+}
+
+// newCollector starts collecting stdout in the background. Prompts are
+// recognized with prompt, or with a generic pattern if prompt is nil. If pager
+// is not nil, lines matching it are removed from the output and answered with
+// a space.
+func newCollector(stdin io.Writer, stdout io.Reader, prompt, pager *regexp.Regexp) *collector {
+	if prompt == nil {
+		prompt = trailingPrompt
+	}
+	c := &collector{stdin: stdin, prompt: prompt, pager: pager}
+	c.cond = sync.NewCond(&c.mu)
+	go c.read(stdout)
+	return c
+}
+
+// chunks holds the buffers sessions read into, so that tools polling many
+// devices do not allocate a fresh one for every session.
+var chunks = sync.Pool{
+	New: func() interface{} {
+		chunk := make([]byte, 32*1024)
+		return &chunk
+	},
+}
+
+// readAll is like ioutil.ReadAll but reads through a pooled buffer and
+// returns nil, without allocating, if r is empty.
+func readAll(r io.Reader) ([]byte, error) {
+	chunk := chunks.Get().(*[]byte)
+	defer chunks.Put(chunk)
+	var data []byte
+	for {
+		n, err := r.Read(*chunk)
+		data = append(data, (*chunk)[:n]...)
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+}
+
+func (c *collector) read(stdout io.Reader) {
+	pooled := chunks.Get().(*[]byte)
+	defer chunks.Put(pooled)
+	chunk := *pooled
+	for {
+		n, err := stdout.Read(chunk)
+		c.mu.Lock()
+		c.buf = append(c.buf, chunk[:n]...)
+		paged := false
+		if c.pager != nil && n > 0 {
+			start := c.lastLine()
+			if c.pager.Match(Normalize(c.buf[start:])) {
+				c.buf = c.buf[:start]
+				paged = true
+			}
+		}
+		if c.spool != nil && len(c.buf) > c.spool.threshold {
+			// Keep the line the cursor is on, where prompts are matched.
+			if start := c.lastLine(); start > 0 {
+				c.spool.write(c.buf[:start])
+				c.base += start
+				c.buf = append(c.buf[:0], c.buf[start:]...)
+			}
+		}
+		if err != nil {
+			c.done = true
+			if err != io.EOF {
+				c.err = err
+			}
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		if paged {
+			c.write(" ")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// setPrompt changes the pattern prompts are recognized with, as when a
+// session moves from one device to another. A nil prompt means a generic
+// pattern.
+func (c *collector) setPrompt(prompt *regexp.Regexp) {
+	if prompt == nil {
+		prompt = trailingPrompt
+	}
+	c.mu.Lock()
+	c.prompt = prompt
+	c.mu.Unlock()
+}
+
+// spoolTo makes the collector write complete lines to s once it holds more
+// than s.threshold bytes. A nil s holds all output in memory.
+func (c *collector) spoolTo(s *spooler) {
+	c.mu.Lock()
+	c.spool = s
+	c.mu.Unlock()
+}
+
+// spooled returns the spooler output was written to, or nil if all of it is
+// held in memory.
+func (c *collector) spooled() *spooler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spool == nil || c.spool.file == nil {
+		return nil
+	}
+	return c.spool
+}
+
+// discardSpool removes any spool file that was not handed to a Result and
+// holds further output in memory.
+func (c *collector) discardSpool() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spool != nil {
+		c.spool.discard()
+		c.spool = nil
+	}
+}
+
+// lastLine returns the index in c.buf of the line the cursor is on. c.mu must
+// be held.
+func (c *collector) lastLine() int {
+	return bytes.LastIndexByte(c.buf, '\n') + 1
+}
+
+// current returns the line the cursor is on, as expect matches it.
+func (c *collector) current() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.TrimRight(Normalize(c.buf[c.lastLine():]), " ")
+}
+
+// held returns the output held in memory from offset from on. c.mu must be
+// held.
+func (c *collector) held(from int) []byte {
+	if from -= c.base; from < 0 {
+		from = 0
+	}
+	return c.buf[from:]
+}
+
+// mark returns the offset of the line the cursor is on, where the output of
+// the next command, starting with its echo after the prompt, begins.
+func (c *collector) mark() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.base + c.lastLine()
+}
+
+// since returns a copy of the output collected after offset from.
+func (c *collector) since(from int) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.held(from)...)
+}
+
+// finished reports whether the remote shell has closed its standard output.
+func (c *collector) finished() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
+
+// len returns the number of bytes collected so far.
+func (c *collector) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.base + len(c.buf)
+}
+
+// write sends s to the remote shell's standard input.
+func (c *collector) write(s string) error {
+	n, err := io.WriteString(c.stdin, s)
+	atomic.AddInt64(&c.sent, int64(n))
+	return err
+}
+
+// writeUnrecorded is like write but keeps s out of the session's recording,
+// for passwords and for input recorded separately with record.
+func (c *collector) writeUnrecorded(s string) error {
+	stdin := c.stdin
+	if in, ok := stdin.(*recordedInput); ok {
+		stdin = in.stdin
+	}
+	n, err := io.WriteString(stdin, s)
+	atomic.AddInt64(&c.sent, int64(n))
+	return err
+}
+
+// record records s as input to the session, if it is recorded, without
+// sending it.
+func (c *collector) record(s string) {
+	if in, ok := c.stdin.(*recordedInput); ok {
+		io.WriteString(in.record, redact(s))
+	}
+}
+
+// waitPrompt blocks until the device prints a prompt on a line starting at or
+// after offset from, the remote shell exits, or the deadline passes.
+func (c *collector) waitPrompt(from int, deadline time.Time) error {
+	_, err := c.expect(from, deadline, c.prompt)
+	return err
+}
+
+// expect blocks until the line the cursor is on starts at or after offset
+// from and matches one of patterns, and returns the index of the pattern. It
+// returns -1 if the remote shell exits first, and TimeoutError if the deadline
+// passes.
+func (c *collector) expect(from int, deadline time.Time, patterns ...*regexp.Regexp) (int, error) {
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.done {
+		if start := c.lastLine(); c.base+start >= from {
+			line := bytes.TrimRight(Normalize(c.buf[start:]), " ")
+			for i, pattern := range patterns {
+				if pattern.Match(line) {
+					return i, nil
+				}
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return -1, TimeoutError
+		}
+		c.cond.Wait()
+	}
+	return -1, nil
+}
+
+// echoed reports whether the output collected after offset from includes cmd.
+func (c *collector) echoed(from int, cmd string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Contains(Normalize(c.held(from)), []byte(cmd))
+}
+
+// output waits for the remote shell to close its standard output and returns
+// everything it printed that was not spooled.
+func (c *collector) output() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.done {
+		c.cond.Wait()
+	}
+	return c.buf, c.err
+}
@@ -0,0 +1,222 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+)
+
+// A Parser turns the output of a show command into records keyed by what
+// identifies them, such as an interface name or neighbor address, with the
+// fields of each record keyed by name.
+type Parser func(output string) (map[string]map[string]string, error)
+
+// MatchParser returns a Parser that makes a record of every line matching
+// pattern. Named groups in pattern become fields, and the group named key
+// identifies the record.
+func MatchParser(pattern *regexp.Regexp, key string) Parser {
+	names, index := pattern.SubexpNames(), pattern.SubexpIndex(key)
+	return func(output string) (map[string]map[string]string, error) {
+		if index < 0 {
+			return nil, errors.Errorf("pattern has no group named %q", key)
+		}
+		records := make(map[string]map[string]string)
+		for _, line := range lines(output) {
+			match := pattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			record := make(map[string]string)
+			for i, name := range names {
+				if name != "" && name != key {
+					record[name] = match[i]
+				}
+			}
+			id := match[index]
+			if _, ok := records[id]; ok {
+				return nil, errors.Errorf("more than one record for %q", id)
+			}
+			records[id] = record
+		}
+		return records, nil
+	}
+}
+
+// FieldDiff is a field whose value differs between two devices.
+type FieldDiff struct {
+	Command string
+	Record  string // key of the record
+	Field   string // empty if the record was found on only one device
+	A, B    string // values of the field; for a missing record, the key or ""
+}
+
+func (d FieldDiff) String() string {
+	if d.Field == "" {
+		if d.A == "" {
+			return fmt.Sprintf("%s: %s only on B", d.Command, d.Record)
+		}
+		return fmt.Sprintf("%s: %s only on A", d.Command, d.Record)
+	}
+	return fmt.Sprintf("%s: %s %s: %q != %q", d.Command, d.Record, d.Field, d.A, d.B)
+}
+
+// Comparison holds the differences between the output of the same commands
+// on two devices.
+type Comparison struct {
+	A, B   *Snapshot
+	Fields []FieldDiff    // differences in commands with a parser
+	Lines  []SnapshotDiff // differences in commands without one
+}
+
+// Same reports whether no differences were found.
+func (c *Comparison) Same() bool {
+	return len(c.Fields) == 0 && len(c.Lines) == 0
+}
+
+// CompareDevices runs cmds on a and b at the same time, such as on a primary
+// and its standby or on a device and its replacement, and compares the
+// output. The output of commands with a parser is compared record by record
+// and field by field, and that of other commands line by line.
+func CompareDevices(a, b *Device, parsers map[string]Parser, cmds ...string) (*Comparison, error) {
+	var snapB *Snapshot
+	errB := make(chan error, 1)
+	go func() {
+		var err error
+		snapB, err = b.Snapshot(cmds...)
+		errB <- err
+	}()
+	snapA, err := a.Snapshot(cmds...)
+	if err := <-errB; err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CompareParsed(snapA, snapB, parsers)
+}
+
+// CompareParsed compares snapshots taken on two devices, or on one device at
+// different times, like CompareDevices.
+func CompareParsed(a, b *Snapshot, parsers map[string]Parser) (*Comparison, error) {
+	c := &Comparison{A: a, B: b}
+	unparsed := &Snapshot{Output: make(map[string]string)}
+	other := &Snapshot{Output: make(map[string]string)}
+	for _, cmd := range a.Commands {
+		if parsers[cmd] == nil {
+			unparsed.Commands = append(unparsed.Commands, cmd)
+			unparsed.Output[cmd] = a.Output[cmd]
+		}
+	}
+	for _, cmd := range b.Commands {
+		if parsers[cmd] == nil {
+			other.Commands = append(other.Commands, cmd)
+			other.Output[cmd] = b.Output[cmd]
+		}
+	}
+	c.Lines = CompareSnapshots(unparsed, other)
+
+	for _, cmd := range union(a.Commands, b.Commands) {
+		parse := parsers[cmd]
+		if parse == nil {
+			continue
+		}
+		recordsA, err := parse(a.Output[cmd])
+		if err != nil {
+			return nil, &ParseError{Device: a.Device, Command: cmd, Err: err}
+		}
+		recordsB, err := parse(b.Output[cmd])
+		if err != nil {
+			return nil, &ParseError{Device: b.Device, Command: cmd, Err: err}
+		}
+		c.Fields = append(c.Fields, compareRecords(cmd, recordsA, recordsB)...)
+	}
+	return c, nil
+}
+
+// compareRecords returns the differences between the records a and b, sorted
+// by record and field.
+func compareRecords(cmd string, a, b map[string]map[string]string) []FieldDiff {
+	var diffs []FieldDiff
+	for _, id := range recordKeys(a, b) {
+		recordA, inA := a[id]
+		recordB, inB := b[id]
+		switch {
+		case !inB:
+			diffs = append(diffs, FieldDiff{Command: cmd, Record: id, A: id})
+		case !inA:
+			diffs = append(diffs, FieldDiff{Command: cmd, Record: id, B: id})
+		default:
+			for _, field := range fieldKeys(recordA, recordB) {
+				if recordA[field] != recordB[field] {
+					diffs = append(diffs, FieldDiff{cmd, id, field, recordA[field], recordB[field]})
+				}
+			}
+		}
+	}
+	return diffs
+}
+
+// recordKeys returns the keys of the records in a and b, sorted.
+func recordKeys(a, b map[string]map[string]string) []string {
+	set := make(map[string]bool)
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	return sorted(set)
+}
+
+// fieldKeys returns the names of the fields in a and b, sorted.
+func fieldKeys(a, b map[string]string) []string {
+	set := make(map[string]bool)
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	return sorted(set)
+}
+
+func sorted(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// union returns the strings in a followed by those in b that are not in a.
+func union(a, b []string) []string {
+	all := append([]string(nil), a...)
+	for _, s := range b {
+		if !contains(all, s) {
+			all = append(all, s)
+		}
+	}
+	return all
+}
@@ -0,0 +1,137 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Configure runs cmds in configuration mode in a session of its own, with the
+// full sequence drivers.Configure returns for the device's driver: entering
+// configuration mode, committing, leaving, and saving. Without a driver, cmds
+// are run as given.
+func (d *Device) Configure(cmds ...string) (*Result, error) {
+	if drv := d.driver(); drv != nil {
+		cmds = drivers.Configure(drv, cmds...)
+	}
+	return d.runSession(cmds...)
+}
+
+// ConfigureLabeled is like Configure but commits with label, such as a
+// change ticket, using the driver's drivers.CommitLabeler, so that the commit
+// can be found in the device's commit history.
+func (d *Device) ConfigureLabeled(label string, cmds ...string) (*Result, error) {
+	drv := d.driver()
+	labeler, ok := drv.(drivers.CommitLabeler)
+	if !ok || labeler.LabeledCommit(label) == nil {
+		return nil, errors.Errorf("%s: driver cannot label commits", d)
+	}
+	enter, exit := drv.ConfigMode()
+	var all []string
+	all = append(all, enter...)
+	all = append(all, cmds...)
+	all = append(all, labeler.LabeledCommit(label)...)
+	all = append(all, exit...)
+	all = append(all, drv.Save()...)
+	return d.runSession(all...)
+}
+
+// VerifyError reports that a change was sent to a device but its
+// configuration does not show it.
+type VerifyError struct {
+	Command    string   // command the configuration was checked with
+	Missing    []string // lines that should have appeared
+	Unexpected []string // lines that should have gone
+}
+
+func (e *VerifyError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing %q", e.Missing))
+	}
+	if len(e.Unexpected) > 0 {
+		problems = append(problems, fmt.Sprintf("still has %q", e.Unexpected))
+	}
+	return fmt.Sprintf("%q %s after change", e.Command, strings.Join(problems, " and "))
+}
+
+// apply makes change with Configure and, if it has a Show command, confirms
+// that it took effect. What describes the change for the error returned if
+// the driver generated no commands, meaning the platform does not support it.
+func (d *Device) apply(what string, change drivers.Change) error {
+	if len(change.Commands) == 0 {
+		return errors.Errorf("%s: driver cannot %s", d, what)
+	}
+	result, err := d.Configure(change.Commands...)
+	if err != nil {
+		return err
+	}
+	if err := d.rejection(result); err != nil {
+		return err
+	}
+	if change.Show == "" {
+		return nil
+	}
+	return d.confirm(change)
+}
+
+// confirm returns a VerifyError if the output of change.Show lacks a line of
+// change.Present or has one of change.Absent.
+func (d *Device) confirm(change drivers.Change) error {
+	output, err := d.show(change.Show)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	verr := &VerifyError{Command: change.Show}
+	for _, line := range change.Present {
+		if !have[strings.TrimSpace(line)] {
+			verr.Missing = append(verr.Missing, line)
+		}
+	}
+	for _, line := range change.Absent {
+		if have[strings.TrimSpace(line)] {
+			verr.Unexpected = append(verr.Unexpected, line)
+		}
+	}
+	if verr.Missing != nil || verr.Unexpected != nil {
+		return verr
+	}
+	return nil
+}
+
+// show runs cmd in a session of its own and returns its output.
+func (d *Device) show(cmd string) (string, error) {
+	result, err := d.runSession(cmd)
+	if err != nil {
+		return "", err
+	}
+	if output := result.Commands[0].Output; output != nil {
+		return string(output), nil
+	}
+	return string(result.Output), nil
+}
@@ -0,0 +1,96 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"time"
+)
+
+// ConsoleHop describes how to reach a device through a console or terminal
+// server. When a Device's Console is set, each session Run opens lands on the
+// console server, which is told to connect to the device's port before any of
+// the device's own prompt handling, login, and setup takes place.
+type ConsoleHop struct {
+	// Command connects to the device, such as "connect port 5". It is sent
+	// with the line ending of the device's driver.
+	Command string
+
+	// Prompt matches a line that holds only the console server's prompt. If
+	// nil, a generic prompt pattern is used.
+	Prompt *regexp.Regexp
+
+	// Login, if set, answers the console server's own login prompts, as
+	// Device.Login does for the device, until its prompt appears.
+	Login []drivers.Step
+
+	// Steps, if set, are answered in turn after Command is sent, such as a
+	// port selection menu or a "Press Enter to connect" message. Each must
+	// be shown by the console server.
+	Steps []drivers.Step
+}
+
+// hop connects the session collected by out through the console server to
+// the device, ending lines with ending, then switches out to the device's
+// prompt.
+func (h *ConsoleHop) hop(out *collector, prompt *regexp.Regexp, ending string, timeout time.Duration) error {
+	server := h.Prompt
+	if server == nil {
+		server = trailingPrompt
+	}
+	from := 0
+	for _, step := range h.Login {
+		i, err := out.expect(from, time.Now().Add(timeout), step.Expect, server)
+		if err != nil {
+			return errors.Wrap(err, "failed to log in to console server")
+		}
+		if i != 0 {
+			break
+		}
+		from = out.len()
+		if err := out.writeUnrecorded(step.Send); err != nil {
+			return errors.Wrap(err, "failed to log in to console server")
+		}
+	}
+	if i, err := out.expect(from, time.Now().Add(timeout), server); err != nil {
+		return errors.Wrap(err, "failed to reach console server")
+	} else if i < 0 {
+		return errors.Wrap(io.EOF, "failed to reach console server")
+	}
+	from = out.len()
+	if err := out.write(h.Command + ending); err != nil {
+		return errors.Wrapf(err, "failed to run %q", h.Command)
+	}
+	for _, step := range h.Steps {
+		if _, err := out.expect(from, time.Now().Add(timeout), step.Expect); err != nil {
+			return errors.Wrapf(err, "failed to connect with %q", h.Command)
+		}
+		from = out.len()
+		if err := out.writeUnrecorded(step.Send); err != nil {
+			return errors.Wrapf(err, "failed to connect with %q", h.Command)
+		}
+	}
+	out.setPrompt(prompt)
+	return nil
+}
@@ -25,60 +25,366 @@
 package device
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"github.com/mwalto7/device/drivers"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/text/encoding"
 	"io"
 	"io/ioutil"
 	"os"
+	"regexp"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var TimeoutError = errors.New("session timed out")
+var (
+	TimeoutError = errors.New("session timed out")
+	EchoError    = errors.New("command was not echoed")
+)
+
+// timeout is how long Run and Ping wait for the remote device to respond by
+// default.
+const timeout = 5 * time.Second
 
 // Device represents an SSH client.
+//
+// A Device is safe for concurrent use by multiple goroutines. Each call to Run
+// opens its own session over the shared client connection.
 type Device struct {
 	*ssh.Client
+	Metadata
+
+	// CommandTimeout is how long Run and Ping wait for the device to respond.
+	// Zero means five seconds.
+	CommandTimeout time.Duration
+
+	// KeepAlive, if set, is the interval at which a device connected with
+	// Dial or New sends keepalive requests, so that idle connections are not
+	// dropped by firewalls. The connection is closed if a request fails.
+	KeepAlive time.Duration
+
+	// MaxSessions limits the number of sessions that may be open at once.
+	// Calls to Run beyond the limit wait until a session is released. Many
+	// devices refuse more than a handful of channels per connection. Zero
+	// means no limit. MaxSessions must be set before the first call to Run.
+	// The persistent session holds its slot for as long as it is open.
+	MaxSessions int
+
+	// RawOutput disables normalization of the output returned by Run. By
+	// default, output is cleaned up with Normalize.
+	RawOutput bool
+
+	// TrimEcho removes the echoed command lines, any login banner, and the
+	// trailing prompt from the output returned by Run, leaving only each
+	// command's response. Output is returned unchanged if the device does not
+	// echo commands.
+	TrimEcho bool
+
+	// Encoding is the character encoding used by the device. If set, commands
+	// are encoded with it before they are sent and output is decoded to UTF-8,
+	// for example with charmap.ISO8859_1 or simplifiedchinese.GBK from the
+	// golang.org/x/text/encoding packages. By default, UTF-8 is assumed.
+	Encoding encoding.Encoding
+
+	// AutoPage answers pager prompts such as --More-- with a space and removes
+	// them from the output, for accounts that are not allowed to disable
+	// paging. Because a pager would swallow commands typed ahead of it,
+	// AutoPage also makes Run wait for the device's prompt before sending each
+	// command.
+	AutoPage bool
+
+	// PagerPattern matches the pager prompts answered when AutoPage is set.
+	// If nil, DefaultPagerPattern is used.
+	PagerPattern *regexp.Regexp
+
+	// CommandDelay is how long Run pauses between commands, and CharDelay is
+	// how long it pauses between the characters of each command. Some
+	// terminal servers and older devices drop input that arrives in a single
+	// burst. Both default to zero.
+	CommandDelay time.Duration
+	CharDelay    time.Duration
+
+	// Console, if set, is the console server the device is reached
+	// through. Run connects through it at the start of each session.
+	Console *ConsoleHop
+
+	// Wake, if set, is sent as soon as the shell starts, and Run waits for
+	// the prompt it brings up before sending any commands. Some devices and
+	// console ports print nothing until they receive a newline. If empty, the
+	// driver's wake sequence is used, if it implements drivers.Waker.
+	Wake string
+
+	// Login answers a second login prompt that some devices and terminal
+	// servers present inside the shell after SSH authentication. If Login is
+	// nil and LoginPassword is set, the driver's login sequence for LoginUser
+	// and LoginPassword is used, or drivers.DefaultLogin if the driver does
+	// not implement drivers.LoginSequencer. LoginUser defaults to the SSH
+	// user. The sequence ends early if the device's prompt appears.
+	Login         []drivers.Step
+	LoginUser     string
+	LoginPassword string
+
+	// NewPassword, if set, is chosen when the device forces a change of an
+	// expired password in the shell before its prompt appears, as on the
+	// first login to a factory-default device. Prompts for the current
+	// password are answered with OldPassword, which defaults to
+	// LoginPassword. PasswordChange, if set, replaces the default steps,
+	// drivers.DefaultPasswordChange. Unlike Login, the steps are answered in
+	// any order, each whenever its Expect matches, until the prompt appears.
+	OldPassword    string
+	NewPassword    string
+	PasswordChange []drivers.Step
+
+	// Enable makes each session enter privileged mode after logging in, with
+	// the driver's command and steps, answering password prompts with
+	// EnablePassword. It may be empty, as on an ASA that has never had one
+	// set. The driver must implement drivers.Enabler.
+	Enable         bool
+	EnablePassword string
+
+	// Persistent makes consecutive calls to Run share one shell session
+	// instead of opening a new one each time, so that state such as enable
+	// or configuration mode carries over and setup commands are sent only
+	// once. Calls are serialized, and because the session does not end after
+	// each call, Run waits for the device's prompt after every command, as
+	// with AutoPage. The helpers built on Run, such as Configure and
+	// Snapshot, leave the session open too. CloseSession ends it.
+	Persistent bool
+
+	// IdleTimeout, if positive, closes the persistent session and the
+	// connection once Run, Ping, and MeasureRTT have not been called for
+	// that long, so that idle programs do not hold on to the few vty lines
+	// devices allow. The next call reconnects with Reconnect or, if it is
+	// nil, with the address and configuration the device was dialed with.
+	IdleTimeout time.Duration
+
+	// Reconnect, if set, re-establishes a connection closed by IdleTimeout,
+	// for devices created with New.
+	Reconnect func() (*ssh.Client, error)
+
+	// SpoolThreshold, if positive, is how many bytes of output Run holds in
+	// memory before writing it to a temporary file in SpoolDir, or in the
+	// default directory for temporary files if SpoolDir is empty. Spooled
+	// output is decoded and normalized as usual, but Commands do not hold
+	// their Output and TrimEcho has no effect; Result.Spool names the file.
+	// It is ignored if Persistent is set.
+	SpoolThreshold int
+	SpoolDir       string
+
+	// Busy configures retries of sessions refused because the device has no
+	// free vty lines. Handshakes are retried as configured by the Dialer.
+	Busy BusyRetry
+
+	// Retries is the number of times Run resends a command on the same
+	// session when the device does not echo it intact or does not return to
+	// its prompt, as happens on oversubscribed console servers. Like
+	// AutoPage, it makes Run wait for the prompt before sending each command.
+	// Retries relies on the device echoing commands and defaults to zero.
+	Retries int
+
+	// HistorySize is the number of commands kept in the device's History.
+	// Zero means DefaultHistorySize, and a negative value disables history.
+	// HistoryOutput is how many bytes of each command's output are kept with
+	// it; zero means DefaultHistoryOutput, and a negative value keeps none.
+	HistorySize   int
+	HistoryOutput int
+
+	// Recorder, if set, records every session run on the device.
+	Recorder *Recorder
+
+	// Locker serializes configuration changes to the device. If nil,
+	// DefaultLocker is used. LockTimeout is how long Run waits for the lock
+	// before giving up, and defaults to CommandTimeout.
+	Locker      Locker
+	LockTimeout time.Duration
+
+	// Policy, if set, is checked for every command before Run starts a
+	// session.
+	Policy *Policy
+
+	// Authorizer, if set, must approve every command before Run starts a
+	// session. Operator names the person or job commands are run on behalf
+	// of; it defaults to the SSH user.
+	Authorizer Authorizer
+	Operator   string
+
+	// AuditLog, if set, records every command run on the device. If nil,
+	// DefaultAuditLog is used.
+	AuditLog *AuditLog
+
+	// Archive, if set, stores the result of every successful call to Run on
+	// disk, one directory per run.
+	Archive *ResultArchive
+
+	// Syslog, if set, receives events about the device: connecting to it,
+	// changing its configuration, and failing to run commands. If nil,
+	// DefaultSyslog is used.
+	Syslog *Syslog
+
+	// Prompt, if set, matches a line that holds only the device's prompt,
+	// overriding the driver's pattern.
+	Prompt *regexp.Regexp
+
+	// Driver describes the device's command line. If nil, the driver
+	// registered for Platform is used, or the generic one if Platform is set
+	// but names no registered driver. When a driver is known, Run sends its
+	// setup commands at the start of each session and uses its prompt
+	// pattern.
+	Driver drivers.Driver
+
+	addr     string
+	config   *ssh.ClientConfig
+	dialer   *Dialer
+	once     sync.Once
+	sessions chan struct{}
+
+	shellMu sync.Mutex
+	shared  *shell // the persistent session, if open
+
+	historyMu sync.Mutex
+	history   []HistoryEntry
+
+	idleMu     sync.Mutex
+	idle       *time.Timer // closes the connection once it fires
+	active     int         // calls to Run, Ping, and MeasureRTT in progress
+	idleClosed bool        // the connection was closed by IdleTimeout
+
+	clientMu sync.Mutex // guards Client, which is replaced on reconnecting
 }
 
-// Dial creates a client connection to a remote device.
-func Dial(addr string, config *ssh.ClientConfig) (*Device, error) {
-	client, err := ssh.Dial("tcp", addr, config)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to dial")
+// Metadata describes a device in terms more meaningful than its address. It is
+// typically populated from an inventory and is carried along with the Device
+// so output from many devices can be attributed.
+type Metadata struct {
+	Name     string   `json:"name,omitempty"`     // hostname or inventory name
+	Platform string   `json:"platform,omitempty"` // operating system or driver name, e.g. "ios"
+	Site     string   `json:"site,omitempty"`     // location or data center
+	Tags     []string `json:"tags,omitempty"`     // arbitrary labels, e.g. "core" or "access"
+
+	// Vars holds host-specific values substituted into commands by RunVars.
+	// They are left out of JSON, such as that of snapshots and manifests,
+	// since they may hold secrets.
+	Vars map[string]string `json:"-"`
+}
+
+// HasTag reports whether the metadata is labeled with tag.
+func (m Metadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the device's name, or its remote address if it has no name.
+// A device that has not connected yet is named by the address it is being
+// dialed at.
+func (d *Device) String() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	client := d.client()
+	if client == nil {
+		return d.addr
 	}
-	return &Device{client}, nil
+	return client.RemoteAddr().String()
+}
+
+// DialAny connects to the first of addrs that completes an SSH handshake.
+func DialAny(config *ssh.ClientConfig, addrs ...string) (*Device, error) {
+	return defaultDialer.DialAny(config, addrs...)
+}
+
+// Addr returns the address the device was dialed at. RemoteAddr returns the
+// network address it resolved to.
+func (d *Device) Addr() string {
+	return d.addr
 }
 
 // Run creates a new session, starts a remote shell, and runs the
-// specified commands. The combined output of the remote shell's standard
-// output and standard error is returned.
-func (d *Device) Run(cmds ...string) ([]byte, error) {
-	session, err := d.NewSession()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create session")
+// specified commands. The result holds the combined output of the remote
+// shell's standard output and standard error, normalized unless RawOutput is
+// set, along with timing information about the session.
+//
+// Run labels the goroutines it uses with the device's name or address, as
+// "device", so that CPU and goroutine profiles can be broken down by device.
+func (d *Device) Run(cmds ...string) (*Result, error) {
+	return d.runWith(cmds, d.run)
+}
+
+// runWith does the work of Run around run, which sends cmds to the device.
+func (d *Device) runWith(cmds []string, run func([]string) (*Result, error)) (result *Result, err error) {
+	if err := d.resume(); err != nil {
+		return nil, err
 	}
-	defer session.Close()
+	defer d.rest()
+	pprof.Do(context.Background(), pprof.Labels("device", d.String()), func(context.Context) {
+		result, err = run(cmds)
+	})
+	d.audit(cmds, result, err)
+	d.remember(cmds, result, err)
+	d.archive(result, err)
+	d.notifyRun(cmds, err)
+	return result, err
+}
 
-	stdin, stdout, stderr, err := pipeIO(session)
-	if err != nil {
+func (d *Device) run(cmds []string) (*Result, error) {
+	if err := d.permit(cmds); err != nil {
 		return nil, err
 	}
-	defer stdin.Close()
+	if d.Persistent {
+		return d.runShared(cmds)
+	}
+	release := d.acquire()
+	defer release()
+	if d.entersConfig(cmds) {
+		unlock, err := d.lock()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
 
-	if err := session.Shell(); err != nil {
-		return nil, errors.Wrap(err, "failed to start remote shell")
+	result := d.newResult(cmds)
+	sh, err := d.openShell()
+	if err != nil {
+		return nil, err
+	}
+	defer sh.close()
+	sh.out.spoolTo(d.newSpooler())
+	defer sh.out.discardSpool()
+	if err := d.sendCommands(sh.out, result, cmds); err != nil {
+		return nil, err
 	}
-	for _, cmd := range cmds {
-		if _, err := io.WriteString(stdin, fmt.Sprintf("%s\n", cmd)); err != nil {
-			return nil, errors.Wrapf(err, "failed to run %q", cmd)
+	return d.await(sh, result, cmds)
+}
+
+// permit checks cmds against the device's Policy and Authorizer.
+func (d *Device) permit(cmds []string) error {
+	if d.Policy != nil {
+		for _, cmd := range cmds {
+			if err := d.Policy.Check(d, cmd); err != nil {
+				return err
+			}
 		}
 	}
+	return d.authorize(cmds)
+}
+
+// await waits for the session of sh, which ran cmds, to end and completes
+// result from its output.
+func (d *Device) await(sh *shell, result *Result, cmds []string) (*Result, error) {
 	wait := make(chan error, 1)
 	go func(wait chan<- error) {
-		wait <- session.Wait()
+		wait <- sh.session.Wait()
 	}(wait)
 	select {
 	case <-wait:
@@ -95,16 +401,509 @@ func (d *Device) Run(cmds ...string) ([]byte, error) {
 		//		   return nil, exitErr
 		//     }
 		// }
-		output, err := ioutil.ReadAll(io.MultiReader(stdout, stderr))
+		output, err := sh.out.output()
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to read stdout and stderr")
 		}
-		return output, nil
-	case <-time.After(5 * time.Second):
+		output = append(output, <-sh.errOutput...)
+		result.BytesSent = atomic.LoadInt64(&sh.out.sent)
+		if spool := sh.out.spooled(); spool != nil {
+			return d.finishSpool(result, spool, output, cmds)
+		}
+		return d.finish(result, output, sh.setup, cmds)
+	case <-time.After(d.timeout()):
 		return nil, TimeoutError
 	}
 }
 
+// runSession runs cmds with Run in a session of their own, followed by "exit"
+// to end it, which is how the helpers built on Run send their commands. If
+// the device is Persistent, no "exit" is sent and cmds run in the shared
+// session, which keeps its enable and configuration mode state and any
+// configuration lock it holds.
+func (d *Device) runSession(cmds ...string) (*Result, error) {
+	if !d.Persistent {
+		cmds = append(cmds[:len(cmds):len(cmds)], "exit")
+	}
+	return d.Run(cmds...)
+}
+
+// newResult returns the Result of running cmds, starting now.
+func (d *Device) newResult(cmds []string) *Result {
+	client := d.client()
+	result := &Result{
+		Metadata:   d.Metadata,
+		Commands:   make([]CommandResult, len(cmds)),
+		Start:      time.Now(),
+		RemoteAddr: client.RemoteAddr(),
+	}
+	if conn, ok := client.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		result.Cipher = conn.Algorithms().Write.Cipher
+	}
+	return result
+}
+
+// sendCommands sends cmds to the shell collected by out, recording each in
+// result.
+func (d *Device) sendCommands(out *collector, result *Result, cmds []string) error {
+	for i, cmd := range cmds {
+		if i > 0 {
+			prev := &result.Commands[i-1]
+			prev.Duration = time.Since(prev.Sent)
+		}
+		result.Commands[i] = CommandResult{Command: cmd, Sent: time.Now()}
+		if err := d.sendCommand(out, cmd); err != nil {
+			return err
+		}
+		if d.stepwise() {
+			result.Commands[i].Duration = time.Since(result.Commands[i].Sent)
+		}
+	}
+	return nil
+}
+
+// finish completes result from the output of a shell that ran the setup
+// commands followed by cmds.
+func (d *Device) finish(result *Result, output []byte, setup, cmds []string) (*Result, error) {
+	stopClock(result, cmds)
+	result.BytesReceived = int64(len(output))
+	output, err := d.clean(output)
+	if err != nil {
+		return nil, err
+	}
+	if bodies := splitEcho(output, append(append([]string(nil), setup...), cmds...), d.prompt()); bodies != nil {
+		bodies = bodies[len(setup):]
+		for i, body := range bodies {
+			result.Commands[i].Output = body
+		}
+		if d.TrimEcho {
+			output = bytes.Join(bodies, nil)
+		}
+	}
+	result.Output = output
+	return result, nil
+}
+
+// finishSpool is like finish for output that was spooled, writing the rest
+// of it to the spool file.
+func (d *Device) finishSpool(result *Result, spool *spooler, rest []byte, cmds []string) (*Result, error) {
+	stopClock(result, cmds)
+	if err := spool.close(rest); err != nil {
+		return nil, errors.Wrap(err, "failed to spool output")
+	}
+	result.BytesReceived = spool.received
+	result.Spool = spool.file.Name()
+	spool.file = nil
+	return result, nil
+}
+
+// stopClock sets the duration of result and, if it is not already known, of
+// its last command.
+func stopClock(result *Result, cmds []string) {
+	result.Duration = time.Since(result.Start)
+	if n := len(cmds); n > 0 && result.Commands[n-1].Duration == 0 {
+		last := &result.Commands[n-1]
+		last.Duration = time.Since(last.Sent)
+	}
+}
+
+// clean decodes output if Encoding is set and normalizes it unless RawOutput
+// is set.
+func (d *Device) clean(output []byte) ([]byte, error) {
+	if d.Encoding != nil {
+		var err error
+		if output, err = d.Encoding.NewDecoder().Bytes(output); err != nil {
+			return nil, errors.Wrap(err, "failed to decode output")
+		}
+	}
+	if !d.RawOutput {
+		output = Normalize(output)
+	}
+	return output, nil
+}
+
+// sendCommand sends cmd to the remote shell, pausing CommandDelay first if
+// other commands have been sent. If AutoPage or Retries is set, it waits for
+// the prompt to return, resending cmd up to Retries times if the prompt or the
+// echo of cmd does not appear.
+func (d *Device) sendCommand(out *collector, cmd string) error {
+	ending := d.lineEnding()
+	line, err := d.encodeLine(cmd)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		if d.CommandDelay > 0 && atomic.LoadInt64(&out.sent) > 0 {
+			time.Sleep(d.CommandDelay)
+		}
+		from := out.len()
+		if err := d.send(out, line); err != nil {
+			return errors.Wrapf(err, "failed to run %q", cmd)
+		}
+		if !d.stepwise() {
+			return nil
+		}
+		err := out.waitPrompt(from, time.Now().Add(d.timeout()))
+		if d.Retries <= 0 {
+			return err
+		}
+		if err == nil && !out.echoed(from, strings.TrimSuffix(line, ending)) {
+			err = EchoError
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= d.Retries {
+			return errors.Wrapf(err, "failed to run %q after %d attempts", cmd, attempt+1)
+		}
+		// Discard whatever part of the command is left on the input line
+		// before sending it again.
+		if err := out.write("\x15"); err != nil {
+			return errors.Wrapf(err, "failed to run %q", cmd)
+		}
+	}
+}
+
+// encodeLine returns cmd followed by the line ending, encoded with Encoding
+// if it is set.
+func (d *Device) encodeLine(cmd string) (string, error) {
+	line := cmd + d.lineEnding()
+	if d.Encoding != nil {
+		var err error
+		if line, err = d.Encoding.NewEncoder().String(line); err != nil {
+			return "", errors.Wrapf(err, "failed to encode %q", cmd)
+		}
+	}
+	return line, nil
+}
+
+// login answers the device's login prompts inside the shell, if any, looking
+// at output after offset from.
+func (d *Device) login(out *collector, drv drivers.Driver, from int) error {
+	steps := d.Login
+	if steps == nil && d.LoginPassword != "" {
+		user := d.LoginUser
+		if user == "" {
+			user = d.client().User()
+		}
+		if seq, ok := drv.(drivers.LoginSequencer); ok {
+			steps = seq.LoginSequence(user, d.LoginPassword)
+		} else {
+			steps = drivers.DefaultLogin(user, d.LoginPassword)
+		}
+	}
+	for _, step := range steps {
+		i, err := out.expect(from, time.Now().Add(d.timeout()), step.Expect, out.prompt)
+		if err != nil {
+			return errors.Wrap(err, "failed to log in")
+		}
+		if i != 0 {
+			return nil
+		}
+		from = out.len()
+		if err := out.writeUnrecorded(step.Send); err != nil {
+			return errors.Wrap(err, "failed to log in")
+		}
+	}
+	return nil
+}
+
+// changePassword answers the prompts of a forced password change, if the
+// device presents one after offset from, until the device's prompt appears.
+func (d *Device) changePassword(out *collector, from int) error {
+	steps := d.PasswordChange
+	if steps == nil && d.NewPassword != "" {
+		old := d.OldPassword
+		if old == "" {
+			old = d.LoginPassword
+		}
+		steps = drivers.DefaultPasswordChange(old, d.NewPassword)
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+	patterns := []*regexp.Regexp{out.prompt}
+	for _, step := range steps {
+		patterns = append(patterns, step.Expect)
+	}
+	// A device that rejects the new password asks for one again, so give up
+	// rather than answer forever.
+	for answers := 0; answers <= 2*len(steps); answers++ {
+		i, err := out.expect(from, time.Now().Add(d.timeout()), patterns...)
+		if err != nil {
+			return errors.Wrap(err, "failed to change password")
+		}
+		if i <= 0 {
+			return nil
+		}
+		from = out.len()
+		if err := out.writeUnrecorded(steps[i-1].Send); err != nil {
+			return errors.Wrap(err, "failed to change password")
+		}
+	}
+	return errors.New("failed to change password: the device did not accept it")
+}
+
+// enable enters privileged mode, if Enable is set, once the device's prompt
+// appears after offset from.
+func (d *Device) enable(out *collector, drv drivers.Driver, from int) error {
+	if !d.Enable {
+		return nil
+	}
+	enabler, ok := drv.(drivers.Enabler)
+	if !ok {
+		return errors.Errorf("%s: driver does not support enable mode", d)
+	}
+	cmd, steps, privileged := enabler.Enable(d.EnablePassword)
+	if cmd == "" {
+		return errors.Errorf("%s: platform has no enable mode", d)
+	}
+	if out.prompt == nil || privileged == nil {
+		return errors.Errorf("%s: entering enable mode requires the device's prompt", d)
+	}
+	deadline := time.Now().Add(d.timeout())
+	if err := out.waitPrompt(from, deadline); err != nil {
+		return errors.Wrap(err, "failed to enable")
+	}
+	from = out.len()
+	if err := out.write(cmd + d.lineEnding()); err != nil {
+		return errors.Wrap(err, "failed to enable")
+	}
+	patterns := []*regexp.Regexp{privileged, out.prompt}
+	for _, step := range steps {
+		patterns = append(patterns, step.Expect)
+	}
+	// A device that refuses the password asks for it again, and after a few
+	// attempts returns to its unprivileged prompt.
+	for answers := 0; answers <= 2*len(steps); answers++ {
+		i, err := out.expect(from, deadline, patterns...)
+		switch {
+		case err != nil:
+			return errors.Wrap(err, "failed to enable")
+		case i < 0:
+			return errors.New("failed to enable: the session ended")
+		case i == 0:
+			return nil
+		case i == 1:
+			return &AuthError{Addr: d.String(), Err: errors.New("enable password refused")}
+		}
+		from = out.len()
+		if err := out.writeUnrecorded(steps[i-2].Send); err != nil {
+			return errors.Wrap(err, "failed to enable")
+		}
+	}
+	return &AuthError{Addr: d.String(), Err: errors.New("enable password refused")}
+}
+
+// stepwise reports whether Run waits for the prompt between commands.
+func (d *Device) stepwise() bool {
+	return d.AutoPage || d.Retries > 0 || d.Persistent
+}
+
+// driver returns the device's driver, or nil if it is not known.
+func (d *Device) driver() drivers.Driver {
+	if d.Driver != nil {
+		return d.Driver
+	}
+	if d.Platform != "" {
+		return drivers.LookupOrGeneric(d.Platform)
+	}
+	return nil
+}
+
+// prompt returns the pattern matching the device's prompt, from Prompt or its
+// driver, or nil if neither is known.
+func (d *Device) prompt() *regexp.Regexp {
+	if d.Prompt != nil {
+		return d.Prompt
+	}
+	if drv := d.driver(); drv != nil {
+		return drv.Prompt()
+	}
+	return nil
+}
+
+// lineEnding returns what ends each command sent to the device.
+func (d *Device) lineEnding() string {
+	if ender, ok := d.driver().(drivers.LineEnder); ok {
+		return ender.LineEnding()
+	}
+	return "\n"
+}
+
+// send writes line to the remote shell, pausing CharDelay between bytes.
+func (d *Device) send(out *collector, line string) error {
+	if d.CharDelay <= 0 {
+		return out.write(line)
+	}
+	// Record the line whole so that the passwords it sets can be redacted.
+	out.record(line)
+	for i := 0; i < len(line); i++ {
+		if i > 0 {
+			time.Sleep(d.CharDelay)
+		}
+		if err := out.writeUnrecorded(line[i : i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pager returns the pattern matching pager prompts to answer, or nil if
+// AutoPage is not set.
+func (d *Device) pager() *regexp.Regexp {
+	switch {
+	case !d.AutoPage:
+		return nil
+	case d.PagerPattern != nil:
+		return d.PagerPattern
+	default:
+		return DefaultPagerPattern
+	}
+}
+
+// acquire blocks until a session slot is available and returns a function
+// that releases it.
+func (d *Device) acquire() (release func()) {
+	d.once.Do(func() {
+		if d.MaxSessions > 0 {
+			d.sessions = make(chan struct{}, d.MaxSessions)
+		}
+	})
+	if d.sessions == nil {
+		return func() {}
+	}
+	d.sessions <- struct{}{}
+	return func() { <-d.sessions }
+}
+
+// Ping checks that the connection to the remote device and its shell are
+// still alive. It first sends a keepalive request, which servers commonly
+// reject but which still proves the connection is responsive, and then sends
+// an empty line to the persistent session, if one is open, or to a new
+// session, and waits for the device's prompt. A persistent session that does
+// not answer is closed, so that the next call to Run opens a new one.
+func (d *Device) Ping() error {
+	if err := d.resume(); err != nil {
+		return err
+	}
+	defer d.rest()
+	if _, err := d.roundTrip(); err != nil {
+		return err
+	}
+	if d.Persistent {
+		d.shellMu.Lock()
+		defer d.shellMu.Unlock()
+		if sh := d.shared; sh != nil {
+			if err := d.pingShell(sh); err != nil {
+				sh.close()
+				d.shared = nil
+				return err
+			}
+			return nil
+		}
+	}
+	release := d.acquire()
+	defer release()
+	sh, err := d.openShell()
+	if err != nil {
+		return errors.Wrap(err, "failed to ping")
+	}
+	defer sh.close()
+	return d.pingShell(sh)
+}
+
+// pingShell sends an empty line to sh and waits for the device's prompt.
+func (d *Device) pingShell(sh *shell) error {
+	from := sh.out.len()
+	if err := sh.out.write(d.lineEnding()); err != nil {
+		return errors.Wrap(err, "failed to ping")
+	}
+	i, err := sh.out.expect(from, time.Now().Add(d.timeout()), sh.out.prompt)
+	if err != nil {
+		return errors.Wrap(err, "failed to ping")
+	}
+	if i < 0 {
+		return errors.New("failed to ping: the session ended")
+	}
+	return nil
+}
+
+// roundTrip sends a keepalive request and returns how long the reply took.
+func (d *Device) roundTrip() (time.Duration, error) {
+	return roundTrip(d.client(), d.timeout())
+}
+
+// roundTrip sends a keepalive request over client and returns how long the
+// reply took, waiting at most timeout.
+func roundTrip(client *ssh.Client, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	wait := make(chan error, 1)
+	go func(wait chan<- error) {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		wait <- err
+	}(wait)
+	select {
+	case err := <-wait:
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to ping")
+		}
+		return time.Since(start), nil
+	case <-time.After(timeout):
+		return 0, TimeoutError
+	}
+}
+
+// RTT summarizes round-trip times measured by MeasureRTT.
+type RTT struct {
+	Samples       []time.Duration
+	Min, Avg, Max time.Duration
+
+	// Jitter is the mean difference between consecutive samples.
+	Jitter time.Duration
+}
+
+// MeasureRTT times samples keepalive round trips over the established
+// connection. The measurement includes the device's SSH processing time, so
+// it reflects what automation experiences rather than raw network latency.
+func (d *Device) MeasureRTT(samples int) (*RTT, error) {
+	if samples < 1 {
+		return nil, errors.New("at least one sample is required")
+	}
+	if err := d.resume(); err != nil {
+		return nil, err
+	}
+	defer d.rest()
+	rtt := &RTT{Samples: make([]time.Duration, samples)}
+	var total, jitter time.Duration
+	for i := range rtt.Samples {
+		sample, err := d.roundTrip()
+		if err != nil {
+			return nil, err
+		}
+		rtt.Samples[i] = sample
+		total += sample
+		if i == 0 || sample < rtt.Min {
+			rtt.Min = sample
+		}
+		if sample > rtt.Max {
+			rtt.Max = sample
+		}
+		if i > 0 {
+			diff := sample - rtt.Samples[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+		}
+	}
+	rtt.Avg = total / time.Duration(samples)
+	if samples > 1 {
+		rtt.Jitter = jitter / time.Duration(samples-1)
+	}
+	return rtt, nil
+}
+
 // pipeIO creates pipes a remote shell's standard input, standard output,
 // and standard error.
 func pipeIO(session *ssh.Session) (stdin io.WriteCloser, stdout, stderr io.Reader, err error) {
@@ -130,11 +929,7 @@ var NoAuthMethodsError = errors.New("no authentication methods specified")
 // configuration accepts all host connections, but it is recommended to use
 // the `AllowKnownHosts` Option.
 func NewClientConfig(user string, opts ...Option) (*ssh.ClientConfig, error) {
-	config := &ssh.ClientConfig{
-		User:            user,
-		Auth:            []ssh.AuthMethod{},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
+	config := newClientConfig(user)
 	for _, opt := range opts {
 		if err := opt(config); err != nil {
 			return nil, err
@@ -149,6 +944,30 @@ func NewClientConfig(user string, opts ...Option) (*ssh.ClientConfig, error) {
 // Option defines a function used to set the fields of a client configuration.
 type Option func(*ssh.ClientConfig) error
 
+// ExpiredPassword adds keyboard-interactive authentication that answers a
+// forced change of an expired password during SSH authentication, with old
+// for prompts for the current password and new for prompts to choose or
+// confirm a new one, as drivers.DefaultPasswordChange does in the shell.
+func ExpiredPassword(old, new string) Option {
+	steps := drivers.DefaultPasswordChange(old, new)
+	return func(config *ssh.ClientConfig) error {
+		config.Auth = append(config.Auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i, question := range questions {
+				answers[i] = old
+				for _, step := range steps {
+					if step.Expect.MatchString(strings.TrimSpace(question)) {
+						answers[i] = strings.TrimSuffix(step.Send, "\n")
+						break
+					}
+				}
+			}
+			return answers, nil
+		}))
+		return nil
+	}
+}
+
 // Password adds password authentication method to a client configuration.
 func Password(password string) Option {
 	return func(config *ssh.ClientConfig) error {
@@ -186,10 +1005,15 @@ func PrivateKey(privateKeys ...string) Option {
 	}
 }
 
-// AllowKnowHosts allows connecting only to hosts in the local known_hosts file.
-func AllowKnowHosts(knownHosts string) Option {
+// AllowKnownHosts allows connecting only to hosts in the local known_hosts
+// files. Like OpenSSH's UserKnownHostsFile and GlobalKnownHostsFile, several
+// files, such as a system-wide and a per-project one, may be given, and files
+// that do not exist are skipped. A leading "~/" stands for the user's home
+// directory. To accept and record the keys of hosts not yet listed, use
+// TrustOnFirstUse instead.
+func AllowKnownHosts(knownHosts ...string) Option {
 	return func(config *ssh.ClientConfig) error {
-		callback, err := knownhosts.New(knownHosts)
+		callback, err := knownHostsCallback(knownHosts...)
 		if err != nil {
 			return err
 		}
@@ -198,6 +1022,13 @@ func AllowKnowHosts(knownHosts string) Option {
 	}
 }
 
+// AllowKnowHosts is the former name of AllowKnownHosts.
+//
+// Deprecated: Use AllowKnownHosts.
+func AllowKnowHosts(knownHosts ...string) Option {
+	return AllowKnownHosts(knownHosts...)
+}
+
 // Timeout sets the timeout duration for connecting to a remote host.
 func Timeout(d time.Duration) Option {
 	return func(config *ssh.ClientConfig) error {
@@ -214,3 +1045,109 @@ func Ciphers(ciphers ...string) Option {
 		return nil
 	}
 }
+
+// StrictCrypto restricts the ciphers, MACs, key exchanges, and host key
+// algorithms the client offers to a modern set approved under FIPS 140-3:
+// AES in GCM and CTR modes, SHA-2 HMACs, NIST-curve ECDH and SHA-2
+// Diffie-Hellman key exchanges, and ECDSA and SHA-2 RSA host keys. Hosts that
+// support only weaker algorithms, such as SHA-1 or CBC ciphers, are refused.
+// Options applied after StrictCrypto, such as Ciphers and PlatformDefaults,
+// can add algorithms back.
+func StrictCrypto() Option {
+	return func(config *ssh.ClientConfig) error {
+		config.Ciphers = []string{
+			"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+			"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		}
+		config.MACs = []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+			"hmac-sha2-256", "hmac-sha2-512",
+		}
+		config.KeyExchanges = []string{
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		}
+		config.HostKeyAlgorithms = []string{
+			"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+			"rsa-sha2-256", "rsa-sha2-512",
+		}
+		return nil
+	}
+}
+
+// RekeyThreshold sets the number of bytes after which the connection's keys
+// are renegotiated. By default, a threshold suited to the negotiated cipher is
+// used. Rekeying happens transparently, without interrupting running
+// sessions. The SSH client rekeys only on data volume, not after a period of
+// time.
+func RekeyThreshold(bytes uint64) Option {
+	return func(config *ssh.ClientConfig) error {
+		config.RekeyThreshold = bytes
+		return nil
+	}
+}
+
+// ClientVersion sets the version identification string sent to remote hosts.
+// The "SSH-2.0-" protocol prefix is added if it is missing.
+func ClientVersion(version string) Option {
+	return func(config *ssh.ClientConfig) error {
+		if version == "" {
+			return errors.New("client version must not be empty")
+		}
+		if !strings.HasPrefix(version, "SSH-2.0-") {
+			version = "SSH-2.0-" + version
+		}
+		config.ClientVersion = version
+		return nil
+	}
+}
+
+// PlatformDefaults adds the SSH algorithms that the driver registered for
+// platform says its devices may require, such as the legacy ciphers and key
+// exchanges of older releases, to the client's default algorithms. Options
+// applied after PlatformDefaults see the combined lists and take precedence.
+// Dial does this by itself when the device's platform or driver is given.
+func PlatformDefaults(platform string) Option {
+	return func(config *ssh.ClientConfig) error {
+		driver, err := drivers.Lookup(platform)
+		if err != nil {
+			return err
+		}
+		addAlgorithms(config, driver.Capabilities().Algorithms)
+		return nil
+	}
+}
+
+// addAlgorithms adds algs to the client's default algorithms.
+func addAlgorithms(config *ssh.ClientConfig, algs drivers.Algorithms) {
+	if len(algs.Ciphers)+len(algs.KeyExchanges)+len(algs.MACs)+len(algs.HostKeys) == 0 {
+		return
+	}
+	config.SetDefaults()
+	config.Ciphers = appendMissing(config.Ciphers, algs.Ciphers...)
+	config.KeyExchanges = appendMissing(config.KeyExchanges, algs.KeyExchanges...)
+	config.MACs = appendMissing(config.MACs, algs.MACs...)
+	if len(algs.HostKeys) > 0 {
+		if config.HostKeyAlgorithms == nil {
+			config.HostKeyAlgorithms = ssh.SupportedAlgorithms().HostKeys
+		}
+		config.HostKeyAlgorithms = appendMissing(config.HostKeyAlgorithms, algs.HostKeys...)
+	}
+}
+
+// appendMissing appends the elements of add that are not already in list.
+func appendMissing(list []string, add ...string) []string {
+	for _, s := range add {
+		found := false
+		for _, t := range list {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -23,22 +23,160 @@
 package device_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
-	"github.com/mwalto7/netconfig/device"
+	"github.com/mwalto7/device/device"
+	"github.com/mwalto7/device/device/devicetest"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
 	"time"
 )
 
-func ExampleDevice_Run() {
-	// Create a new client configuration.
-	config, err := device.NewClientConfig("user", device.Password("password"))
+func BenchmarkDevice_Run(b *testing.B) {
+	show := strings.Repeat("GigabitEthernet1/0/1 is up, line protocol is up\n", 1000)
+	server := devicetest.NewServer(map[string]string{"show interfaces": show})
+	defer server.Close()
+	netdev, err := device.Dial(server.Addr, "user", device.Password("password"))
 	if err != nil {
-		log.Fatal(err)
+		b.Fatal(err)
+	}
+	defer netdev.Close()
+	netdev.HistorySize = -1
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(show)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := netdev.Run("show interfaces", "exit"); err != nil {
+			b.Fatal(err)
+		}
 	}
+}
+
+func BenchmarkDevice_RunLargeOutput(b *testing.B) {
+	const line = "GigabitEthernet1/0/1 is up, line protocol is up"
+	for _, size := range []struct {
+		name  string
+		bytes int
+		spool bool
+	}{
+		{"1MB", 1 << 20, false},
+		{"10MB", 10 << 20, false},
+		{"100MB", 100 << 20, false},
+		{"100MB-spooled", 100 << 20, true},
+	} {
+		b.Run(size.name, func(b *testing.B) {
+			if testing.Short() && size.bytes > 10<<20 {
+				b.Skip("skipping large output in short mode")
+			}
+			server := devicetest.NewUnstartedServer(nil)
+			server.Handlers = map[string]func(io.Writer){"show tech-support": devicetest.Repeat(line, size.bytes)}
+			server.Start()
+			defer server.Close()
+			netdev, err := device.Dial(server.Addr, "user", device.Password("password"), device.WithCommandTimeout(time.Minute))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer netdev.Close()
+			netdev.HistorySize = -1
+			if size.spool {
+				netdev.SpoolThreshold = 1 << 20
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size.bytes))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result, err := netdev.Run("show tech-support", "exit")
+				if err != nil {
+					b.Fatal(err)
+				}
+				result.Close()
+			}
+		})
+	}
+}
 
+func BenchmarkCompareSnapshots(b *testing.B) {
+	// Two large configurations differing in a few places throughout, as
+	// before and after a change pushed to many interfaces.
+	var before, after strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&before, "interface GigabitEthernet1/0/%d\n description port %d\n", i, i)
+		fmt.Fprintf(&after, "interface GigabitEthernet1/0/%d\n description port %d\n", i, i)
+		if i%1000 == 0 {
+			fmt.Fprintf(&after, " shutdown\n")
+		}
+	}
+	a := &device.Snapshot{Commands: []string{"show running-config"}, Output: map[string]string{"show running-config": before.String()}}
+	c := &device.Snapshot{Commands: []string{"show running-config"}, Output: map[string]string{"show running-config": after.String()}}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(before.Len() + after.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if diffs := device.CompareSnapshots(a, c); len(diffs) != 1 || len(diffs[0].Added) != 20 {
+			b.Fatalf("CompareSnapshots() = %v", diffs)
+		}
+	}
+}
+
+func BenchmarkDevice_RunParallel(b *testing.B) {
+	const fleet = 64
+	show := strings.Repeat("GigabitEthernet1/0/1 is up, line protocol is up\n", 100)
+	server := devicetest.NewServer(map[string]string{"show interfaces": show})
+	defer server.Close()
+	devices := make(chan *device.Device, fleet)
+	for i := 0; i < fleet; i++ {
+		netdev, err := device.Dial(server.Addr, "user", device.Password("password"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer netdev.Close()
+		netdev.HistorySize = -1
+		devices <- netdev
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(show)))
+	b.SetParallelism(fleet)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			netdev := <-devices
+			_, err := netdev.Run("show interfaces", "exit")
+			devices <- netdev
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func ExampleDevice_Run() {
 	// Establish a client connection to a host and defer closing the connection.
-	netdev, err := device.Dial(net.JoinHostPort("host", "port"), config)
+	netdev, err := device.Dial(
+		net.JoinHostPort("host", "port"),
+		"user",
+		device.Password("password"),
+		device.WithKeepAlive(30*time.Second),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -46,11 +184,16 @@ func ExampleDevice_Run() {
 
 	// Run the commands and capture the session output.
 	var cmds []string
-	output, err := netdev.Run(cmds...)
+	result, err := netdev.Run(cmds...)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(string(output))
+	fmt.Println(string(result.Output))
+
+	// Report how long each command took.
+	for _, cmd := range result.Commands {
+		fmt.Printf("%s: %v\n", cmd.Command, cmd.Duration)
+	}
 }
 
 func ExampleNewClientConfig() {
@@ -61,7 +204,7 @@ func ExampleNewClientConfig() {
 		"user",
 
 		// Only connect to hosts in known_hosts
-		device.AllowKnowHosts("~/.ssh/known_hosts"),
+		device.AllowKnownHosts("~/.ssh/known_hosts"),
 
 		// Use key authentication
 		device.PrivateKey("~/.ssh/id_rsa"),
@@ -72,11 +215,1987 @@ func ExampleNewClientConfig() {
 		// Timeout if establishing the connection exceeds the duration
 		device.Timeout(5*time.Second),
 
+		// Accept the legacy algorithms older IOS releases require
+		device.PlatformDefaults("ios"),
+
 		// Add additional ciphers supported by this device
 		device.Ciphers("aes128-cbc", "3des-cbc", "aes192-cbc", "aes256-cbc"),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
-	device.Dial("addr", config)
+	(&device.Dialer{}).Dial("addr", config)
+}
+
+func ExampleWaitForSSH() {
+	server := devicetest.NewServer(map[string]string{"show version": "Version 15.2\n"})
+	defer server.Close()
+	config, err := device.NewClientConfig("user", device.Password("password"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Wait up to ten minutes for a freshly provisioned device to come up.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	netdev, err := device.WaitForSSH(ctx, server.Addr, config, 15*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer netdev.Close()
+	result, err := netdev.Run("show version", "exit")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(result.Commands[0].Output))
+	// Output: Version 15.2
+}
+
+// dial connects to server, closing the connection when t ends.
+func dial(t *testing.T, server *devicetest.Server, opts ...device.DeviceOption) *device.Device {
+	t.Helper()
+	netdev, err := device.Dial(server.Addr, "user", append([]device.DeviceOption{device.Password("password")}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { netdev.Close() })
+	return netdev
+}
+
+func TestDevice_Snapshot(t *testing.T) {
+	server := devicetest.NewServer(map[string]string{
+		"show version": "Version 15.2\n",
+		"show clock":   "12:00:00 UTC\n",
+	})
+	t.Cleanup(server.Close)
+	for _, cmds := range [][]string{
+		{"show version"},
+		{"show version", "show clock"},
+	} {
+		metadata := device.Metadata{Name: "sw1", Site: "dc1", Tags: []string{"access"}}
+		netdev := dial(t, server, device.WithMetadata(metadata))
+		snap, err := netdev.Snapshot(cmds...)
+		if err != nil {
+			t.Fatalf("Snapshot(%q): %v", cmds, err)
+		}
+		if len(snap.Commands) != len(cmds) || len(snap.Output) != len(cmds) {
+			t.Errorf("Snapshot(%q) captured %q: %q", cmds, snap.Commands, snap.Output)
+		}
+		if snap.Device != "sw1" || snap.Metadata.Site != "dc1" || !snap.Metadata.HasTag("access") {
+			t.Errorf("Snapshot(%q) of %s has metadata %+v", cmds, snap.Device, snap.Metadata)
+		}
+		result, err := netdev.Run(append(cmds, "exit")...)
+		if err != nil {
+			t.Fatalf("Run(%q): %v", cmds, err)
+		}
+		if result.Metadata.Name != "sw1" {
+			t.Errorf("Run(%q) has metadata %+v", cmds, result.Metadata)
+		}
+		for _, cmd := range cmds {
+			if want := server.Commands[cmd]; !strings.Contains(snap.Output[cmd], want) {
+				t.Errorf("Snapshot(%q): output of %q is %q, want %q", cmds, cmd, snap.Output[cmd], want)
+			}
+		}
+	}
+}
+
+func TestResultArchive(t *testing.T) {
+	server := devicetest.NewServer(map[string]string{
+		"show version": "Version 15.2\n",
+		"show clock":   "12:00:00 UTC\n",
+	})
+	t.Cleanup(server.Close)
+	dir := t.TempDir()
+	netdev := dial(t, server, device.WithMetadata(device.Metadata{Name: "sw1", Site: "dc1"}))
+	netdev.Archive = device.NewResultArchive(dir)
+	for i := 0; i < 2; i++ {
+		if _, err := netdev.Run("show version", "show clock", "show clock", "exit"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := netdev.Archive.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := filepath.Glob(filepath.Join(dir, "sw1", "*"))
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("archived runs %q, %v", runs, err)
+	}
+	for _, run := range runs {
+		for name, want := range map[string]string{
+			"show-version.txt": "Version 15.2\n",
+			"show-clock.txt":   "12:00:00 UTC\n",
+			"show-clock-2.txt": "12:00:00 UTC\n",
+			"exit.txt":         "",
+		} {
+			got, err := ioutil.ReadFile(filepath.Join(run, name))
+			if err != nil || string(got) != want {
+				t.Errorf("%s: %s holds %q, %v; want %q", run, name, got, err, want)
+			}
+		}
+		data, err := ioutil.ReadFile(filepath.Join(run, "manifest.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest device.ResultManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		if manifest.Device != "sw1" || manifest.Metadata.Site != "dc1" || len(manifest.Files) != 4 ||
+			manifest.Files[0].Command != "show version" || manifest.Files[0].Bytes != int64(len("Version 15.2\n")) {
+			t.Errorf("%s: manifest %+v", run, manifest)
+		}
+	}
+}
+
+func TestDevice_Verify(t *testing.T) {
+	server := devicetest.NewServer(map[string]string{
+		"show interfaces status": "Gi1/0/1  uplink  connected  trunk\nGi1/0/2  spare   disabled   1\n",
+		"show vlan brief":        "10   users   active\n",
+	})
+	t.Cleanup(server.Close)
+	errDown := errors.New("uplink is down")
+	for _, test := range []struct {
+		name  string
+		check device.Check
+		pass  bool
+	}{
+		{"contains", device.Check{Command: "show interfaces status", Contains: "uplink  connected"}, true},
+		{"missing", device.Check{Command: "show interfaces status", Contains: "Gi1/0/3"}, false},
+		{"absent", device.Check{Command: "show interfaces status", Contains: "err-disabled", Absent: true}, true},
+		{"present", device.Check{Command: "show interfaces status", Contains: "disabled", Absent: true}, false},
+		{"matches", device.Check{Command: "show vlan brief", Matches: regexp.MustCompile(`(?m)^10 +users +active`)}, true},
+		{"mismatch", device.Check{Command: "show vlan brief", Matches: regexp.MustCompile(`(?m)^20 `)}, false},
+		{"func", device.Check{Command: "show vlan brief", Func: func(string) error { return errDown }}, false},
+		{"unknown", device.Check{Command: "show bogus", Contains: "Invalid input", Absent: true}, false},
+	} {
+		verification, err := dial(t, server).Verify(test.check)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if verification.Passed() != test.pass {
+			t.Errorf("%s: Passed() = %v, want %v:\n%s", test.name, !test.pass, test.pass, verification)
+		}
+	}
+
+	// Checks of the same command share its output, and each is reported.
+	verification, err := dial(t, server).Verify(
+		device.Check{Command: "show interfaces status", Contains: "Gi1/0/1"},
+		device.Check{Command: "show vlan brief", Contains: "users"},
+		device.Check{Command: "show interfaces status", Contains: "Gi1/0/9"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := verification.String(), "PASS show interfaces status\nPASS show vlan brief\n"+
+		"FAIL show interfaces status: output does not contain \"Gi1/0/9\"\n"; got != want {
+		t.Errorf("Verify reported\n%s\nwant\n%s", got, want)
+	}
+
+	// Without checks, there is nothing to run.
+	before := len(server.Received())
+	if verification, err := dial(t, server).Verify(); err != nil || !verification.Passed() {
+		t.Errorf("Verify() = %v, %v, want passed", verification, err)
+	}
+	if received := server.Received(); len(received) != before {
+		t.Errorf("Verify() sent %q", received[before:])
+	}
+}
+
+func TestDevice_Ping(t *testing.T) {
+	var mu sync.Mutex
+	frozen := false
+	thaw := make(chan struct{})
+	server := devicetest.NewUnstartedServer(nil)
+	server.Handlers = map[string]func(io.Writer){
+		// "freeze" hangs the shell that runs it at its next empty line.
+		"freeze": func(io.Writer) {
+			mu.Lock()
+			frozen = true
+			mu.Unlock()
+		},
+		"": func(io.Writer) {
+			mu.Lock()
+			hang := frozen
+			frozen = false
+			mu.Unlock()
+			if hang {
+				<-thaw
+			}
+		},
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(thaw) })
+
+	netdev := dial(t, server, device.WithCommandTimeout(200*time.Millisecond))
+	if err := netdev.Ping(); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	// A persistent session that hangs fails Ping, even though the
+	// connection still answers keepalives, and is replaced by the next Run.
+	netdev.Persistent = true
+	if err := netdev.Ping(); err != nil {
+		t.Errorf("Ping without a persistent session: %v", err)
+	}
+	if _, err := netdev.Run("freeze"); err != nil {
+		t.Fatal(err)
+	}
+	if err := netdev.Ping(); errors.Cause(err) != device.TimeoutError {
+		t.Errorf("Ping of a hung persistent session returned %v, want %v", err, device.TimeoutError)
+	}
+	if _, err := netdev.Run("show version"); err != nil {
+		t.Errorf("Run after a failed Ping: %v", err)
+	}
+	if err := netdev.Ping(); err != nil {
+		t.Errorf("Ping of the new persistent session: %v", err)
+	}
+
+	netdev.Close()
+	if err := netdev.Ping(); err == nil {
+		t.Error("Ping succeeded after Close")
+	}
+}
+
+func TestDevice_idleReconnect(t *testing.T) {
+	server := devicetest.NewServer(map[string]string{"show version": "Version 15.2\n"})
+	t.Cleanup(server.Close)
+	netdev := dial(t, server)
+	netdev.IdleTimeout = 50 * time.Millisecond
+	netdev.KeepAlive = 10 * time.Millisecond
+
+	for round := 0; round < 2; round++ {
+		before := netdev.Client
+		if _, err := netdev.Run("show version", "exit"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(150 * time.Millisecond)
+
+		// The first calls after idling reconnect while the others wait,
+		// whichever kind of call they are.
+		var wg sync.WaitGroup
+		errs := make(chan error, 12)
+		for i := 0; i < 4; i++ {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				_, err := netdev.Run("show version", "exit")
+				errs <- err
+			}()
+			go func() {
+				defer wg.Done()
+				errs <- netdev.Ping()
+			}()
+			go func() {
+				defer wg.Done()
+				_, err := netdev.MeasureRTT(3)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("round %d: call after idling: %v", round, err)
+			}
+		}
+		if netdev.Client == before {
+			t.Errorf("round %d: the device did not reconnect after idling", round)
+		}
+	}
+}
+
+func TestDevice_TrimEcho(t *testing.T) {
+	commands := map[string]string{
+		"show processes cpu": "CPU utilization for five seconds: 3%/0%\n",
+		"write memory":       "Building configuration...\nTotal: [OK]\n",
+	}
+	for _, test := range []struct {
+		name string
+		opts []device.DeviceOption
+	}{
+		{"driver", []device.DeviceOption{device.WithMetadata(device.Metadata{Platform: "ios"})}},
+		{"prompt", []device.DeviceOption{device.WithPrompt(regexp.MustCompile(`^sw1#$`))}},
+		{"no prompt", nil},
+	} {
+		server := devicetest.NewUnstartedServer(commands)
+		server.Prompt = "sw1#"
+		server.Start()
+		t.Cleanup(server.Close)
+		netdev := dial(t, server, test.opts...)
+		netdev.TrimEcho = true
+		netdev.Persistent = true
+
+		// The prompt left after the last command is trimmed, but output
+		// that only looks like a prompt is kept.
+		for cmd, want := range commands {
+			result, err := netdev.Run(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(result.Output); got != want {
+				t.Errorf("%s: Run(%q) output = %q, want %q", test.name, cmd, got, want)
+			}
+			if got := string(result.Commands[0].Output); got != want {
+				t.Errorf("%s: Run(%q) command output = %q, want %q", test.name, cmd, got, want)
+			}
+		}
+	}
+}
+
+func TestDevice_Busy(t *testing.T) {
+	const allBusy = "% All lines are busy"
+	for _, test := range []struct {
+		name    string
+		banner  string
+		message string // printed by the shells that end at once
+		ended   int    // how many shells end at once
+		retries int
+		err     bool // whether Run fails
+		busy    bool // with a BusyError
+	}{
+		{"free", "", allBusy, 0, 0, false, false},
+		{"busy", "", allBusy, 1, 0, true, true},
+		{"retried", "", allBusy, 2, 2, false, false},
+		{"retries exhausted", "", allBusy, 3, 2, true, true},
+		{"banner", "Maximum sessions per user: 2\nSession limit: 30 minutes\n", "% Access denied", 1, 2, true, false},
+	} {
+		server := devicetest.NewUnstartedServer(map[string]string{"show version": "Version 15.2\n"})
+		server.Banner = test.banner
+		server.Busy = test.message + "\n"
+		server.BusyShells = test.ended
+		server.Start()
+		t.Cleanup(server.Close)
+		netdev := dial(t, server)
+		netdev.AutoPage = true
+		netdev.Busy = device.BusyRetry{Retries: test.retries, Delay: 20 * time.Millisecond}
+
+		start := time.Now()
+		_, err := netdev.Run("show version", "exit")
+		elapsed := time.Since(start)
+		busy, isBusy := errors.Cause(err).(*device.BusyError)
+		if (err != nil) != test.err || isBusy != test.busy {
+			t.Errorf("%s: Run returned %v", test.name, err)
+			continue
+		}
+		if isBusy && busy.Message != allBusy {
+			t.Errorf("%s: BusyError message %q, want %q", test.name, busy.Message, allBusy)
+		}
+		// Only busy shells are retried, each retry waiting twice as long as
+		// the one before.
+		retried := 0
+		if test.message == allBusy {
+			retried = test.ended
+			if retried > test.retries {
+				retried = test.retries
+			}
+		}
+		backoff := 20 * time.Millisecond * time.Duration(1<<uint(retried)-1)
+		if elapsed < backoff || (retried == 0 && elapsed >= 20*time.Millisecond) {
+			t.Errorf("%s: Run took %v, want %v of backoff", test.name, elapsed, backoff)
+		}
+	}
+}
+
+func TestDevice_lock(t *testing.T) {
+	server := devicetest.NewUnstartedServer(nil)
+	server.Modes = map[string]string{"configure terminal": "device(config)#"}
+	server.Leave = []string{"end"}
+	server.Start()
+	t.Cleanup(server.Close)
+	ios, err := drivers.Lookup("ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker := device.NewMemoryLocker()
+	job := func(persistent bool) *device.Device {
+		netdev := dial(t, server, device.WithDriver(ios))
+		netdev.Locker = locker
+		netdev.LockTimeout = 50 * time.Millisecond
+		netdev.Persistent = persistent
+		return netdev
+	}
+	change := []string{"configure terminal", "hostname core1", "end", "exit"}
+
+	// A persistent session holds the lock while it is in configuration mode.
+	first, second := job(true), job(false)
+	if _, err := first.Run("configure terminal"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Run(change...); err == nil {
+		t.Error("Run got the lock held by a persistent session in configuration mode")
+	}
+	if _, err := first.Run("hostname core1", "end"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Run(change...); err != nil {
+		t.Errorf("Run after the persistent session left configuration mode: %v", err)
+	}
+
+	// Ending the session releases the lock too.
+	if _, err := first.Run("configure terminal"); err != nil {
+		t.Fatal(err)
+	}
+	first.CloseSession()
+	if _, err := second.Run(change...); err != nil {
+		t.Errorf("Run after CloseSession: %v", err)
+	}
+
+	// A stale lock makes Run give up after LockTimeout.
+	dir := t.TempDir()
+	stale := &device.FileLocker{Dir: dir, Interval: 10 * time.Millisecond}
+	if err := stale.Lock(context.Background(), second.String()); err != nil {
+		t.Fatal(err)
+	}
+	second.Locker = stale
+	start := time.Now()
+	if _, err := second.Run(change...); errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("Run with a stale lock returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run with a stale lock took %v", elapsed)
+	}
+}
+
+func TestDevice_lockCommands(t *testing.T) {
+	server := devicetest.NewServer(nil)
+	t.Cleanup(server.Close)
+	for _, test := range []struct {
+		platform string
+		cmd      string
+		locks    bool
+	}{
+		{"ios", "configure terminal", true},
+		{"ios", "config t", true},
+		{"ios", "configure session s1", true},
+		{"ios", "show configuration", false},
+		{"junos", "configure exclusive", true},
+		{"junos", "configure private", true},
+		{"", "configure session s1", true},
+		{"", "conf t", true},
+		{"", "show running-config", false},
+		{"exos", "configure vlan v1 add ports 1", true},
+	} {
+		netdev := dial(t, server, device.WithMetadata(device.Metadata{Platform: test.platform}))
+		locker := device.NewMemoryLocker()
+		if err := locker.Lock(context.Background(), netdev.String()); err != nil {
+			t.Fatal(err)
+		}
+		netdev.Locker = locker
+		netdev.LockTimeout = 20 * time.Millisecond
+		_, err := netdev.Run(test.cmd, "exit")
+		if locked := errors.Cause(err) == context.DeadlineExceeded; locked != test.locks {
+			t.Errorf("%s %q: Run returned %v, want locking %v", test.platform, test.cmd, err, test.locks)
+		}
+	}
+}
+
+func TestDevice_persistentHelpers(t *testing.T) {
+	server := iosServer(t, "show version", "Version 15.2\n", "Version 15.2\n", nil, "hostname sw2")
+	netdev := dial(t, server, device.WithMetadata(device.Metadata{Platform: "ios"}))
+	netdev.Persistent = true
+	netdev.MaxSessions = 1
+	netdev.CommandTimeout = 2 * time.Second
+
+	// Helpers share the persistent session instead of ending it.
+	if _, err := netdev.Configure("hostname sw2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netdev.Run("configure terminal"); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := netdev.Snapshot("show version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snap.Output["show version"]; got != "Version 15.2\n" {
+		t.Errorf("Snapshot output = %q", got)
+	}
+	if !netdev.InConfigMode() {
+		t.Error("Snapshot left configuration mode")
+	}
+	received := server.Received()
+	if strings.Count(strings.Join(received, "\n"), "terminal length 0") != 1 || contains(received, "exit") {
+		t.Errorf("device received %q, want one session without exit", received)
+	}
+
+	// The session's MaxSessions slot is released when it ends.
+	netdev.CloseSession()
+	if _, err := netdev.Snapshot("show version"); err != nil {
+		t.Errorf("Snapshot after CloseSession: %v", err)
+	}
+}
+
+// contains reports whether cmds holds cmd.
+func contains(cmds []string, cmd string) bool {
+	for _, c := range cmds {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDangerousCommands(t *testing.T) {
+	policy := &device.Policy{Deny: device.DangerousCommands}
+	for _, cmd := range []string{
+		"reload",
+		"reload in 5",
+		"reboot",
+		"write erase",
+		"erase startup-config",
+		"format flash:",
+		"delete flash:vlan.dat",
+		"delete /force /recursive bootflash:old",
+		"delete nvram:startup-config",
+		"delete config://startup.xml",
+		"delete",
+		"delete system image 1.3.4",
+		"file delete /var/tmp/jinstall.tgz",
+		"request system reboot",
+		"request system zeroize",
+		"load factory-default",
+	} {
+		if err := policy.Check(nil, cmd); err == nil {
+			t.Errorf("DangerousCommands allow %q", cmd)
+		}
+	}
+	for _, cmd := range []string{
+		"show reload",
+		"show flash:",
+		"dir flash:",
+		"delete interfaces ge-0/0/0 disable",
+		"delete interfaces xe-0/0/0:1 unit 0",
+		"delete vlans users",
+		"delete vlan 10",
+		"delete system login user admin",
+		"delete account admin",
+	} {
+		if err := policy.Check(nil, cmd); err != nil {
+			t.Errorf("DangerousCommands deny %q: %v", cmd, err)
+		}
+	}
+
+	// The changes drivers generate are made in configuration mode and must
+	// not be mistaken for destructive commands.
+	for _, name := range drivers.Names() {
+		driver, err := drivers.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var changes []drivers.Change
+		if c, ok := driver.(drivers.VLANConfigurer); ok {
+			changes = append(changes, c.DeleteVLAN(10, "users"))
+		}
+		if c, ok := driver.(drivers.UserConfigurer); ok {
+			changes = append(changes, c.RemoveUser("admin"))
+		}
+		if c, ok := driver.(drivers.InterfaceConfigurer); ok {
+			changes = append(changes, c.InterfaceShutdown("ge-0/0/0", false), c.InterfaceShutdown("ge-0/0/0", true))
+		}
+		for _, change := range changes {
+			for _, cmd := range change.Commands {
+				if err := policy.Check(nil, cmd); err != nil {
+					t.Errorf("%s: DangerousCommands deny %q: %v", name, cmd, err)
+				}
+			}
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	server := devicetest.NewUnstartedServer(nil)
+	server.Prompt = "device>"
+	server.Modes = map[string]string{"enable": "Password: ", "s3cret": "device#"}
+	server.Leave = []string{"end"}
+	server.Start()
+	t.Cleanup(server.Close)
+	driver, err := drivers.Lookup("ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delay := range []time.Duration{0, time.Microsecond} {
+		var recording strings.Builder
+		recorder, err := device.NewRecorder(&recording, 80, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		netdev := dial(t, server, device.WithDriver(driver), device.WithEnable("s3cret"))
+		netdev.Recorder = recorder
+		netdev.CharDelay = delay
+		if _, err := netdev.Run("username admin secret 0 hunter2", "end", "exit"); err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Err(); err != nil {
+			t.Fatal(err)
+		}
+		// The fake device echoes even passwords, so look only at input.
+		var input strings.Builder
+		for _, line := range strings.Split(recording.String(), "\n")[1:] {
+			var event []interface{}
+			if line != "" && json.Unmarshal([]byte(line), &event) == nil && event[1] == "i" {
+				input.WriteString(event[2].(string))
+			}
+		}
+		if got, want := input.String(), "enable\nterminal length 0\nterminal width 511\n"+
+			"username admin secret 0 <redacted>\nend\nexit\n"; got != want {
+			t.Errorf("CharDelay %v: recorded input %q, want %q", delay, got, want)
+		}
+	}
+}
+
+func TestDevice_Console(t *testing.T) {
+	server := devicetest.NewUnstartedServer(map[string]string{"dir": "autoexec.bat\n"})
+	server.Prompt = "Username: "
+	server.Modes = map[string]string{
+		"admin":          "Password: ",
+		"s3cret":         "console>",
+		"connect port 5": "Select line [1-2]: ",
+		"1":              `C:\Users\admin>`,
+	}
+	server.Leave = []string{"logout"}
+	server.Start()
+	t.Cleanup(server.Close)
+	driver, err := drivers.Lookup("windows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recording strings.Builder
+	recorder, err := device.NewRecorder(&recording, 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	netdev := dial(t, server, device.WithDriver(driver))
+	netdev.Recorder = recorder
+	netdev.Console = &device.ConsoleHop{
+		Command: "connect port 5",
+		Prompt:  regexp.MustCompile(`^console>$`),
+		Login: []drivers.Step{
+			{Expect: regexp.MustCompile(`Username: ?$`), Send: "admin\r\n"},
+			{Expect: regexp.MustCompile(`Password: ?$`), Send: "s3cret\r\n"},
+		},
+		Steps: []drivers.Step{{Expect: regexp.MustCompile(`Select line \[1-2\]: ?$`), Send: "1\r\n"}},
+	}
+	result, err := netdev.Run("dir", "logout", "exit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(result.Output, []byte("autoexec.bat")) {
+		t.Errorf("output %q, want the device's output", result.Output)
+	}
+	want := []string{"admin", "s3cret", "connect port 5", "1", "dir", "logout", "exit"}
+	if got := server.Received(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	// The fake server echoes even passwords, so look only at input.
+	var input strings.Builder
+	for _, line := range strings.Split(recording.String(), "\n")[1:] {
+		var event []interface{}
+		if line != "" && json.Unmarshal([]byte(line), &event) == nil && event[1] == "i" {
+			input.WriteString(event[2].(string))
+		}
+	}
+	if got, want := input.String(), "connect port 5\r\ndir\r\nlogout\r\nexit\r\n"; got != want {
+		t.Errorf("recorded input %q, want %q", got, want)
+	}
+}
+
+func TestDevice_History(t *testing.T) {
+	server := devicetest.NewServer(map[string]string{
+		"show version": "Version 15.2\n",
+		"show clock":   "12:00:00.000 UTC Mon Mar 1 2021\n",
+	})
+	t.Cleanup(server.Close)
+	netdev := dial(t, server)
+	netdev.HistorySize = 3
+	netdev.HistoryOutput = 8
+	if _, err := netdev.Run("show version", "show clock", "exit"); err != nil {
+		t.Fatal(err)
+	}
+	netdev.Policy = &device.Policy{Deny: []*regexp.Regexp{regexp.MustCompile(`^username`)}}
+	if _, err := netdev.Run("username admin secret 0 hunter2"); err == nil {
+		t.Fatal("Run succeeded despite the policy")
+	}
+
+	history := netdev.History()
+	for i, want := range []struct {
+		command   string
+		output    string
+		truncated bool
+		failed    bool
+	}{
+		{"show clock", "12:00:00", true, false},
+		{"exit", "", false, false},
+		{"username admin secret 0 <redacted>", "", false, true},
+	} {
+		if i >= len(history) {
+			t.Fatalf("History() has %d entries, want 3", len(history))
+		}
+		entry := history[i]
+		if entry.Command != want.command || string(entry.Output) != want.output ||
+			entry.Truncated != want.truncated || (entry.Err != nil) != want.failed {
+			t.Errorf("History()[%d] = %q %q truncated %v err %v, want %q %q truncated %v failed %v", i,
+				entry.Command, entry.Output, entry.Truncated, entry.Err,
+				want.command, want.output, want.truncated, want.failed)
+		}
+	}
+}
+
+func TestAuditLog_redaction(t *testing.T) {
+	server := devicetest.NewServer(nil)
+	t.Cleanup(server.Close)
+	netdev := dial(t, server)
+	netdev.Policy = &device.Policy{Deny: []*regexp.Regexp{regexp.MustCompile(``)}}
+	for _, name := range drivers.Names() {
+		driver, err := drivers.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users, ok := driver.(drivers.UserConfigurer)
+		if !ok {
+			continue
+		}
+		change := users.CreateUser(drivers.LocalUser{Name: "bob", Password: "hunter2", Role: "admin"})
+		if len(change.Commands) == 0 {
+			continue
+		}
+		var log bytes.Buffer
+		netdev.Driver = driver
+		netdev.AuditLog = device.NewAuditLog(&log)
+		netdev.Run(change.Commands...)
+		if strings.Contains(log.String(), "hunter2") {
+			t.Errorf("%s: audit log holds the password of %q:\n%s", name, change.Commands, &log)
+		}
+		for _, entry := range netdev.History() {
+			if strings.Contains(entry.Command, "hunter2") {
+				t.Errorf("%s: history holds the password of %q", name, entry.Command)
+			}
+		}
+	}
+}
+
+func TestDial_platformAlgorithms(t *testing.T) {
+	server := devicetest.NewUnstartedServer(nil)
+	server.Ciphers = []string{"aes128-cbc"} // as on older IOS releases
+	server.Start()
+	t.Cleanup(server.Close)
+	ios, err := drivers.Lookup("ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		opts []device.DeviceOption
+		ok   bool
+	}{
+		{"no platform", nil, false},
+		{"platform", []device.DeviceOption{device.WithMetadata(device.Metadata{Platform: "ios"})}, true},
+		{"driver", []device.DeviceOption{device.WithDriver(ios)}, true},
+		{"unknown platform", []device.DeviceOption{device.WithMetadata(device.Metadata{Platform: "bogus"})}, false},
+		{"explicit option wins", []device.DeviceOption{device.StrictCrypto(), device.WithDriver(ios)}, false},
+	} {
+		netdev, err := device.Dial(server.Addr, "user", append(test.opts, device.Password("password"))...)
+		if err == nil {
+			netdev.Close()
+		}
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: Dial returned %v", test.name, err)
+		}
+		config, err := device.NewClientConfig("user", device.Password("password"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		netdev, err = device.DialConfig(server.Addr, config, test.opts...)
+		if err == nil {
+			netdev.Close()
+		}
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: DialConfig returned %v", test.name, err)
+		}
+	}
+}
+
+func TestDevice_ReloadAndWait(t *testing.T) {
+	ios, err := drivers.Lookup("ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic, err := drivers.Lookup("generic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name       string
+		driver     drivers.Driver
+		disconnect []string
+		policy     *device.Policy
+		persistent bool // answer a confirmation prompt in stepwise mode
+		check      func(err error) bool
+	}{
+		{"reloaded", ios, []string{"reload"}, nil, false, func(err error) bool { return err == nil }},
+		{"confirmed", ios, []string{""}, nil, true, func(err error) bool { return err == nil }},
+		{"refused", ios, nil, nil, false, func(err error) bool {
+			_, ok := errors.Cause(err).(*device.RejectedError)
+			return ok
+		}},
+		{"denied", ios, []string{"reload"}, &device.Policy{Deny: device.DangerousCommands}, false, func(err error) bool {
+			_, ok := errors.Cause(err).(*device.PolicyError)
+			return ok
+		}},
+		{"unsupported", generic, []string{"reload"}, nil, false, func(err error) bool { return err != nil }},
+	} {
+		server := devicetest.NewUnstartedServer(map[string]string{"show version": "Version 15.2\n"})
+		server.Disconnect = test.disconnect
+		if test.persistent {
+			server.Modes = map[string]string{"reload": "Proceed with reload? [confirm]"}
+		}
+		server.Start()
+		t.Cleanup(server.Close)
+		netdev := dial(t, server, device.WithDriver(test.driver))
+		netdev.Policy = test.policy
+		netdev.Persistent = test.persistent
+		netdev.AutoPage = test.persistent
+		start := time.Now()
+		err := netdev.ReloadAndWait(10 * time.Second)
+		if !test.check(err) {
+			t.Errorf("%s: ReloadAndWait returned %v", test.name, err)
+			continue
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: ReloadAndWait took %v", test.name, elapsed)
+		}
+		// Whether or not the device reloaded, the Device is usable.
+		if _, err := netdev.Run("show version", "exit"); err != nil {
+			t.Errorf("%s: Run after ReloadAndWait: %v", test.name, err)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	server := devicetest.NewUnstartedServer(map[string]string{"show version": "Version 15.2\n"})
+	server.Password = "password"
+	server.Start()
+	t.Cleanup(server.Close)
+	good, err := device.NewClientConfig("user", device.Password("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := device.NewClientConfig("user", device.Password("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaker := &device.Breaker{Failures: 2}
+	dialer := &device.Dialer{Breaker: breaker}
+
+	// Handshakes dropped before authentication, as by an sshd that is
+	// still starting, do not count.
+	starting := dropping(t, server.Addr, 5)
+	for i := 0; i < 3; i++ {
+		if _, err := dialer.Dial(starting, good); err == nil {
+			t.Fatal("Dial through a dropping listener succeeded")
+		} else if _, ok := errors.Cause(err).(*device.BreakerOpenError); ok {
+			t.Fatalf("Dial %d: breaker opened for dropped handshakes: %v", i, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := dialer.Dial(server.Addr, bad)
+		if _, ok := errors.Cause(err).(*device.AuthError); !ok {
+			t.Fatalf("Dial %d with a wrong password returned %v", i, err)
+		}
+	}
+	if _, err := dialer.Dial(server.Addr, good); err == nil {
+		t.Fatal("Dial succeeded with the breaker open")
+	} else if _, ok := errors.Cause(err).(*device.BreakerOpenError); !ok {
+		t.Fatalf("Dial with the breaker open returned %v", err)
+	}
+	if tripped := breaker.Tripped(); len(tripped) != 1 || tripped[0].Addr != server.Addr {
+		t.Errorf("Tripped() = %v", tripped)
+	}
+
+	breaker.Reset(server.Addr)
+	netdev, err := dialer.Dial(server.Addr, good)
+	if err != nil {
+		t.Fatalf("Dial after Reset: %v", err)
+	}
+	netdev.Close()
+	if tripped := breaker.Tripped(); len(tripped) != 0 {
+		t.Errorf("Tripped() after Reset = %v", tripped)
+	}
+}
+
+func TestDialer_WaitForSSH(t *testing.T) {
+	server := devicetest.NewUnstartedServer(map[string]string{"show version": "Version 15.2\n"})
+	server.Password = "password"
+	server.Start()
+	t.Cleanup(server.Close)
+	good, err := device.NewClientConfig("user", device.Password("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := device.NewClientConfig("user", device.Password("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// More dropped handshakes than the breaker allows failures are waited
+	// out.
+	dialer := &device.Dialer{Breaker: &device.Breaker{Failures: 2}}
+	netdev, err := dialer.WaitForSSH(ctx, dropping(t, server.Addr, 4), good, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitForSSH returned %v", err)
+	}
+	if _, err := netdev.Run("show version", "exit"); err != nil {
+		t.Errorf("Run after WaitForSSH: %v", err)
+	}
+	netdev.Close()
+
+	// Refused credentials open the breaker, which stops the wait.
+	start := time.Now()
+	_, err = dialer.WaitForSSH(ctx, server.Addr, bad, 10*time.Millisecond)
+	if _, ok := err.(*device.BreakerOpenError); !ok {
+		t.Errorf("WaitForSSH with a wrong password returned %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("WaitForSSH took %v", elapsed)
+	}
+}
+
+// dropping returns the address of a listener that closes the first drops
+// connections at once, like an sshd that is still starting, and forwards the
+// rest to addr.
+func dropping(t *testing.T, addr string, drops int) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for accepted := 0; ; accepted++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if accepted < drops {
+				conn.Close()
+				continue
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				go func() {
+					io.Copy(upstream, conn)
+					upstream.Close()
+				}()
+				io.Copy(conn, upstream)
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDevice_Authorizer(t *testing.T) {
+	errDenied := errors.New("denied by change window")
+	server := devicetest.NewServer(map[string]string{"show version": "Version 15.2\n"})
+	t.Cleanup(server.Close)
+	netdev := dial(t, server)
+	netdev.Operator = "alice"
+	netdev.Authorizer = device.AuthorizerFunc(func(d *device.Device, user, cmd string) error {
+		if strings.HasPrefix(cmd, "configure") {
+			return errDenied
+		}
+		return nil
+	})
+	if _, err := netdev.Run("show version", "exit"); err != nil {
+		t.Errorf("Run(show version) = %v", err)
+	}
+	_, err := netdev.Run("configure terminal", "exit")
+	var authErr *device.AuthorizationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("Run(configure terminal) = %v, want an AuthorizationError", err)
+	}
+	if authErr.User != "alice" || authErr.Command != "configure terminal" {
+		t.Errorf("AuthorizationError = %+v", authErr)
+	}
+	if !errors.Is(err, errDenied) || errors.Cause(err) != errDenied {
+		t.Errorf("Run(configure terminal) = %v, want it to wrap %v", err, errDenied)
+	}
+}
+
+func TestDevice_Configure(t *testing.T) {
+	ios, err := drivers.Lookup("ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	junos, err := drivers.Lookup("junos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name   string
+		driver drivers.Driver
+		prompt string
+		modes  map[string]string
+		leave  string
+		label  string
+		cmds   []string
+		want   []string // commands the device receives
+	}{
+		{
+			name: "ios", driver: ios, prompt: "sw1#",
+			modes: map[string]string{"configure terminal": "sw1(config)#"}, leave: "end",
+			cmds: []string{"hostname sw2"},
+			want: []string{"terminal length 0", "terminal width 511", "configure terminal", "hostname sw2", "end", "write memory", "exit"},
+		},
+		{
+			name: "junos", driver: junos, prompt: "user@r1>",
+			modes: map[string]string{"configure": "user@r1#"}, leave: "exit configuration-mode",
+			cmds: []string{"set system host-name r2"},
+			want: []string{"set cli screen-length 0", "set cli screen-width 0", "configure", "set system host-name r2", "commit", "exit configuration-mode", "exit"},
+		},
+		{
+			name: "junos labeled", driver: junos, prompt: "user@r1>",
+			modes: map[string]string{"configure": "user@r1#"}, leave: "exit configuration-mode",
+			label: "CHG 1", cmds: []string{"set system host-name r2"},
+			want: []string{"set cli screen-length 0", "set cli screen-width 0", "configure", "set system host-name r2", `commit comment "CHG 1"`, "exit configuration-mode", "exit"},
+		},
+		{
+			name: "no driver", prompt: "device#",
+			cmds: []string{"hostname sw2"},
+			want: []string{"hostname sw2", "exit"},
+		},
+	} {
+		commands := make(map[string]string)
+		for _, cmd := range test.want {
+			commands[cmd] = ""
+		}
+		server := devicetest.NewUnstartedServer(commands)
+		server.Prompt = test.prompt
+		server.Modes = test.modes
+		server.Leave = []string{test.leave}
+		server.Start()
+		t.Cleanup(server.Close)
+		var opts []device.DeviceOption
+		if test.driver != nil {
+			opts = append(opts, device.WithDriver(test.driver))
+		}
+		netdev := dial(t, server, opts...)
+		if test.label != "" {
+			_, err = netdev.ConfigureLabeled(test.label, test.cmds...)
+		} else {
+			_, err = netdev.Configure(test.cmds...)
+		}
+		if err != nil {
+			t.Errorf("%s: Configure returned %v", test.name, err)
+			continue
+		}
+		if got := server.Received(); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: device received %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// IOS has no way to label commits.
+	server := devicetest.NewServer(nil)
+	t.Cleanup(server.Close)
+	if _, err := dial(t, server, device.WithDriver(ios)).ConfigureLabeled("CHG 1", "hostname sw2"); err == nil {
+		t.Error("ConfigureLabeled on IOS returned no error")
+	}
+}
+
+// iosServer returns a server that answers like an IOS switch. It accepts
+// cmds in configuration mode and answers show with before until it has left
+// configuration mode once, and with after from then on.
+func iosServer(t *testing.T, show, before, after string, modes map[string]string, cmds ...string) *devicetest.Server {
+	t.Helper()
+	commands := map[string]string{"terminal length 0": "", "terminal width 511": "", "write memory": "[OK]\n"}
+	for _, cmd := range cmds {
+		commands[cmd] = ""
+	}
+	server := devicetest.NewUnstartedServer(commands)
+	server.Prompt = "sw1#"
+	server.Modes = map[string]string{"configure terminal": "sw1(config)#"}
+	for cmd, prompt := range modes {
+		server.Modes[cmd] = prompt
+	}
+	server.Leave = []string{"end"}
+	server.Handlers = map[string]func(io.Writer){
+		show: func(w io.Writer) {
+			output := before
+			for _, cmd := range server.Received() {
+				if cmd == "end" {
+					output = after
+				}
+			}
+			io.WriteString(w, strings.Replace(output, "\n", "\r\n", -1))
+		},
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCommitGroup(t *testing.T) {
+	const stage = "configure terminal revert timer 1"
+	for _, test := range []struct {
+		name    string
+		unknown []string // commands the second device rejects
+		phase   string   // of the GroupCommitError, if any
+		aborted bool     // whether the first device was rolled back
+	}{
+		{"committed", nil, "", false},
+		{"stage failed", []string{"hostname sw2"}, "stage", true},
+		{"finalize failed", []string{"configure confirm"}, "finalize", false},
+	} {
+		var servers []*devicetest.Server
+		var changes []device.GroupChange
+		for i := 0; i < 2; i++ {
+			cmds := []string{"hostname sw2", "configure confirm", "configure revert now"}
+			if i == 1 {
+				cmds = remove(cmds, test.unknown...)
+			}
+			server := iosServer(t, "show version", "", "", map[string]string{stage: "sw1(config)#"}, cmds...)
+			servers = append(servers, server)
+			netdev := dial(t, server, device.WithMetadata(device.Metadata{Platform: "ios"}))
+			changes = append(changes, device.GroupChange{Device: netdev, Commands: []string{"hostname sw2"}})
+		}
+		err := device.CommitGroup(changes, time.Minute)
+		if test.phase == "" {
+			if err != nil {
+				t.Errorf("%s: CommitGroup returned %v", test.name, err)
+			}
+		} else if groupErr, ok := err.(*device.GroupCommitError); !ok || groupErr.Phase != test.phase {
+			t.Errorf("%s: CommitGroup returned %v, want a %s error", test.name, err, test.phase)
+		} else if _, failed := groupErr.Errs[changes[1].Device.String()]; !failed || len(groupErr.Errs) != 1 {
+			t.Errorf("%s: CommitGroup failed on %v, want only the second device", test.name, groupErr.Errs)
+		}
+		first := servers[0].Received()
+		if aborted := contains(first, "configure revert now"); aborted != test.aborted {
+			t.Errorf("%s: first device received %q", test.name, first)
+		}
+		if finalized := contains(first, "configure confirm"); finalized == test.aborted {
+			t.Errorf("%s: first device received %q", test.name, first)
+		}
+	}
+}
+
+// remove returns cmds without those in drop.
+func remove(cmds []string, drop ...string) []string {
+	var kept []string
+	for _, cmd := range cmds {
+		if !contains(drop, cmd) {
+			kept = append(kept, cmd)
+		}
+	}
+	return kept
+}
+
+// configured returns the commands server received in configuration mode.
+func configured(server *devicetest.Server) []string {
+	var cmds []string
+	inConfig := false
+	for _, cmd := range server.Received() {
+		switch {
+		case cmd == "configure terminal":
+			inConfig = true
+		case cmd == "end":
+			inConfig = false
+		case inConfig:
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+func TestDevice_configHelpers(t *testing.T) {
+	const (
+		showVLANs  = "show vlan brief"
+		vlan1      = "1    default                          active    Gi0/1\n"
+		vlan10     = "10   users                            active    \n"
+		showUsers  = "show running-config | include ^username"
+		admin      = "username admin privilege 15 secret 9 $9$nhEmQVczB7dqsO\n"
+		bob        = "username bob privilege 1 secret 9 $9$X.HsgL6x1il0Rx\n"
+		showNTP    = "show running-config | include ^ntp server"
+		ntp1       = "ntp server 10.0.0.1\n"
+		ntp2       = "ntp server 10.0.0.2\n"
+		showBanner = "show banner motd"
+		showGi01   = "show running-config interface Gi0/1"
+		showRun    = "show running-config"
+		running    = "Building configuration...\n\nhostname sw1\n!\ninterface GigabitEthernet0/1\n description uplink\n!\nend\n"
+		intended   = "interface GigabitEthernet0/1\n description uplink\n shutdown\nntp server 10.0.0.1\n"
+	)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyData := strings.Fields(string(ssh.MarshalAuthorizedKey(pub)))[1]
+	keyCommands := []string{"ip ssh pubkey-chain", "username bob", "key-string"}
+	for ; len(keyData) > 72; keyData = keyData[72:] {
+		keyCommands = append(keyCommands, keyData[:72])
+	}
+	keyCommands = append(keyCommands, keyData, "exit", "exit", "exit")
+	keyModes := map[string]string{
+		"ip ssh pubkey-chain": "sw1(conf-ssh-pubkey)#",
+		"username bob":        "sw1(conf-ssh-pubkey-user)#",
+		"key-string":          "sw1(conf-ssh-pubkey-data)#",
+	}
+
+	ok := func(err error) bool { return err == nil }
+	fails := func(err error) bool { return err != nil }
+	unverified := func(err error) bool {
+		_, ok := errors.Cause(err).(*device.VerifyError)
+		return ok
+	}
+	rejected := func(err error) bool {
+		_, ok := errors.Cause(err).(*device.RejectedError)
+		return ok
+	}
+	for _, test := range []struct {
+		name          string
+		show          string
+		before, after string
+		modes         map[string]string
+		config        []string // commands sent in configuration mode
+		reject        string   // one of config that the device rejects
+		do            func(d *device.Device) error
+		check         func(err error) bool
+	}{
+		{
+			name: "VLANs", show: showVLANs, before: vlan1 + vlan10,
+			do: func(d *device.Device) error {
+				vlans, err := d.VLANs()
+				if err == nil && (len(vlans) != 2 || vlans[1] != drivers.VLAN{ID: 10, Name: "users"}) {
+					err = errors.Errorf("VLANs = %v", vlans)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "CreateVLAN", show: showVLANs, before: vlan1, after: vlan1 + vlan10,
+			config: []string{"vlan 10", "name users"},
+			do:     func(d *device.Device) error { return d.CreateVLAN(10, "users") },
+			check:  ok,
+		},
+		{
+			name: "CreateVLAN default name", show: showVLANs, before: vlan1,
+			after:  vlan1 + "20   VLAN0020                         active    \n",
+			config: []string{"vlan 20", "name VLAN0020"},
+			do:     func(d *device.Device) error { return d.CreateVLAN(20, "") },
+			check:  ok,
+		},
+		{
+			name: "CreateVLAN not listed", show: showVLANs, before: vlan1, after: vlan1,
+			config: []string{"vlan 10", "name users"},
+			do:     func(d *device.Device) error { return d.CreateVLAN(10, "users") },
+			check:  fails,
+		},
+		{
+			name: "CreateVLAN rejected", show: showVLANs, before: vlan1, after: vlan1,
+			config: []string{"vlan 4095", "name users"}, reject: "vlan 4095",
+			do:    func(d *device.Device) error { return d.CreateVLAN(4095, "users") },
+			check: rejected,
+		},
+		{
+			name: "DeleteVLAN", show: showVLANs, before: vlan1 + vlan10, after: vlan1,
+			config: []string{"no vlan 10"},
+			do:     func(d *device.Device) error { return d.DeleteVLAN(10) },
+			check:  ok,
+		},
+		{
+			name: "DeleteVLAN missing", show: showVLANs, before: vlan1,
+			do:    func(d *device.Device) error { return d.DeleteVLAN(10) },
+			check: ok,
+		},
+		{
+			name: "DeleteVLAN still listed", show: showVLANs, before: vlan1 + vlan10, after: vlan1 + vlan10,
+			config: []string{"no vlan 10"},
+			do:     func(d *device.Device) error { return d.DeleteVLAN(10) },
+			check:  fails,
+		},
+		{
+			name: "Users", show: showUsers, before: admin + bob,
+			do: func(d *device.Device) error {
+				users, err := d.Users()
+				if err == nil && strings.Join(users, " ") != "admin bob" {
+					err = errors.Errorf("Users = %q", users)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "CreateUser", show: showUsers, before: admin, after: admin + bob,
+			config: []string{"username bob privilege 1 secret s3cret"},
+			do: func(d *device.Device) error {
+				return d.CreateUser(drivers.LocalUser{Name: "bob", Password: "s3cret", Role: "read-only"})
+			},
+			check: ok,
+		},
+		{
+			name: "CreateUser not listed", show: showUsers, before: admin, after: admin,
+			config: []string{"username bob privilege 15 secret s3cret"},
+			do: func(d *device.Device) error {
+				return d.CreateUser(drivers.LocalUser{Name: "bob", Password: "s3cret", Role: "admin"})
+			},
+			check: fails,
+		},
+		{
+			name: "RemoveUser", show: showUsers, before: admin + bob, after: admin,
+			config: []string{"no username bob", ""},
+			do:     func(d *device.Device) error { return d.RemoveUser("bob") },
+			check:  ok,
+		},
+		{
+			name: "RemoveUser missing", show: showUsers, before: admin,
+			do:    func(d *device.Device) error { return d.RemoveUser("bob") },
+			check: ok,
+		},
+		{
+			name: "AddSSHKey", modes: keyModes, config: keyCommands,
+			do:    func(d *device.Device) error { return d.AddSSHKey("bob", pub) },
+			check: ok,
+		},
+		{
+			name: "Banner", show: showBanner, before: "Authorized use only\n",
+			do: func(d *device.Device) error {
+				banner, err := d.Banner("motd")
+				if err == nil && banner != "Authorized use only" {
+					err = errors.Errorf("Banner = %q", banner)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "SetBanner", show: showBanner, after: "Authorized use only\nof sw1\n",
+			config: []string{"banner motd ^", "Authorized use only", "of sw1", "^"},
+			do:     func(d *device.Device) error { return d.SetBanner("motd", "Authorized use only\nof sw1") },
+			check:  ok,
+		},
+		{
+			name: "SetBanner remove", show: showBanner, before: "Authorized use only\n",
+			config: []string{"no banner motd"},
+			do:     func(d *device.Device) error { return d.SetBanner("motd", "") },
+			check:  ok,
+		},
+		{
+			name: "SetBanner not shown", show: showBanner,
+			config: []string{"banner motd ^", "Authorized use only", "^"},
+			do:     func(d *device.Device) error { return d.SetBanner("motd", "Authorized use only") },
+			check:  fails,
+		},
+		{
+			name: "EnsureNTPServers", show: showNTP, before: ntp1, after: ntp1 + ntp2,
+			config: []string{"ntp server 10.0.0.2"},
+			do: func(d *device.Device) error {
+				result, err := d.EnsureNTPServers("10.0.0.1", "10.0.0.2")
+				if err == nil && (!result.Changed || strings.Join(result.Added, " ") != "10.0.0.2") {
+					err = errors.Errorf("EnsureNTPServers = %+v", result)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "EnsureNTPServers unchanged", show: showNTP, before: ntp1 + ntp2,
+			do: func(d *device.Device) error {
+				result, err := d.EnsureNTPServers("10.0.0.2", "10.0.0.1")
+				if err == nil && (result.Changed || result.Added != nil) {
+					err = errors.Errorf("EnsureNTPServers = %+v", result)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "EnsureNTPServers not added", show: showNTP, before: ntp1, after: ntp1,
+			config: []string{"ntp server 10.0.0.2"},
+			do: func(d *device.Device) error {
+				_, err := d.EnsureNTPServers("10.0.0.1", "10.0.0.2")
+				return err
+			},
+			check: unverified,
+		},
+		{
+			name: "EnsureConfig", show: showRun, before: running,
+			after:  "hostname sw1\ninterface GigabitEthernet0/1\n description uplink\n shutdown\nntp server 10.0.0.1\n",
+			config: []string{"interface GigabitEthernet0/1", "shutdown", "ntp server 10.0.0.1"},
+			do: func(d *device.Device) error {
+				result, err := d.EnsureConfig(intended)
+				if err == nil && (!result.Changed || len(result.Added) != 3) {
+					err = errors.Errorf("EnsureConfig = %+v", result)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "EnsureConfig unchanged", show: showRun,
+			before: "hostname sw1\ninterface GigabitEthernet0/1\n shutdown\n description uplink\nntp server 10.0.0.1\n",
+			do: func(d *device.Device) error {
+				result, err := d.EnsureConfig(intended)
+				if err == nil && (result.Changed || result.Added != nil) {
+					err = errors.Errorf("EnsureConfig = %+v", result)
+				}
+				return err
+			},
+			check: ok,
+		},
+		{
+			name: "EnsureConfig not applied", show: showRun, before: running, after: running,
+			config: []string{"interface GigabitEthernet0/1", "shutdown", "ntp server 10.0.0.1"},
+			do: func(d *device.Device) error {
+				_, err := d.EnsureConfig(intended)
+				return err
+			},
+			check: unverified,
+		},
+		{
+			name: "SetInterfaceDescription", show: showGi01,
+			before: "interface Gi0/1\n", after: "interface Gi0/1\n description uplink\n",
+			config: []string{"interface Gi0/1", "description uplink"},
+			do:     func(d *device.Device) error { return d.SetInterfaceDescription("Gi0/1", "uplink") },
+			check:  ok,
+		},
+		{
+			name: "SetInterfaceVLAN", show: showGi01,
+			before: "interface Gi0/1\n", after: "interface Gi0/1\n switchport mode access\n switchport access vlan 10\n",
+			config: []string{"interface Gi0/1", "switchport mode access", "switchport access vlan 10"},
+			do:     func(d *device.Device) error { return d.SetInterfaceVLAN("Gi0/1", 10) },
+			check:  ok,
+		},
+		{
+			name: "ShutInterface not shown", show: showGi01,
+			before: "interface Gi0/1\n", after: "interface Gi0/1\n",
+			config: []string{"interface Gi0/1", "shutdown"},
+			do:     func(d *device.Device) error { return d.ShutInterface("Gi0/1") },
+			check:  unverified,
+		},
+		{
+			name: "NoShutInterface", show: showGi01,
+			before: "interface Gi0/1\n shutdown\n", after: "interface Gi0/1\n",
+			config: []string{"interface Gi0/1", "no shutdown"},
+			do:     func(d *device.Device) error { return d.NoShutInterface("Gi0/1") },
+			check:  ok,
+		},
+	} {
+		var accepted []string
+		for _, cmd := range test.config {
+			if cmd != test.reject {
+				accepted = append(accepted, cmd)
+			}
+		}
+		server := iosServer(t, test.show, test.before, test.after, test.modes, accepted...)
+		netdev := dial(t, server, device.WithMetadata(device.Metadata{Platform: "ios"}))
+		if err := test.do(netdev); !test.check(err) {
+			t.Errorf("%s: returned %v", test.name, err)
+			continue
+		}
+		if got := configured(server); strings.Join(got, "\n") != strings.Join(test.config, "\n") {
+			t.Errorf("%s: configured %q, want %q", test.name, got, test.config)
+		}
+	}
+
+	// Helpers fail without sending anything if the driver lacks support.
+	server := iosServer(t, showVLANs, vlan1, vlan1, nil)
+	netdev := dial(t, server, device.WithMetadata(device.Metadata{Platform: "generic"}))
+	for name, err := range map[string]error{
+		"CreateVLAN": netdev.CreateVLAN(10, "users"),
+		"CreateUser": netdev.CreateUser(drivers.LocalUser{Name: "bob"}),
+		"SetBanner":  netdev.SetBanner("motd", "hello"),
+	} {
+		if err == nil {
+			t.Errorf("%s with the generic driver returned no error", name)
+		}
+	}
+	if _, err := netdev.EnsureNTPServers("10.0.0.1"); err == nil {
+		t.Error("EnsureNTPServers with the generic driver returned no error")
+	}
+	if _, err := netdev.EnsureConfig("ntp server 10.0.0.1\n"); err == nil {
+		t.Error("EnsureConfig with the generic driver returned no error")
+	}
+	if got := server.Received(); len(got) != 0 {
+		t.Errorf("generic driver sent %q", got)
+	}
+}
+
+func TestDevice_RunOn(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		platform string
+		modes    map[string]string
+		run      func(d *device.Device) (*device.Result, error)
+		want     []string // commands the device receives
+	}{
+		{
+			name: "RunOn", platform: "ios", modes: map[string]string{"session 2": "sw1-2#"},
+			run:  func(d *device.Device) (*device.Result, error) { return d.RunOn("2", "show version") },
+			want: []string{"terminal length 0", "terminal width 511", "session 2", "show version", "exit", "exit"},
+		},
+		{
+			name: "RunIn", platform: "iosxr", modes: map[string]string{"admin": "sysadmin-vm:0_RP0#"},
+			run:  func(d *device.Device) (*device.Result, error) { return d.RunIn("admin", "show version") },
+			want: []string{"terminal length 0", "terminal width 512", "admin", "show version", "exit", "exit"},
+		},
+	} {
+		server := devicetest.NewUnstartedServer(map[string]string{"show version": "Version 15.2\n"})
+		server.Modes = test.modes
+		server.Start()
+		t.Cleanup(server.Close)
+		netdev := dial(t, server, device.WithMetadata(device.Metadata{Platform: test.platform}))
+		netdev.CommandTimeout = 5 * time.Second
+		result, err := test.run(netdev)
+		if err != nil {
+			t.Errorf("%s: returned %v", test.name, err)
+			continue
+		}
+		if len(result.Commands) != 1 || string(result.Commands[0].Output) != "Version 15.2\n" {
+			t.Errorf("%s: Commands = %+v", test.name, result.Commands)
+		}
+		if got := server.Received(); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: device received %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, test := range []struct {
+		name, raw, want string
+	}{
+		{"crlf", "abc\r\nxyz\r\n", "abc\nxyz\n"},
+		{"crcrlf", "abc\r\r\nxyz\r\n", "abc\nxyz\n"},
+		{"trailing cr", "abc\r", "abc"},
+		{"progress", "copying  10%\rcopying  50%\rcopying 100%\r\n", "copying 100%\n"},
+		{"progress crcr", "10%\r\r100%\r\r\n[OK]\r\n", "100%\n[OK]\n"},
+		{"backspace", "ab\bc\n", "ac\n"},
+		{"escapes", "\x1b[32mup\x1b[0m\n", "up\n"},
+		{"controls", "a\x00b\x07\tc\n", "ab\tc\n"},
+	} {
+		if got := string(device.Normalize([]byte(test.raw))); got != test.want {
+			t.Errorf("%s: Normalize(%q) = %q, want %q", test.name, test.raw, got, test.want)
+		}
+	}
+}
+
+func ExampleNormalize() {
+	raw := "\x1b[1mshow clock\x1b[0m\r\n12:00:00 UTC\r\n --More-- \b\b\b\b\b\b\b\b\b\b          \b\b\b\b\b\b\b\b\b\bMon Jan 1\r\n"
+	fmt.Printf("%q\n", device.Normalize([]byte(raw)))
+	// Output: "show clock\n12:00:00 UTC\nMon Jan 1\n"
+}
+
+func ExampleMask() {
+	driver, err := drivers.Lookup("ios")
+	if err != nil {
+		log.Fatal(err)
+	}
+	output := "! Last configuration change at 10:02:11 UTC Tue Mar 2 2021 by admin\n" +
+		"username admin privilege 15 secret 9 $9$nhEmQVczB7dqsO$X.HsgL6x1il0RxkOSSvyQYwucySCt7qFm4v7pqCxkKM\n" +
+		"crypto pki certificate chain TP-self-signed-4112345678\n" +
+		"sw1 uptime is 2 weeks, 3 days, 4 hours, 5 minutes\n"
+	masks := append(drivers.VolatileMasks(driver), drivers.Mask{
+		Pattern:     regexp.MustCompile(`TP-self-signed-\d+`),
+		Replacement: "TP-self-signed-<serial>",
+	})
+	fmt.Print(device.Mask(output, masks))
+	// Output:
+	// ! Last configuration change at <timestamp>
+	// username admin privilege 15 secret 9 <secret>
+	// crypto pki certificate chain TP-self-signed-<serial>
+	// sw1 uptime is <uptime>
+}
+
+func ExampleRecorder() {
+	server := devicetest.NewServer(map[string]string{"show version": "Version 15.2\n"})
+	defer server.Close()
+	config, err := device.NewClientConfig("user", device.Password("password"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	netdev, err := device.DialConfig(server.Addr, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer netdev.Close()
+
+	// Record the session so it can be replayed with `asciinema play`.
+	var cast strings.Builder
+	if netdev.Recorder, err = device.NewRecorder(&cast, 80, 24); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := netdev.Run("show version", "exit"); err != nil {
+		log.Fatal(err)
+	}
+
+	// The recording is an asciicast: a header, then one event per line.
+	lines := strings.Split(strings.TrimSpace(cast.String()), "\n")
+	var header struct{ Version, Width, Height int }
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("asciicast v%d, %dx%d\n", header.Version, header.Width, header.Height)
+	var typed string
+	for _, line := range lines[1:] {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			log.Fatal(err)
+		}
+		if event[1] == "i" {
+			typed += event[2].(string)
+		}
+	}
+	fmt.Printf("typed %q\n", typed)
+	// Output:
+	// asciicast v2, 80x24
+	// typed "show version\nexit\n"
+}
+
+func ExampleExpand() {
+	cmds, err := device.Expand([]string{
+		"interface {{intf}}",
+		"description {{ desc }}",
+	}, map[string]string{"intf": "Gi0/1", "desc": "uplink"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(strings.Join(cmds, "\n"))
+	// Output:
+	// interface Gi0/1
+	// description uplink
+}
+
+func ExampleExpandHosts() {
+	hosts, err := device.ExpandHosts("sw[01-03].dc[1,4].example.com")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(strings.Join(hosts, "\n"))
+	// Output:
+	// sw01.dc1.example.com
+	// sw01.dc4.example.com
+	// sw02.dc1.example.com
+	// sw02.dc4.example.com
+	// sw03.dc1.example.com
+	// sw03.dc4.example.com
+}
+
+func ExampleCompareSnapshots() {
+	before := &device.Snapshot{
+		Commands: []string{"show ip ospf neighbor"},
+		Output: map[string]string{
+			"show ip ospf neighbor": "10.0.0.1 FULL/DR Gi0/1\n10.0.0.2 FULL/BDR Gi0/2\n",
+		},
+	}
+	after := &device.Snapshot{
+		Commands: []string{"show ip ospf neighbor"},
+		Output: map[string]string{
+			"show ip ospf neighbor": "10.0.0.1 FULL/DR Gi0/1\n",
+		},
+	}
+	for _, diff := range device.CompareSnapshots(before, after) {
+		fmt.Println(diff.Command)
+		for _, line := range diff.Removed {
+			fmt.Println("-", line)
+		}
+		for _, line := range diff.Added {
+			fmt.Println("+", line)
+		}
+	}
+	// Output:
+	// show ip ospf neighbor
+	// - 10.0.0.2 FULL/BDR Gi0/2
+}
+
+func ExampleCompareParsed() {
+	const cmd = "show interfaces status"
+	primary := &device.Snapshot{
+		Commands: []string{cmd},
+		Output: map[string]string{
+			cmd: "Gi0/1 connected 10 full 1000\nGi0/2 connected 20 full 1000\n",
+		},
+	}
+	standby := &device.Snapshot{
+		Commands: []string{cmd},
+		Output: map[string]string{
+			cmd: "Gi0/1 connected 10 half 100\n",
+		},
+	}
+	parsers := map[string]device.Parser{
+		cmd: device.MatchParser(regexp.MustCompile(
+			`^(?P<port>\S+)\s+(?P<status>\S+)\s+(?P<vlan>\S+)\s+(?P<duplex>\S+)\s+(?P<speed>\S+)$`), "port"),
+	}
+	comparison, err := device.CompareParsed(primary, standby, parsers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, diff := range comparison.Fields {
+		fmt.Println(diff)
+	}
+	// Output:
+	// show interfaces status: Gi0/1 duplex: "full" != "half"
+	// show interfaces status: Gi0/1 speed: "1000" != "100"
+	// show interfaces status: Gi0/2 only on A
+}
+
+func ExampleClassify() {
+	server := devicetest.NewServer(nil)
+	defer server.Close()
+
+	// Find a port nothing listens on.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+
+	for _, host := range []struct{ name, addr string }{{"sw1", server.Addr}, {"sw2", closed}} {
+		netdev, err := device.Dial(host.addr, "user", device.Password("password"))
+		if err != nil {
+			fmt.Printf("%s: %v error\n", host.name, device.Classify(err))
+			continue
+		}
+		fmt.Printf("%s: connected\n", host.name)
+		netdev.Close()
+	}
+	// Output:
+	// sw1: connected
+	// sw2: transport error
+}
+
+func ExamplePoller() {
+	polls := 0
+	server := devicetest.NewUnstartedServer(map[string]string{"show version": "Version 15.2\n"})
+	server.Handlers = map[string]func(io.Writer){
+		"show alarms": func(w io.Writer) {
+			if polls++; polls > 2 {
+				io.WriteString(w, "fan 2 failed\r\n")
+			}
+		},
+	}
+	server.Start()
+	defer server.Close()
+	netdev, err := device.Dial(server.Addr, "user", device.Password("password"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer netdev.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	poller := &device.Poller{
+		Devices:  []*device.Device{netdev},
+		Commands: []string{"show version", "show alarms"},
+		Interval: 10 * time.Millisecond,
+	}
+	updates := 0
+	poller.Run(ctx, func(update device.PollUpdate) {
+		fmt.Printf("%q\n", update.Output["show alarms"])
+		if updates++; updates == 2 {
+			cancel()
+		}
+	})
+	// Output:
+	// ""
+	// "fan 2 failed\n"
+}
+
+func ExampleDevice_Collect() {
+	server := devicetest.NewUnstartedServer(map[string]string{
+		"show version":              "Cisco IOS Software, Version 15.2(7)E3\n",
+		"show running-config":       "hostname core1\n",
+		"show logging":              "Syslog logging: enabled\n",
+		"show interfaces":           "GigabitEthernet0/1 is up, line protocol is up\n",
+		"show processes cpu sorted": "CPU utilization for five seconds: 3%/0%\n",
+		"show environment all":      "FAN is OK\n",
+	})
+	server.Prompt = "core1#"
+	server.Handlers = map[string]func(io.Writer){
+		"show tech-support": devicetest.Repeat("------------------ show tech-support ------------------", 4<<20),
+	}
+	server.Start()
+	defer server.Close()
+	netdev, err := device.Dial(
+		server.Addr,
+		"user",
+		device.Password("password"),
+		device.WithMetadata(device.Metadata{Name: "core1", Platform: "ios"}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer netdev.Close()
+
+	// Gather a support bundle, keeping "show tech-support" out of memory.
+	netdev.SpoolThreshold = 1 << 20
+	var archive bytes.Buffer
+	manifest, err := netdev.Collect(&archive, "full", func(cmd string, done, total int) {
+		fmt.Printf("[%d/%d] %s\n", done, total, cmd)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range manifest.Files {
+		if file.Error != "" {
+			fmt.Printf("%s failed: %s\n", file.Command, file.Error)
+		}
+	}
+	// Output:
+	// [1/7] show version
+	// [2/7] show running-config
+	// [3/7] show logging
+	// [4/7] show interfaces
+	// [5/7] show processes cpu sorted
+	// [6/7] show environment all
+	// [7/7] show tech-support
+}
+
+func ExampleDevice_EnsureNTPServers() {
+	// The switch has one of the two NTP servers configured and lists the
+	// other once it has been added.
+	server := devicetest.NewUnstartedServer(map[string]string{
+		"ntp server 10.0.0.2": "",
+		"write memory":        "[OK]\n",
+	})
+	server.Prompt = "sw1#"
+	server.Modes = map[string]string{"configure terminal": "sw1(config)#"}
+	server.Leave = []string{"end"}
+	server.Handlers = map[string]func(io.Writer){
+		"show running-config | include ^ntp server": func(w io.Writer) {
+			io.WriteString(w, "ntp server 10.0.0.1\r\n")
+			for _, cmd := range server.Received() {
+				if cmd == "ntp server 10.0.0.2" {
+					io.WriteString(w, "ntp server 10.0.0.2\r\n")
+					break
+				}
+			}
+		},
+	}
+	server.Start()
+	defer server.Close()
+
+	// Running it again changes nothing.
+	for _, host := range []string{"sw1", "sw1"} {
+		netdev, err := device.Dial(
+			server.Addr,
+			"user",
+			device.Password("password"),
+			device.WithMetadata(device.Metadata{Name: host, Platform: "ios"}),
+		)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		result, err := netdev.EnsureNTPServers("10.0.0.1", "10.0.0.2")
+		netdev.Close()
+		switch {
+		case err != nil:
+			fmt.Printf("%s: %v\n", host, err)
+		case result.Changed:
+			fmt.Printf("%s: added %s\n", host, strings.Join(result.Added, ", "))
+		default:
+			fmt.Printf("%s: unchanged\n", host)
+		}
+	}
+	// Output:
+	// sw1: added 10.0.0.2
+	// sw1: unchanged
+}
+
+func ExampleDevice_EnsureConfig() {
+	// The switch shows the interface as shut down once it has been told to.
+	server := devicetest.NewUnstartedServer(map[string]string{
+		"interface GigabitEthernet0/1": "",
+		"shutdown":                     "",
+		"write memory":                 "[OK]\n",
+	})
+	server.Prompt = "sw1#"
+	server.Modes = map[string]string{"configure terminal": "sw1(config)#"}
+	server.Leave = []string{"end"}
+	server.Handlers = map[string]func(io.Writer){
+		"show running-config": func(w io.Writer) {
+			io.WriteString(w, "hostname sw1\r\ninterface GigabitEthernet0/1\r\n description uplink\r\n")
+			for _, cmd := range server.Received() {
+				if cmd == "shutdown" {
+					io.WriteString(w, " shutdown\r\n")
+					break
+				}
+			}
+		},
+	}
+	server.Start()
+	defer server.Close()
+
+	const intended = `interface GigabitEthernet0/1
+ description uplink
+ shutdown
+`
+	// Pushing the same configuration again is a no-op.
+	for i := 0; i < 2; i++ {
+		netdev, err := device.Dial(
+			server.Addr,
+			"user",
+			device.Password("password"),
+			device.WithMetadata(device.Metadata{Name: "sw1", Platform: "ios"}),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result, err := netdev.EnsureConfig(intended)
+		netdev.Close()
+		switch {
+		case err != nil:
+			fmt.Printf("%s: %v\n", netdev, err)
+		case result.Changed:
+			fmt.Printf("%s: changed %q\n", netdev, result.Added)
+		default:
+			fmt.Printf("%s: no-op\n", netdev)
+		}
+	}
+	// Output:
+	// sw1: changed ["interface GigabitEthernet0/1" " shutdown"]
+	// sw1: no-op
+}
+
+func ExamplePolicy() {
+	server := devicetest.NewServer(nil)
+	defer server.Close()
+	config, err := device.NewClientConfig("user", device.Password("password"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	netdev, err := device.DialConfig(server.Addr, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer netdev.Close()
+	netdev.Name = "core1"
+
+	// Ask before running anything destructive. Here the operator answers no.
+	answers := strings.NewReader("n\n")
+	netdev.Policy = &device.Policy{
+		Confirm: device.DangerousCommands,
+		ConfirmFunc: func(d *device.Device, cmd string) bool {
+			fmt.Printf("Run %q on %s? [y/N] ", cmd, d)
+			var answer string
+			fmt.Fscanln(answers, &answer)
+			fmt.Println(answer)
+			return answer == "y"
+		},
+	}
+	if _, err := netdev.Run("reload", "exit"); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Run "reload" on core1? [y/N] n
+	// command "reload" not confirmed by policy (matched "(?i)^\\s*reload\\b")
 }
@@ -0,0 +1,325 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package devicetest provides an SSH server that imitates a network device,
+// for testing and benchmarking code that uses package device without real
+// hardware.
+package devicetest
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Server is an SSH server that answers commands like a network device. It
+// accepts any user and password, echoes input, and prints a prompt after the
+// output of each command. The "exit" command ends the session, or leaves
+// the current mode if Modes has been used to enter one. Commands requested
+// over exec channels, without a shell, are answered too.
+type Server struct {
+	Addr string // address of the listener, such as "127.0.0.1:54321"
+
+	// Prompt is printed after the banner and after every command. It
+	// defaults to "device#".
+	Prompt string
+
+	// Banner is printed when a session starts.
+	Banner string
+
+	// Commands maps each command the server knows to its output. Other
+	// commands print an IOS-style "% Invalid input detected" error.
+	Commands map[string]string
+
+	// Handlers maps commands to functions that write their output, for
+	// output too large to hold in Commands. Handlers take precedence over
+	// Commands, and their output is sent as is, so lines should end in
+	// "\r\n".
+	Handlers map[string]func(w io.Writer)
+
+	// Modes maps commands that enter a command mode, such as "configure
+	// terminal", to the prompt printed while in it. Modes nest: in a mode,
+	// "exit" returns to the previous prompt instead of ending the session,
+	// and the commands in Leave, such as "end", return to the first.
+	Modes map[string]string
+	Leave []string
+
+	// Disconnect lists commands, such as "reload", that make the server
+	// drop the connection, as a device does when it restarts.
+	Disconnect []string
+
+	// Ciphers, if set, are the only ciphers the server accepts, such as the
+	// CBC ciphers of older devices.
+	Ciphers []string
+
+	// Password, if set, is the only password the server accepts. Public
+	// keys are refused when it is set.
+	Password string
+
+	// Busy, if set, is printed after the banner by the first BusyShells
+	// shells, which then end without a prompt, as on a device with no free
+	// vty lines.
+	Busy       string
+	BusyShells int
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	outputs  map[string][]byte
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	received []string
+	shells   int // shells started
+}
+
+// NewServer starts and returns a server that knows commands. The caller
+// should call Close when finished.
+func NewServer(commands map[string]string) *Server {
+	s := NewUnstartedServer(commands)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that knows commands but is not yet
+// started, so that its fields can be changed before calling Start.
+func NewUnstartedServer(commands map[string]string) *Server {
+	return &Server{Prompt: "device#", Commands: commands}
+}
+
+// Start starts the server on a random local port.
+func (s *Server) Start() {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic("devicetest: failed to generate host key: " + err.Error())
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		panic("devicetest: failed to generate host key: " + err.Error())
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if s.Password != "" && string(password) != s.Password {
+				return nil, errors.New("password rejected")
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			if s.Password != "" {
+				return nil, errors.New("public key rejected")
+			}
+			return nil, nil
+		},
+	}
+	s.config.Ciphers = s.Ciphers
+	s.config.AddHostKey(signer)
+	s.outputs = make(map[string][]byte, len(s.Commands))
+	for cmd, output := range s.Commands {
+		s.outputs[cmd] = []byte(strings.Replace(output, "\n", "\r\n", -1))
+	}
+	if s.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		panic("devicetest: failed to listen: " + err.Error())
+	}
+	s.Addr = s.listener.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Received returns the commands the server's shells have received, in order,
+// including empty lines and "exit", so that tests can check what a client
+// sent.
+func (s *Server) Received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// Close stops the server and waits for its connections to end.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(conn, channel, requests)
+	}
+}
+
+func (s *Server) serveSession(conn net.Conn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	for req := range requests {
+		ok := req.Type == "shell" || req.Type == "pty-req" || req.Type == "exec"
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		switch req.Type {
+		case "shell":
+			go s.serveShell(conn, channel)
+		case "exec":
+			var exec struct{ Command string }
+			ssh.Unmarshal(req.Payload, &exec)
+			go s.serveExec(channel, exec.Command)
+		}
+	}
+}
+
+// serveExec runs cmd without a shell, as for "ssh host show version".
+func (s *Server) serveExec(channel ssh.Channel, cmd string) {
+	defer channel.Close()
+	status := uint32(0)
+	if handler, ok := s.Handlers[cmd]; ok {
+		handler(channel)
+	} else if output, ok := s.outputs[cmd]; ok {
+		channel.Write(output)
+	} else {
+		io.WriteString(channel, "% Invalid input detected\r\n")
+		status = 1
+	}
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+func (s *Server) serveShell(conn net.Conn, channel ssh.Channel) {
+	defer channel.Close()
+	out := bufio.NewWriter(channel)
+	out.WriteString(strings.Replace(s.Banner, "\n", "\r\n", -1))
+	s.mu.Lock()
+	s.shells++
+	busy := s.shells <= s.BusyShells
+	s.mu.Unlock()
+	if busy {
+		out.WriteString(strings.Replace(s.Busy, "\n", "\r\n", -1))
+		out.Flush()
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+		return
+	}
+	out.WriteString(s.Prompt)
+	out.Flush()
+	in := bufio.NewReader(channel)
+	var line []byte
+	var modes []string // prompts of the modes entered, innermost last
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case '\r':
+			continue
+		case '\n':
+		default:
+			line = append(line, c)
+			out.WriteByte(c)
+			if in.Buffered() == 0 {
+				out.Flush()
+			}
+			continue
+		}
+		cmd := strings.TrimSpace(string(line))
+		line = line[:0]
+		s.mu.Lock()
+		s.received = append(s.received, cmd)
+		s.mu.Unlock()
+		out.WriteString("\r\n")
+		if cmd == "exit" && len(modes) == 0 {
+			out.Flush()
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		}
+		if contains(s.Disconnect, cmd) {
+			out.Flush()
+			conn.Close()
+			return
+		}
+		if cmd == "exit" {
+			modes = modes[:len(modes)-1]
+		} else if prompt, ok := s.Modes[cmd]; ok {
+			modes = append(modes, prompt)
+		} else if contains(s.Leave, cmd) {
+			modes = nil
+		} else if handler, ok := s.Handlers[cmd]; ok {
+			handler(out)
+		} else if output, ok := s.outputs[cmd]; ok {
+			out.Write(output)
+		} else if cmd != "" {
+			out.WriteString("% Invalid input detected\r\n")
+		}
+		if len(modes) > 0 {
+			out.WriteString(modes[len(modes)-1])
+		} else {
+			out.WriteString(s.Prompt)
+		}
+		out.Flush()
+	}
+}
+
+// contains reports whether cmd is one of cmds.
+func contains(cmds []string, cmd string) bool {
+	for _, c := range cmds {
+		if cmd == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Repeat returns a handler that writes line, followed by "\r\n", until at
+// least size bytes have been written.
+func Repeat(line string, size int) func(w io.Writer) {
+	chunk := []byte(strings.Repeat(line+"\r\n", 64*1024/(len(line)+2)+1))
+	return func(w io.Writer) {
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strings"
+	"time"
+)
+
+// A Dialer contains options for connecting to devices. The zero value dials
+// like Dial.
+type Dialer struct {
+	// Resolver looks up the addresses of device host names, for example
+	// against a management DNS server. If nil, the system resolver is used.
+	Resolver *net.Resolver
+
+	// Hosts maps host names to addresses and is consulted before Resolver,
+	// like a hosts file.
+	Hosts map[string]string
+
+	// ProbeTimeout, if set, bounds the TCP connection that precedes the SSH
+	// handshake, so that unreachable devices fail quickly instead of using
+	// the whole of the client config's Timeout.
+	ProbeTimeout time.Duration
+
+	// Busy configures retries of handshakes refused because the device has
+	// no free vty lines.
+	Busy BusyRetry
+
+	// Breaker, if set, stops connections to hosts that keep failing.
+	Breaker *Breaker
+}
+
+// UnreachableError is returned, possibly wrapped, when a device does not accept
+// TCP connections on its SSH port. Use errors.Cause to tell it apart from
+// failures later in the handshake.
+type UnreachableError struct {
+	Addr string
+	Err  error // the error returned by the TCP dial
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("%s is unreachable: %v", e.Addr, e.Err)
+}
+
+func (e *UnreachableError) Unwrap() error { return e.Err }
+
+// defaultDialer is used by Dial and WaitForSSH.
+var defaultDialer = &Dialer{}
+
+// Dial creates a client connection to a remote device.
+func (dl *Dialer) Dial(addr string, config *ssh.ClientConfig) (*Device, error) {
+	return dl.DialContext(context.Background(), addr, config)
+}
+
+// DialContext is like Dial but gives up when ctx is done, including during
+// the SSH handshake.
+func (dl *Dialer) DialContext(ctx context.Context, addr string, config *ssh.ClientConfig) (*Device, error) {
+	d := &Device{addr: addr, config: config, dialer: dl}
+	client, err := dl.connect(ctx, addr, config)
+	if err != nil {
+		d.notify(SeverityError, "failure", "failed to connect as %s: %v", config.User, err)
+		return nil, errors.Wrap(err, "failed to dial")
+	}
+	d.Client = client
+	d.notify(SeverityInfo, "connect", "connected as %s", config.User)
+	return d, nil
+}
+
+// DialAny connects to the first of addrs that completes an SSH handshake, such
+// as a device's primary and out-of-band management addresses. The Addr method
+// of the returned Device reports which one it was.
+func (dl *Dialer) DialAny(config *ssh.ClientConfig, addrs ...string) (*Device, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to dial")
+	}
+	var first error
+	for _, addr := range addrs {
+		netdev, err := dl.Dial(addr, config)
+		if err == nil {
+			return netdev, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return nil, errors.Wrapf(first, "failed to dial any of %s", strings.Join(addrs, ", "))
+}
+
+// dial connects to addr and completes the SSH handshake. If the host name
+// resolves to several addresses, each is tried in turn until one succeeds.
+// Host keys are checked against addr as given, not the address it resolves to.
+func (dl *Dialer) dial(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := dl.dialOnce(ctx, addr, config)
+		if _, ok := err.(*BusyError); !ok || attempt >= dl.Busy.Retries {
+			return client, err
+		}
+		if err := dl.Busy.wait(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// dialOnce is dial without retries.
+func (dl *Dialer) dialOnce(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := dl.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var first error
+	for _, ip := range ips {
+		client, err := dl.handshake(ctx, net.JoinHostPort(ip, port), addr, config)
+		if err == nil {
+			return client, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, first
+}
+
+// lookup returns the addresses of host, consulting Hosts before Resolver.
+func (dl *Dialer) lookup(ctx context.Context, host string) ([]string, error) {
+	if ip, ok := dl.Hosts[host]; ok {
+		return []string{ip}, nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	resolver := dl.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return resolver.LookupHost(ctx, host)
+}
+
+// handshake connects to target and completes an SSH handshake with it as
+// addr.
+func (dl *Dialer) handshake(ctx context.Context, target, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	if dl.ProbeTimeout > 0 {
+		dialer.Timeout = dl.ProbeTimeout
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return nil, &UnreachableError{Addr: addr, Err: err}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	head := &headConn{Conn: conn}
+	c, chans, reqs, err := ssh.NewClientConn(head, addr, config)
+	if err != nil {
+		conn.Close()
+		if busy := busyError(addr, err, head.head); busy != nil {
+			return nil, busy
+		}
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, &AuthError{Addr: addr, Err: err}
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
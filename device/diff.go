@@ -0,0 +1,106 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+// lineEdit is one line of an edit script turning one text into another.
+type lineEdit struct {
+	op   byte // ' ' keeps the line, '-' removes it, and '+' adds it
+	line string
+}
+
+// diffLines returns the shortest edit script turning a into b, computed with
+// Myers' algorithm.
+func diffLines(a, b []string) []lineEdit {
+	// Lines shared at the start and end are kept without searching.
+	var head, tail []lineEdit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		head = append(head, lineEdit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		tail = append(tail, lineEdit{' ', a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	n, m := len(a), len(b)
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	// trace[d] holds v for diagonals -d-1 through d+1 before step d, which
+	// is all that backtracking through step d reads.
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var middle []lineEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, off := trace[d], d+1
+		k := x - y
+		prev := k - 1
+		if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+			prev = k + 1
+		}
+		px := v[off+prev]
+		py := px - prev
+		for x > px && y > py {
+			x, y = x-1, y-1
+			middle = append(middle, lineEdit{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == px {
+			y--
+			middle = append(middle, lineEdit{'+', b[y]})
+		} else {
+			x--
+			middle = append(middle, lineEdit{'-', a[x]})
+		}
+		x, y = px, py
+	}
+
+	edits := head
+	for i := len(middle) - 1; i >= 0; i-- {
+		edits = append(edits, middle[i])
+	}
+	for i := len(tail) - 1; i >= 0; i-- {
+		edits = append(edits, tail[i])
+	}
+	return edits
+}
@@ -0,0 +1,88 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// promptPattern matches a typical shell prompt: up to 64 characters ending in
+// one of the characters devices commonly end their prompts with.
+const promptPattern = `^\S.{0,63}?[#>$%\]] ?`
+
+// trailingPrompt matches a line holding nothing but a prompt.
+var trailingPrompt = regexp.MustCompile(promptPattern + `$`)
+
+// isEcho reports whether line is a prompt followed by cmd.
+func isEcho(line []byte, cmd string) bool {
+	return bytes.HasSuffix(line, []byte(cmd)) && trailingPrompt.Match(line[:len(line)-len(cmd)])
+}
+
+// splitEcho splits the output of a shell session into the response to each
+// command by locating the lines where the prompt echoes each command. Output
+// before the first echo, such as a login banner, and the prompt left after the
+// last command are discarded. If no echo is found, splitEcho returns nil.
+//
+// Trailing lines are taken for the prompt only if they match prompt, the
+// device's own pattern, so that output such as "Total: [OK]" is kept. If
+// prompt is nil, only a last line the device has not ended, as it leaves its
+// prompt, is checked against the generic pattern.
+func splitEcho(output []byte, cmds []string, prompt *regexp.Regexp) [][]byte {
+	lines := bytes.SplitAfter(output, []byte("\n"))
+	bodies := make([][]byte, len(cmds))
+	current, start, next := -1, 0, 0
+	for i, cmd := range cmds {
+		for j := next; j < len(lines); j++ {
+			if isEcho(bytes.TrimRight(lines[j], " \t\r\n"), cmd) {
+				if current >= 0 {
+					bodies[current] = bytes.Join(lines[start:j], nil)
+				}
+				current, start, next = i, j+1, j+1
+				break
+			}
+		}
+	}
+	if current < 0 {
+		return nil
+	}
+	tail := lines[start:]
+	for len(tail) > 0 && isTrailing(tail[len(tail)-1], prompt) {
+		tail = tail[:len(tail)-1]
+	}
+	bodies[current] = bytes.Join(tail, nil)
+	return bodies
+}
+
+// isTrailing reports whether line, at the end of the output, is blank or the
+// prompt: a line matching prompt or, if prompt is nil, an unended line
+// matching the generic pattern.
+func isTrailing(line []byte, prompt *regexp.Regexp) bool {
+	trimmed := bytes.TrimRight(line, " \t\r\n")
+	switch {
+	case len(trimmed) == 0:
+		return true
+	case prompt != nil:
+		return prompt.Match(trimmed)
+	default:
+		return !bytes.HasSuffix(line, []byte("\n")) && trailingPrompt.Match(trimmed)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/config"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+)
+
+// EnsureResult reports what an Ensure method changed on a device: whether it
+// made a change or found nothing to do.
+type EnsureResult struct {
+	Device   string
+	Metadata Metadata
+	Changed  bool     // whether the configuration was changed
+	Added    []string // what was missing and has been added
+}
+
+// EnsureServers makes sure that the device uses servers for service, "ntp",
+// "dns", or "syslog", among any others it already uses. It reads the
+// configured servers first and changes the configuration only if some are
+// missing, so that running it across a fleet again is safe, and confirms
+// that none are missing afterwards.
+func (d *Device) EnsureServers(service string, servers ...string) (*EnsureResult, error) {
+	c, ok := d.driver().(drivers.ServiceConfigurer)
+	if !ok {
+		return nil, errors.Errorf("%s: driver cannot configure services", d)
+	}
+	cmd, parse := c.Servers(service)
+	if cmd == "" {
+		return nil, errors.Errorf("%s: driver cannot configure %s servers", d, service)
+	}
+	output, err := d.show(cmd)
+	if err != nil {
+		return nil, err
+	}
+	result := &EnsureResult{Device: d.String(), Metadata: d.Metadata}
+	result.Added = missing(servers, parse(output))
+	if len(result.Added) == 0 {
+		return result, nil
+	}
+	if err := d.apply("configure "+service+" servers", c.AddServers(service, result.Added...)); err != nil {
+		return nil, err
+	}
+	result.Changed = true
+	if output, err = d.show(cmd); err != nil {
+		return nil, err
+	}
+	if still := missing(servers, parse(output)); len(still) > 0 {
+		return result, &VerifyError{Command: cmd, Missing: still}
+	}
+	return result, nil
+}
+
+// EnsureNTPServers is EnsureServers for "ntp".
+func (d *Device) EnsureNTPServers(servers ...string) (*EnsureResult, error) {
+	return d.EnsureServers("ntp", servers...)
+}
+
+// EnsureDNSServers is EnsureServers for "dns".
+func (d *Device) EnsureDNSServers(servers ...string) (*EnsureResult, error) {
+	return d.EnsureServers("dns", servers...)
+}
+
+// EnsureSyslogHosts is EnsureServers for "syslog".
+func (d *Device) EnsureSyslogHosts(hosts ...string) (*EnsureResult, error) {
+	return d.EnsureServers("syslog", hosts...)
+}
+
+// EnsureConfig makes sure that the device's running configuration holds the
+// statements of intended, written in the syntax the device shows its
+// configuration in, such as indented IOS statements or Junos set commands.
+// It compares intended with the running configuration section by section,
+// as config.Missing does, and sends only the missing statements, with the
+// sections that lead to them, so that pushing the same configuration again
+// is a no-op. Statements must be written as the device shows them, with
+// interface names in full, for instance, or they are sent again every time.
+//
+// Added holds the commands sent, as they are written in the format, so in
+// indented formats such as IOS, which EnsureConfig is meant for, statements
+// inside a section keep their leading indentation, as in " shutdown".
+func (d *Device) EnsureConfig(intended string) (*EnsureResult, error) {
+	c, ok := d.driver().(drivers.RunningConfiger)
+	if !ok {
+		return nil, errors.Errorf("%s: driver cannot show its configuration", d)
+	}
+	cmd, format := c.RunningConfig()
+	if cmd == "" {
+		return nil, errors.Errorf("%s: driver cannot show its configuration", d)
+	}
+	want, err := config.Parse(intended, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse intended configuration")
+	}
+	absent, err := d.missingConfig(cmd, format, want)
+	if err != nil {
+		return nil, err
+	}
+	result := &EnsureResult{Device: d.String(), Metadata: d.Metadata, Added: absent}
+	if len(absent) == 0 {
+		return result, nil
+	}
+	if err := d.apply("configure", drivers.Change{Commands: absent}); err != nil {
+		return nil, err
+	}
+	result.Changed = true
+	if absent, err = d.missingConfig(cmd, format, want); err != nil {
+		return nil, err
+	}
+	if len(absent) > 0 {
+		return result, &VerifyError{Command: cmd, Missing: absent}
+	}
+	return result, nil
+}
+
+// missingConfig returns the commands adding the statements of want that the
+// output of cmd, in format, lacks.
+func (d *Device) missingConfig(cmd string, format config.Format, want *config.Node) ([]string, error) {
+	output, err := d.show(cmd)
+	if err != nil {
+		return nil, err
+	}
+	have, err := config.Parse(output, format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the output of %q", cmd)
+	}
+	return config.Missing(have, want).Commands(format), nil
+}
+
+// missing returns the elements of want that are not in have, without
+// duplicates.
+func missing(want, have []string) []string {
+	var m []string
+	for _, s := range want {
+		if !contains(have, s) && !contains(m, s) {
+			m = append(m, s)
+		}
+	}
+	return m
+}
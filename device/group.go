@@ -0,0 +1,157 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupChange is the change one device receives in CommitGroup.
+type GroupChange struct {
+	Device   *Device
+	Commands []string // configuration commands, without entering configuration mode
+}
+
+// GroupCommitError reports that CommitGroup did not commit a change on every
+// device. Errors are keyed by device.
+type GroupCommitError struct {
+	Phase      string           // "stage" or "finalize"
+	Errs       map[string]error // devices that failed the phase
+	Unreverted map[string]error // devices staged but not rolled back after a failed stage
+}
+
+func (e *GroupCommitError) Error() string {
+	msg := fmt.Sprintf("failed to %s group change: %s", e.Phase, joinErrs(e.Errs))
+	if len(e.Unreverted) > 0 {
+		msg += fmt.Sprintf("; failed to roll back: %s", joinErrs(e.Unreverted))
+	}
+	return msg
+}
+
+// joinErrs formats errs in device order.
+func joinErrs(errs map[string]error) string {
+	var names []string
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s: %v", name, errs[name])
+	}
+	return strings.Join(names, "; ")
+}
+
+// CommitGroup commits changes to a group of devices, such as a firewall pair
+// or MLAG peers, all or nothing. Every change is first staged with the driver's
+// drivers.Stager, to be rolled back by the device after revert unless
+// finalized. Only once every device has staged its change are the changes
+// finalized; if any device fails to stage, the changes already staged are
+// rolled back at once.
+//
+// A device that fails to finalize rolls back by itself when revert elapses,
+// so revert should leave time to finalize the whole group. The error returned
+// is a *GroupCommitError if a phase failed on some devices.
+func CommitGroup(changes []GroupChange, revert time.Duration) error {
+	minutes := int((revert + time.Minute - 1) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	stagers := make([]drivers.Stager, len(changes))
+	for i, change := range changes {
+		stager, ok := change.Device.driver().(drivers.Stager)
+		if !ok || stager.Stage(nil, minutes) == nil {
+			return errors.Errorf("%s: driver cannot stage changes", change.Device)
+		}
+		stagers[i] = stager
+	}
+
+	errs := eachChange(changes, func(i int) error {
+		return changes[i].Device.stage(stagers[i], changes[i].Commands, minutes)
+	})
+	if len(errs) > 0 {
+		unreverted := eachChange(changes, func(i int) error {
+			if _, failed := errs[changes[i].Device.String()]; failed {
+				return nil
+			}
+			_, err := changes[i].Device.runSession(stagers[i].Abort()...)
+			return err
+		})
+		return &GroupCommitError{Phase: "stage", Errs: errs, Unreverted: unreverted}
+	}
+
+	errs = eachChange(changes, func(i int) error {
+		return changes[i].Device.runStaged(stagers[i], stagers[i].Finalize())
+	})
+	if len(errs) > 0 {
+		return &GroupCommitError{Phase: "finalize", Errs: errs}
+	}
+	return nil
+}
+
+// stage applies cmds provisionally with stager.
+func (d *Device) stage(stager drivers.Stager, cmds []string, minutes int) error {
+	return d.runStaged(stager, stager.Stage(cmds, minutes))
+}
+
+// runStaged runs cmds, the commands of one of stager's phases, and returns a
+// RejectedError if the output matches stager's StageFailed pattern or shows
+// that the device rejected a command.
+func (d *Device) runStaged(stager drivers.Stager, cmds []string) error {
+	result, err := d.runSession(cmds...)
+	if err != nil {
+		return err
+	}
+	if failed := stager.StageFailed(); failed != nil {
+		for _, line := range lines(string(result.Output)) {
+			if failed.MatchString(line) {
+				return &RejectedError{Device: d.String(), Message: strings.TrimSpace(line)}
+			}
+		}
+	}
+	return d.rejection(result)
+}
+
+// eachChange calls fn for every change at once and returns the errors by
+// device.
+func eachChange(changes []GroupChange, fn func(i int) error) map[string]error {
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range changes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(i); err != nil {
+				mu.Lock()
+				errs[changes[i].Device.String()] = err
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,100 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import "time"
+
+// DefaultHistorySize is the number of commands a Device remembers when
+// HistorySize is zero.
+const DefaultHistorySize = 1000
+
+// DefaultHistoryOutput is how many bytes of each command's output a Device
+// remembers when HistoryOutput is zero.
+const DefaultHistoryOutput = 4 << 10
+
+// HistoryEntry records a command passed to Run. It holds a copy of at most
+// HistoryOutput bytes of the command's output rather than the whole Result,
+// so that a long-lived Device does not keep every output it has seen.
+type HistoryEntry struct {
+	Time     time.Time     // when the command was sent, or when Run failed
+	Command  string        // with the passwords it sets redacted
+	Duration time.Duration // zero if the command was not sent
+
+	// Output is the start of the device's response to the command, or nil
+	// if it is not known, and Truncated reports whether more was cut off.
+	Output    []byte
+	Truncated bool
+
+	// Err is the error of the Run call that sent the command, if it failed.
+	Err error
+}
+
+// History returns the commands sent to the device, oldest first. Only the most
+// recent HistorySize commands are kept.
+func (d *Device) History() []HistoryEntry {
+	d.historyMu.Lock()
+	defer d.historyMu.Unlock()
+	return append([]HistoryEntry(nil), d.history...)
+}
+
+// remember adds the commands of a call to Run to the device's history.
+func (d *Device) remember(cmds []string, result *Result, err error) {
+	limit := d.HistoryOutput
+	if limit == 0 {
+		limit = DefaultHistoryOutput
+	}
+	now := time.Now()
+	for i, cmd := range cmds {
+		entry := HistoryEntry{Time: now, Command: cmd, Err: err}
+		if result != nil {
+			sent := result.Commands[i]
+			entry.Time, entry.Duration = sent.Sent, sent.Duration
+			if output := sent.Output; output != nil && limit > 0 {
+				entry.Truncated = len(output) > limit
+				if entry.Truncated {
+					output = output[:limit]
+				}
+				entry.Output = append([]byte{}, output...)
+			}
+		}
+		d.record(entry)
+	}
+}
+
+// record adds a command to the device's history, discarding the oldest entry
+// if the history is full.
+func (d *Device) record(entry HistoryEntry) {
+	size := d.HistorySize
+	if size == 0 {
+		size = DefaultHistorySize
+	}
+	if size < 0 {
+		return
+	}
+	entry.Command = redact(entry.Command)
+	d.historyMu.Lock()
+	defer d.historyMu.Unlock()
+	if len(d.history) >= size {
+		n := copy(d.history, d.history[len(d.history)-size+1:])
+		d.history = d.history[:n]
+	}
+	d.history = append(d.history, entry)
+}
@@ -0,0 +1,99 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxHosts limits the number of names ExpandHosts produces from one pattern,
+// so that a typo cannot exhaust memory.
+const maxHosts = 1 << 16
+
+// hostRange matches a bracketed range list such as [1-4] or [01-24,48]. Other
+// brackets, such as those around IPv6 addresses, are left alone.
+var hostRange = regexp.MustCompile(`\[([0-9,-]+)\]`)
+
+// ExpandHosts expands the bracketed ranges in pattern into the host names or
+// addresses they describe. A range is a comma-separated list of numbers and
+// inclusive spans, such as "sw[01-48].site.example.com" or "10.0.[1-4,8].1".
+// Numbers written with leading zeros are padded to the same width. Patterns
+// with several ranges expand to every combination, in order. A pattern
+// without ranges expands to itself.
+func ExpandHosts(pattern string) ([]string, error) {
+	hosts := []string{""}
+	last := 0
+	for _, loc := range hostRange.FindAllStringSubmatchIndex(pattern, -1) {
+		values, err := expandRange(pattern[loc[2]:loc[3]])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid range in %q", pattern)
+		}
+		if len(hosts)*len(values) > maxHosts {
+			return nil, errors.Errorf("%q expands to more than %d hosts", pattern, maxHosts)
+		}
+		prefix := pattern[last:loc[0]]
+		expanded := make([]string, 0, len(hosts)*len(values))
+		for _, host := range hosts {
+			for _, value := range values {
+				expanded = append(expanded, host+prefix+value)
+			}
+		}
+		hosts, last = expanded, loc[1]
+	}
+	for i := range hosts {
+		hosts[i] += pattern[last:]
+	}
+	return hosts, nil
+}
+
+// expandRange expands the inside of a bracketed range, such as "01-24,48".
+func expandRange(spec string) ([]string, error) {
+	var values []string
+	for _, part := range strings.Split(spec, ",") {
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return nil, errors.Errorf("%q is not a number", lo)
+		}
+		end, err := strconv.Atoi(hi)
+		if err != nil || end < start {
+			return nil, errors.Errorf("%q is not a number at least %d", hi, start)
+		}
+		if end-start >= maxHosts {
+			return nil, errors.Errorf("range %q is too large", part)
+		}
+		width := 0
+		if len(lo) > 1 && lo[0] == '0' {
+			width = len(lo)
+		}
+		for n := start; n <= end; n++ {
+			values = append(values, fmt.Sprintf("%0*d", width, n))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"time"
+)
+
+// resume stops the idle timer for a call to Run, Ping, or MeasureRTT,
+// reconnecting first if the connection was closed for being idle.
+func (d *Device) resume() error {
+	if d.IdleTimeout <= 0 {
+		return nil
+	}
+	d.idleMu.Lock()
+	defer d.idleMu.Unlock()
+	if d.idle != nil {
+		d.idle.Stop()
+	}
+	if d.idleClosed {
+		client, err := d.reconnect()
+		if err != nil {
+			d.notify(SeverityError, "failure", "failed to reconnect after idling: %v", err)
+			return errors.Wrap(err, "failed to reconnect")
+		}
+		d.setClient(client)
+		d.idleClosed = false
+		d.startKeepAlive()
+	}
+	d.active++
+	return nil
+}
+
+// rest restarts the idle timer once no call to Run, Ping, or MeasureRTT is
+// in progress.
+func (d *Device) rest() {
+	if d.IdleTimeout <= 0 {
+		return
+	}
+	d.idleMu.Lock()
+	defer d.idleMu.Unlock()
+	if d.active--; d.active > 0 {
+		return
+	}
+	if d.idle == nil {
+		d.idle = time.AfterFunc(d.IdleTimeout, d.closeIdle)
+	} else {
+		d.idle.Reset(d.IdleTimeout)
+	}
+}
+
+// closeIdle closes the persistent session and the connection unless a call
+// was made since the idle timer fired.
+func (d *Device) closeIdle() {
+	d.idleMu.Lock()
+	defer d.idleMu.Unlock()
+	if d.active > 0 || d.idleClosed {
+		return
+	}
+	d.CloseSession()
+	d.client().Close()
+	d.idleClosed = true
+	d.notify(SeverityInfo, "idle", "closed connection idle for %v", d.IdleTimeout)
+}
+
+// reconnect opens a new connection to the device.
+func (d *Device) reconnect() (*ssh.Client, error) {
+	if d.Reconnect != nil {
+		return d.Reconnect()
+	}
+	if d.config == nil {
+		return nil, errors.New("device was not dialed and cannot be reconnected")
+	}
+	dialer := d.dialer
+	if dialer == nil {
+		dialer = defaultDialer
+	}
+	return dialer.connect(context.Background(), d.addr, d.config)
+}
+
+// client returns the device's connection. It is replaced when the device
+// reconnects, so it is read under clientMu rather than through the embedded
+// Client.
+func (d *Device) client() *ssh.Client {
+	d.clientMu.Lock()
+	defer d.clientMu.Unlock()
+	return d.Client
+}
+
+// setClient replaces the device's connection with client.
+func (d *Device) setClient(client *ssh.Client) {
+	d.clientMu.Lock()
+	defer d.clientMu.Unlock()
+	d.Client = client
+}
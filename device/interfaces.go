@@ -0,0 +1,74 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+)
+
+// SetInterfaceDescription sets the description of intf and confirms that the
+// configuration shows it.
+func (d *Device) SetInterfaceDescription(intf, desc string) error {
+	c, err := d.interfaceConfigurer()
+	if err != nil {
+		return err
+	}
+	return d.apply("set interface descriptions", c.InterfaceDescription(intf, desc))
+}
+
+// SetInterfaceVLAN makes intf an access port in vlan and confirms that the
+// configuration shows it.
+func (d *Device) SetInterfaceVLAN(intf string, vlan int) error {
+	c, err := d.interfaceConfigurer()
+	if err != nil {
+		return err
+	}
+	return d.apply("set interface VLANs", c.InterfaceVLAN(intf, vlan))
+}
+
+// ShutInterface administratively disables intf and confirms that the
+// configuration shows it.
+func (d *Device) ShutInterface(intf string) error {
+	c, err := d.interfaceConfigurer()
+	if err != nil {
+		return err
+	}
+	return d.apply("shut down interfaces", c.InterfaceShutdown(intf, true))
+}
+
+// NoShutInterface administratively enables intf and confirms that the
+// configuration shows it.
+func (d *Device) NoShutInterface(intf string) error {
+	c, err := d.interfaceConfigurer()
+	if err != nil {
+		return err
+	}
+	return d.apply("enable interfaces", c.InterfaceShutdown(intf, false))
+}
+
+// interfaceConfigurer returns the device's driver as an InterfaceConfigurer.
+func (d *Device) interfaceConfigurer() (drivers.InterfaceConfigurer, error) {
+	if c, ok := d.driver().(drivers.InterfaceConfigurer); ok {
+		return c, nil
+	}
+	return nil, errors.Errorf("%s: driver cannot configure interfaces", d)
+}
@@ -0,0 +1,73 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+)
+
+// RunJSON runs the show command cmd in a session of its own, asking the
+// device to print its output as JSON, and decodes the output into v. The
+// command is rewritten with the driver's drivers.JSONFormatter, such as
+// "show version | json" on NX-OS.
+func (d *Device) RunJSON(cmd string, v interface{}) error {
+	formatter, ok := d.driver().(drivers.JSONFormatter)
+	if !ok || formatter.JSON(cmd) == "" {
+		return errors.Errorf("%s: driver cannot print output as JSON", d)
+	}
+	cmd = formatter.JSON(cmd)
+	result, err := d.runSession(cmd)
+	if err != nil {
+		return err
+	}
+	if err := d.rejection(result); err != nil {
+		return err
+	}
+	output := result.Commands[0].Output
+	if output == nil {
+		output = result.Output
+	}
+	if err := decodeJSON(output, v); err != nil {
+		return &ParseError{Device: d.String(), Command: cmd, Err: err}
+	}
+	return nil
+}
+
+// decodeJSON decodes the first JSON object or array in output, which may be
+// preceded by the echoed command and followed by the prompt.
+func decodeJSON(data []byte, v interface{}) error {
+	start := bytes.IndexAny(data, "{[")
+	for start > 0 && data[start-1] != '\n' {
+		next := bytes.IndexAny(data[start+1:], "{[")
+		if next < 0 {
+			start = -1
+			break
+		}
+		start += next + 1
+	}
+	if start < 0 {
+		return errors.New("no JSON in output")
+	}
+	return json.NewDecoder(bytes.NewReader(data[start:])).Decode(v)
+}
@@ -0,0 +1,134 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+)
+
+// ErrorKind is the broad cause of an error returned by the package, so that
+// failures across a fleet can be counted without matching error text.
+type ErrorKind int
+
+const (
+	KindUnknown         ErrorKind = iota
+	KindTransport                 // the connection could not be made or was lost
+	KindAuth                      // the credentials or the host key were refused
+	KindPromptTimeout             // the device did not return to its prompt in time
+	KindCommandRejected           // a command was refused by the device or by policy
+	KindOutputParse               // the output of a command could not be parsed
+)
+
+var kindNames = []string{"unknown", "transport", "auth", "prompt-timeout", "command-rejected", "output-parse"}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// MarshalText encodes the kind as its name, for reports.
+func (k ErrorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// AuthError is returned, possibly wrapped, when a device refuses every
+// authentication method offered.
+type AuthError struct {
+	Addr string
+	Err  error // the error returned by the SSH handshake
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("%s refused authentication: %v", e.Addr, e.Err)
+}
+
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// RejectedError reports that a device refused a command or change.
+type RejectedError struct {
+	Device  string
+	Message string // what the device said
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s rejected a command: %s", e.Device, e.Message)
+}
+
+// ParseError reports that the output of a command could not be parsed.
+type ParseError struct {
+	Device  string
+	Command string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: failed to parse %q: %v", e.Device, e.Command, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Classify returns the kind of err, looking through wrapped errors until it
+// finds one it knows. It returns KindUnknown for nil and unrecognized errors.
+func Classify(err error) ErrorKind {
+	for err != nil {
+		switch e := err.(type) {
+		case *AuthError, *HostKeyChangedError, *knownhosts.KeyError:
+			return KindAuth
+		case *UnreachableError, *BusyError, *ssh.OpenChannelError, *net.OpError:
+			return KindTransport
+		case *PolicyError, *AuthorizationError, *RejectedError, *VerifyError, *ssh.ExitError:
+			return KindCommandRejected
+		case *ParseError:
+			return KindOutputParse
+		case *GroupCommitError:
+			// The first device's error stands for the group.
+			var first string
+			for name := range e.Errs {
+				if first == "" || name < first {
+					first = name
+				}
+			}
+			return Classify(e.Errs[first])
+		}
+		switch err {
+		case TimeoutError, EchoError:
+			return KindPromptTimeout
+		case io.EOF, io.ErrUnexpectedEOF, context.DeadlineExceeded, context.Canceled:
+			return KindTransport
+		}
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return KindUnknown
+		}
+	}
+	return KindUnknown
+}
@@ -0,0 +1,281 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HostKeyChangedError is returned, possibly wrapped, when a host presents a
+// key other than the one known_hosts lists for it. This is expected after a
+// device is replaced, but may also mean the connection is being intercepted.
+type HostKeyChangedError struct {
+	Host  string
+	Key   ssh.PublicKey         // the key the host presented
+	Known []knownhosts.KnownKey // the keys known_hosts lists for the host
+}
+
+func (e *HostKeyChangedError) Error() string {
+	known := make([]string, len(e.Known))
+	for i, k := range e.Known {
+		known[i] = fmt.Sprintf("%s (%s:%d)", ssh.FingerprintSHA256(k.Key), k.Filename, k.Line)
+	}
+	return fmt.Sprintf("host key for %s changed: presented %s, known %s", e.Host, ssh.FingerprintSHA256(e.Key), strings.Join(known, ", "))
+}
+
+// knownHostsCallback returns a host key callback checking the files that
+// exist among files, which reports changed keys with HostKeyChangedError.
+func knownHostsCallback(files ...string) (ssh.HostKeyCallback, error) {
+	existing := existingFiles(files)
+	if len(existing) == 0 {
+		return nil, errors.Errorf("no known_hosts file found in %s", strings.Join(files, ", "))
+	}
+	callback, err := knownhosts.New(existing...)
+	if err != nil {
+		return nil, err
+	}
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(host, remote, key)
+		if keyErr, ok := err.(*knownhosts.KeyError); ok && len(keyErr.Want) > 0 {
+			return &HostKeyChangedError{Host: host, Key: key, Known: keyErr.Want}
+		}
+		return err
+	}, nil
+}
+
+// existingFiles returns the files among files that exist, expanding a leading
+// "~/" to the user's home directory.
+func existingFiles(files []string) []string {
+	var existing []string
+	for _, file := range files {
+		file = expandHome(file)
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+// expandHome replaces a leading "~/" in path with the user's home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// TrustOnFirstUse is like AllowKnownHosts, but the key of a host that is not
+// yet listed is accepted and appended to the first of knownHosts, which is
+// created if needed. Later connections must present the same key. Keys that
+// have changed are still rejected with HostKeyChangedError.
+func TrustOnFirstUse(knownHosts ...string) Option {
+	return func(config *ssh.ClientConfig) error {
+		if len(knownHosts) == 0 {
+			return errors.New("TrustOnFirstUse requires a known_hosts file")
+		}
+		var mu sync.Mutex
+		config.HostKeyCallback = func(host string, remote net.Addr, key ssh.PublicKey) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(existingFiles(knownHosts)) > 0 {
+				// Files are read on every connection to see keys
+				// recorded since.
+				callback, err := knownHostsCallback(knownHosts...)
+				if err != nil {
+					return err
+				}
+				err = callback(host, remote, key)
+				if keyErr, ok := err.(*knownhosts.KeyError); !ok || len(keyErr.Want) > 0 {
+					return err
+				}
+			}
+			return AddKnownHost(expandHome(knownHosts[0]), key, false, host)
+		}
+		return nil
+	}
+}
+
+// AcceptChangedHostKey wraps the host key callback set by an earlier option,
+// such as AllowKnownHosts, so that a changed host key is accepted if accept
+// returns true, for intentional device replacements. accept may also update
+// known_hosts, for example with RemoveKnownHost and AddKnownHost.
+func AcceptChangedHostKey(accept func(*HostKeyChangedError) bool) Option {
+	return func(config *ssh.ClientConfig) error {
+		next := config.HostKeyCallback
+		if next == nil {
+			return errors.New("AcceptChangedHostKey requires a host key option before it")
+		}
+		config.HostKeyCallback = func(host string, remote net.Addr, key ssh.PublicKey) error {
+			err := next(host, remote, key)
+			if changed, ok := err.(*HostKeyChangedError); ok && accept(changed) {
+				return nil
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// AddKnownHost appends a line trusting key for addrs to the known_hosts file
+// at path, creating the file if it does not exist. It is meant for keys that
+// have been verified out of band. If hash is set, the host names are hashed,
+// one per line, as with ssh-keygen -H, so the file does not reveal them.
+func AddKnownHost(path string, key ssh.PublicKey, hash bool, addrs ...string) error {
+	if len(addrs) == 0 {
+		return errors.New("no addresses to add")
+	}
+	hosts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		hosts[i] = knownhosts.Normalize(addr)
+	}
+	lines := knownhosts.Line(hosts, key) + "\n"
+	if hash {
+		// A hashed entry may only name one host.
+		lines = ""
+		for _, host := range hosts {
+			lines += knownhosts.Line([]string{knownhosts.HashHostname(host)}, key) + "\n"
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open known_hosts")
+	}
+	if _, err := f.WriteString(lines); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write known_hosts")
+	}
+	return errors.Wrap(f.Close(), "failed to write known_hosts")
+}
+
+// RemoveKnownHost removes every line of the known_hosts file at path that
+// names addr, including lines with hashed host names, as with ssh-keygen -R.
+// It returns the number of lines removed. Lines that match addr only through
+// wildcard patterns are kept.
+func RemoveKnownHost(path, addr string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read known_hosts")
+	}
+	host := knownhosts.Normalize(addr)
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if knownHostMatches(line, host) {
+			removed++
+			continue
+		}
+		kept.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Wrap(err, "failed to read known_hosts")
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, writeFileAtomic(path, kept.Bytes())
+}
+
+// knownHostMatches reports whether a known_hosts line names the normalized
+// host, either in plain text or hashed.
+func knownHostMatches(line, host string) bool {
+	fields := strings.Fields(line)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		fields = fields[1:]
+	}
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	for _, pattern := range strings.Split(fields[0], ",") {
+		if strings.HasPrefix(pattern, "|1|") {
+			if hashMatches(pattern, host) {
+				return true
+			}
+		} else if knownhosts.Normalize(pattern) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// hashMatches reports whether a hashed host name of the form |1|salt|hash
+// is host.
+func hashMatches(hashed, host string) bool {
+	parts := strings.Split(hashed, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers never
+// see a partially written file. The file keeps its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), path), "failed to replace %s", path)
+}
@@ -0,0 +1,206 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Locker serializes configuration changes to a device across automation jobs.
+// Run acquires a lock named after the device before sending commands that
+// enter configuration mode, and releases it when the session ends. A
+// persistent session releases it once it is back out of configuration mode,
+// as told by the driver's drivers.ConfigPrompter, and otherwise holds it
+// until the session ends.
+//
+// Implementations backed by shared stores, such as Redis or etcd, can extend
+// the protection across hosts; MemoryLocker and FileLocker cover a single
+// process and a single machine.
+type Locker interface {
+	// Lock blocks until the named lock is acquired or ctx is done.
+	Lock(ctx context.Context, name string) error
+
+	// Unlock releases the named lock.
+	Unlock(name string) error
+}
+
+// DefaultLocker is the Locker used by devices that do not set one.
+var DefaultLocker Locker = NewMemoryLocker()
+
+// configMode matches commands that enter configuration mode on common
+// platforms, such as "configure terminal", "conf t", "configure session
+// NAME", and "edit", for devices whose driver does not say how to enter it.
+var configMode = regexp.MustCompile(`(?i)^\s*(?:conf(?:i(?:g(?:u(?:r(?:e)?)?)?)?)?|edit)(?:\s+.*)?$`)
+
+// entersConfig reports whether any of cmds enters configuration mode. With a
+// driver that has commands entering configuration mode, a command does if its
+// first word is the first word of one of them, or an abbreviation of at least
+// four letters, so that "config t" and "configure session NAME" count where
+// "configure terminal" enters it. Otherwise configMode decides.
+func (d *Device) entersConfig(cmds []string) bool {
+	var enter []string
+	if drv := d.driver(); drv != nil {
+		enter, _ = drv.ConfigMode()
+	}
+	for _, cmd := range cmds {
+		if len(enter) == 0 && configMode.MatchString(cmd) {
+			return true
+		}
+		for _, e := range enter {
+			if abbreviates(firstWord(cmd), firstWord(e)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// abbreviates reports whether word is keyword or an abbreviation of it at
+// least four letters long, ignoring case.
+func abbreviates(word, keyword string) bool {
+	if word == "" || (len(word) < 4 && len(word) < len(keyword)) || len(word) > len(keyword) {
+		return false
+	}
+	return strings.EqualFold(word, keyword[:len(word)])
+}
+
+// firstWord returns the first word of cmd.
+func firstWord(cmd string) string {
+	if fields := strings.Fields(cmd); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// lock acquires the device's configuration lock, waiting at most LockTimeout,
+// and returns a function that releases it.
+func (d *Device) lock() (unlock func(), err error) {
+	locker := d.Locker
+	if locker == nil {
+		locker = DefaultLocker
+	}
+	timeout := d.LockTimeout
+	if timeout <= 0 {
+		timeout = d.timeout()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	name := d.String()
+	if err := locker.Lock(ctx, name); err != nil {
+		return nil, errors.Wrapf(err, "failed to lock %s", name)
+	}
+	return func() { locker.Unlock(name) }, nil
+}
+
+// MemoryLocker is a Locker for the current process.
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// NewMemoryLocker returns an in-memory Locker.
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]chan struct{})}
+}
+
+// lockChan returns the channel guarding the named lock.
+func (l *MemoryLocker) lockChan(name string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch, ok := l.locks[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		l.locks[name] = ch
+	}
+	return ch
+}
+
+// Lock implements Locker.
+func (l *MemoryLocker) Lock(ctx context.Context, name string) error {
+	select {
+	case l.lockChan(name) <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock implements Locker.
+func (l *MemoryLocker) Unlock(name string) error {
+	select {
+	case <-l.lockChan(name):
+		return nil
+	default:
+		return errors.Errorf("%s is not locked", name)
+	}
+}
+
+// FileLocker is a Locker for the processes on one machine. Each lock is a file
+// in Dir that is created exclusively and removed on unlock. Locks left behind
+// by a process that died must be removed by hand.
+type FileLocker struct {
+	Dir string
+
+	// Interval is how often Lock retries a held lock. It defaults to one
+	// second.
+	Interval time.Duration
+}
+
+func (l *FileLocker) path(name string) string {
+	return filepath.Join(l.Dir, url.PathEscape(name)+".lock")
+}
+
+// Lock implements Locker.
+func (l *FileLocker) Lock(ctx context.Context, name string) error {
+	interval := l.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		f, err := os.OpenFile(l.path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "pid %d at %s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+			return f.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Unlock implements Locker.
+func (l *FileLocker) Unlock(name string) error {
+	return os.Remove(l.path(name))
+}
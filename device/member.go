@@ -0,0 +1,99 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+)
+
+// RunOn runs cmds on a member of a switch stack or chassis, such as "2" or
+// "other-routing-engine", by moving the session to the member with the
+// driver's commands, running cmds there, and returning to the primary. The
+// device's driver must implement drivers.MemberSwitcher.
+//
+// The Commands of the returned Result describe only cmds, not the commands
+// that moved between members.
+func (d *Device) RunOn(member string, cmds ...string) (*Result, error) {
+	switcher, ok := d.driver().(drivers.MemberSwitcher)
+	if !ok {
+		return nil, errors.Errorf("%s: driver does not support stack members", d)
+	}
+	enter, exit := switcher.Member(member)
+	if len(enter) == 0 {
+		return nil, errors.Errorf("%s: platform has no stack members", d)
+	}
+	return d.runBetween(enter, cmds, exit)
+}
+
+// RunIn runs cmds in a command mode of the device, such as "admin" on IOS
+// XR, by entering the mode with the driver's commands, running cmds there,
+// and leaving it. The device's driver must implement drivers.ModeSwitcher.
+// Like those of RunOn, the Commands of the returned Result describe only
+// cmds.
+func (d *Device) RunIn(mode string, cmds ...string) (*Result, error) {
+	switcher, ok := d.driver().(drivers.ModeSwitcher)
+	if !ok {
+		return nil, errors.Errorf("%s: driver does not support command modes", d)
+	}
+	enter, exit := switcher.Mode(mode)
+	if len(enter) == 0 {
+		return nil, errors.Errorf("%s: platform has no %s mode", d, mode)
+	}
+	return d.runBetween(enter, cmds, exit)
+}
+
+// RunInContext runs cmds in a context of a virtualized device, such as a
+// security context of an ASA, by changing to the context with the driver's
+// commands, running cmds there, and returning to the system context; use
+// "system" to run cmds in the system context itself. The device's driver
+// must implement drivers.ContextSwitcher.
+func (d *Device) RunInContext(context string, cmds ...string) (*Result, error) {
+	switcher, ok := d.driver().(drivers.ContextSwitcher)
+	if !ok {
+		return nil, errors.Errorf("%s: driver does not support contexts", d)
+	}
+	enter, exit := switcher.Context(context)
+	if len(enter) == 0 {
+		return nil, errors.Errorf("%s: platform has no contexts", d)
+	}
+	return d.runBetween(enter, cmds, exit)
+}
+
+// runBetween runs cmds preceded by enter and followed by exit, as runSession
+// does, returning a Result describing only cmds.
+func (d *Device) runBetween(enter, cmds, exit []string) (*Result, error) {
+	all := append(append(append([]string(nil), enter...), cmds...), exit...)
+	result, err := d.runSession(all...)
+	if err != nil {
+		return nil, err
+	}
+	result.Commands = result.Commands[len(enter) : len(enter)+len(cmds)]
+	if d.TrimEcho {
+		bodies := make([][]byte, len(result.Commands))
+		for i, cmd := range result.Commands {
+			bodies[i] = cmd.Output
+		}
+		result.Output = bytes.Join(bodies, nil)
+	}
+	return result, nil
+}
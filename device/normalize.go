@@ -0,0 +1,87 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"github.com/mwalto7/device/drivers"
+	"regexp"
+	"unicode/utf8"
+)
+
+// escapes matches ANSI CSI sequences (colors, cursor movement), OSC sequences
+// (window titles), and two-character escape sequences.
+var escapes = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)|\x1b[@-Z\\\\-_]")
+
+// Normalize cleans up raw terminal output so that it can be matched as plain
+// text. It removes ANSI escape sequences, applies backspaces and carriage
+// returns the way a terminal would (erasing the overwritten text that pagers
+// such as --More-- and progress bars leave behind), converts CRLF and CRCRLF
+// line endings to LF, and drops any other control characters except tabs.
+func Normalize(output []byte) []byte {
+	if bytes.IndexByte(output, 0x1b) >= 0 {
+		output = escapes.ReplaceAll(output, nil)
+	}
+	normalized := make([]byte, 0, len(output))
+	lineStart := 0
+	for i := 0; i < len(output); i++ {
+		switch c := output[i]; {
+		case c == '\n':
+			normalized = append(normalized, c)
+			lineStart = len(normalized)
+		case c == '\r':
+			// Devices often end lines with \r\r\n, so a run of carriage
+			// returns is a line ending unless text follows it, in which case
+			// the text rewrites the line, as with progress bars.
+			for i+1 < len(output) && output[i+1] == '\r' {
+				i++
+			}
+			if i+1 < len(output) && output[i+1] != '\n' {
+				normalized = normalized[:lineStart]
+			}
+		case c == '\b':
+			if len(normalized) > lineStart {
+				_, size := utf8.DecodeLastRune(normalized[lineStart:])
+				normalized = normalized[:len(normalized)-size]
+			}
+		case c == '\t' || c >= 0x20 && c != 0x7f:
+			normalized = append(normalized, c)
+		}
+	}
+	return normalized
+}
+
+// Mask replaces the volatile parts of output, such as timestamps, uptimes, and
+// counters, by applying masks in order, so that output captured at different
+// times or on different devices can be compared.
+func Mask(output string, masks []drivers.Mask) string {
+	for _, mask := range masks {
+		output = mask.Pattern.ReplaceAllString(output, mask.Replacement)
+	}
+	return output
+}
+
+// VolatileMasks returns the masks of the device's driver, or
+// drivers.CommonMasks if it has none, followed by extra.
+func (d *Device) VolatileMasks(extra ...drivers.Mask) []drivers.Mask {
+	masks := append([]drivers.Mask(nil), drivers.VolatileMasks(d.driver())...)
+	return append(masks, extra...)
+}
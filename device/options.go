@@ -0,0 +1,216 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"regexp"
+	"time"
+)
+
+// DeviceOption configures a Device created with Dial or New. Every Option is
+// also a DeviceOption, so SSH settings and device behavior can be given
+// together.
+type DeviceOption interface {
+	apply(d *Device, config *ssh.ClientConfig) error
+}
+
+func (opt Option) apply(d *Device, config *ssh.ClientConfig) error {
+	return opt(config)
+}
+
+// deviceOption is a DeviceOption that only configures the Device.
+type deviceOption func(d *Device)
+
+func (opt deviceOption) apply(d *Device, config *ssh.ClientConfig) error {
+	opt(d)
+	return nil
+}
+
+// WithDriver sets the device's driver.
+func WithDriver(driver drivers.Driver) DeviceOption {
+	return deviceOption(func(d *Device) { d.Driver = driver })
+}
+
+// WithMetadata sets the device's metadata, such as its name and platform.
+func WithMetadata(metadata Metadata) DeviceOption {
+	return deviceOption(func(d *Device) { d.Metadata = metadata })
+}
+
+// WithPrompt sets the pattern matching the device's prompt.
+func WithPrompt(prompt *regexp.Regexp) DeviceOption {
+	return deviceOption(func(d *Device) { d.Prompt = prompt })
+}
+
+// WithCommandTimeout sets how long Run and Ping wait for the device to
+// respond.
+func WithCommandTimeout(timeout time.Duration) DeviceOption {
+	return deviceOption(func(d *Device) { d.CommandTimeout = timeout })
+}
+
+// WithEnable makes sessions enter privileged mode with password.
+func WithEnable(password string) DeviceOption {
+	return deviceOption(func(d *Device) { d.Enable, d.EnablePassword = true, password })
+}
+
+// WithKeepAlive makes the device send keepalive requests every interval.
+func WithKeepAlive(interval time.Duration) DeviceOption {
+	return deviceOption(func(d *Device) { d.KeepAlive = interval })
+}
+
+// WithIdleTimeout closes the device's connection after it has been idle for
+// timeout, reconnecting on the next call to Run.
+func WithIdleTimeout(timeout time.Duration) DeviceOption {
+	return deviceOption(func(d *Device) { d.IdleTimeout = timeout })
+}
+
+// WithAuditLog records the commands run on the device in log.
+func WithAuditLog(log *AuditLog) DeviceOption {
+	return deviceOption(func(d *Device) { d.AuditLog = log })
+}
+
+// WithSyslog sends events about the device to s.
+func WithSyslog(s *Syslog) DeviceOption {
+	return deviceOption(func(d *Device) { d.Syslog = s })
+}
+
+// WithRecorder records the sessions run on the device with r.
+func WithRecorder(r *Recorder) DeviceOption {
+	return deviceOption(func(d *Device) { d.Recorder = r })
+}
+
+// WithDialer connects to the device with dialer.
+func WithDialer(dialer *Dialer) DeviceOption {
+	return deviceOption(func(d *Device) { d.dialer = dialer })
+}
+
+// Dial connects to the device at addr as user. At least one authentication
+// method, such as Password or PrivateKey, must be given. Like NewClientConfig,
+// Dial accepts all host keys unless an option such as AllowKnownHosts says
+// otherwise.
+//
+// If WithDriver or WithMetadata gives the device's driver or platform, the SSH
+// algorithms the driver says its platform may require are added to the
+// defaults, as with PlatformDefaults, before any Option is applied, so that
+// options such as Ciphers and StrictCrypto take precedence.
+func Dial(addr, user string, opts ...DeviceOption) (*Device, error) {
+	return dialDevice(addr, newClientConfig(user), opts)
+}
+
+// DialConfig connects to the device at addr with an SSH client configuration,
+// such as one from NewClientConfig. It is the former form of Dial, and sets
+// up the device as Dial does, applying opts to it and to config.
+//
+// Deprecated: Use Dial.
+func DialConfig(addr string, config *ssh.ClientConfig, opts ...DeviceOption) (*Device, error) {
+	return dialDevice(addr, config, opts)
+}
+
+// dialDevice does the work of Dial and DialConfig, starting from config.
+func dialDevice(addr string, config *ssh.ClientConfig, opts []DeviceOption) (*Device, error) {
+	d := &Device{addr: addr, config: config, dialer: defaultDialer}
+	for _, opt := range opts {
+		if _, ok := opt.(Option); !ok {
+			if err := opt.apply(d, d.config); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if drv := d.driver(); drv != nil {
+		addAlgorithms(d.config, drv.Capabilities().Algorithms)
+	}
+	for _, opt := range opts {
+		if _, ok := opt.(Option); ok {
+			if err := opt.apply(d, d.config); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(d.config.Auth) == 0 {
+		return nil, NoAuthMethodsError
+	}
+	client, err := d.dialer.connect(context.Background(), addr, d.config)
+	if err != nil {
+		d.notify(SeverityError, "failure", "failed to connect as %s: %v", d.config.User, err)
+		return nil, errors.Wrap(err, "failed to dial")
+	}
+	d.Client = client
+	d.notify(SeverityInfo, "connect", "connected as %s", d.config.User)
+	d.startKeepAlive()
+	return d, nil
+}
+
+// New returns a Device that uses an SSH client connected by other means, such
+// as through a custom transport, a tunnel, or a test server. Options that
+// configure the SSH client, such as Password, cannot be used, and devices
+// created with New cannot be reconnected by ReloadAndWait.
+func New(client *ssh.Client, opts ...DeviceOption) (*Device, error) {
+	d := &Device{Client: client, addr: client.RemoteAddr().String()}
+	for _, opt := range opts {
+		if _, ok := opt.(Option); ok {
+			return nil, errors.New("SSH client options cannot be applied to an existing client")
+		}
+		if err := opt.apply(d, nil); err != nil {
+			return nil, err
+		}
+	}
+	d.startKeepAlive()
+	return d, nil
+}
+
+// newClientConfig returns the configuration NewClientConfig starts from.
+func newClientConfig(user string) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+}
+
+// timeout returns how long to wait for the device to respond.
+func (d *Device) timeout() time.Duration {
+	if d.CommandTimeout > 0 {
+		return d.CommandTimeout
+	}
+	return timeout
+}
+
+// startKeepAlive sends keepalive requests over the device's current
+// connection every KeepAlive until one fails, then closes the connection.
+func (d *Device) startKeepAlive() {
+	if d.KeepAlive <= 0 {
+		return
+	}
+	client, interval, timeout := d.client(), d.KeepAlive, d.timeout()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := roundTrip(client, timeout); err != nil {
+				client.Close()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,90 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DangerousCommands match commands that reload devices or destroy their
+// configuration or file systems on common platforms. They do not match the
+// "delete" statements with which Junos and VyOS remove parts of the
+// configuration, only file deletion, such as "delete flash:vlan.dat", a bare
+// "delete", which removes the whole configuration, and the deletion of system
+// images.
+var DangerousCommands = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^\s*reload\b`),
+	regexp.MustCompile(`(?i)^\s*reboot\b`),
+	regexp.MustCompile(`(?i)^\s*write\s+erase\b`),
+	regexp.MustCompile(`(?i)^\s*erase\b`),
+	regexp.MustCompile(`(?i)^\s*format\b`),
+	regexp.MustCompile(`(?i)^\s*delete\s+(?:/\w+\s+)*[\w\-]*:`),
+	regexp.MustCompile(`(?i)^\s*delete\s*$`),
+	regexp.MustCompile(`(?i)^\s*delete\s+system\s+image\b`),
+	regexp.MustCompile(`(?i)^\s*file\s+delete\b`),
+	regexp.MustCompile(`(?i)^\s*request\s+system\s+(?:reboot|halt|power-off|zeroize|storage\s+cleanup)\b`),
+	regexp.MustCompile(`(?i)^\s*load\s+factory-default\b`),
+}
+
+// Policy decides which commands Run may send to a device. Commands are checked
+// before the session starts, so a denied command prevents the whole call from
+// running.
+type Policy struct {
+	// Deny matches commands that are never sent.
+	Deny []*regexp.Regexp
+
+	// Confirm matches commands that are sent only if ConfirmFunc approves
+	// them. If ConfirmFunc is nil, they are denied, which suits unattended
+	// runs.
+	Confirm     []*regexp.Regexp
+	ConfirmFunc func(d *Device, cmd string) bool
+}
+
+// PolicyError is returned by Run when a policy denies a command.
+type PolicyError struct {
+	Command string
+	Pattern string // the pattern that matched the command
+	Reason  string // "denied" or "not confirmed"
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("command %q %s by policy (matched %q)", e.Command, e.Reason, e.Pattern)
+}
+
+// Check returns a *PolicyError if the policy does not allow cmd to be sent to
+// d.
+func (p *Policy) Check(d *Device, cmd string) error {
+	for _, re := range p.Deny {
+		if re.MatchString(cmd) {
+			return &PolicyError{Command: cmd, Pattern: re.String(), Reason: "denied"}
+		}
+	}
+	for _, re := range p.Confirm {
+		if re.MatchString(cmd) {
+			if p.ConfirmFunc == nil || !p.ConfirmFunc(d, cmd) {
+				return &PolicyError{Command: cmd, Pattern: re.String(), Reason: "not confirmed"}
+			}
+			return nil
+		}
+	}
+	return nil
+}
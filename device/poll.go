@@ -0,0 +1,138 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// A Poller runs show commands on devices at an interval and reports only what
+// changed, for lightweight telemetry where SNMP and gNMI are not available.
+type Poller struct {
+	Devices  []*Device
+	Commands []string
+	Interval time.Duration
+
+	// Jitter spreads the polls of different devices over up to this long
+	// after each interval starts, so that they do not all connect at once.
+	// Each device keeps the same offset, derived from its name.
+	Jitter time.Duration
+
+	// MaskVolatile compares output with each device's volatile masks
+	// applied, so that counters and timestamps do not count as changes.
+	MaskVolatile bool
+}
+
+// PollUpdate reports what changed on a device since its previous poll.
+type PollUpdate struct {
+	Device *Device
+	Time   time.Time
+
+	// Output holds the output of the commands that changed, keyed by
+	// command. On a device's first successful poll it holds every command.
+	Output map[string]string
+
+	// Err is why the poll failed. A failure is reported once, until the
+	// device is polled successfully or fails differently.
+	Err error
+}
+
+// Run polls the devices until ctx is done, calling emit with each update, one
+// at a time. It returns ctx's error.
+func (p *Poller) Run(ctx context.Context, emit func(PollUpdate)) error {
+	if p.Interval <= 0 {
+		return errors.New("poll interval must be positive")
+	}
+	if len(p.Commands) == 0 {
+		return errors.New("no commands to poll")
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, d := range p.Devices {
+		wg.Add(1)
+		go func(d *Device) {
+			defer wg.Done()
+			p.poll(ctx, d, func(update PollUpdate) {
+				mu.Lock()
+				defer mu.Unlock()
+				emit(update)
+			})
+		}(d)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// poll polls d until ctx is done.
+func (p *Poller) poll(ctx context.Context, d *Device, emit func(PollUpdate)) {
+	timer := time.NewTimer(p.offset(d))
+	defer timer.Stop()
+	var last map[string]string // masked output of the last successful poll
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		timer.Reset(p.Interval)
+		snap, err := d.Snapshot(p.Commands...)
+		if err != nil {
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				emit(PollUpdate{Device: d, Time: time.Now(), Err: err})
+			}
+			continue
+		}
+		lastErr = ""
+		var masks []drivers.Mask
+		if p.MaskVolatile {
+			masks = d.VolatileMasks()
+		}
+		current := make(map[string]string, len(p.Commands))
+		changed := make(map[string]string)
+		for _, cmd := range p.Commands {
+			current[cmd] = Mask(snap.Output[cmd], masks)
+			if prev, ok := last[cmd]; !ok || prev != current[cmd] {
+				changed[cmd] = snap.Output[cmd]
+			}
+		}
+		last = current
+		if len(changed) > 0 {
+			emit(PollUpdate{Device: d, Time: snap.Time, Output: changed})
+		}
+	}
+}
+
+// offset returns how long after each interval starts d is polled.
+func (p *Poller) offset(d *Device) time.Duration {
+	if p.Jitter <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(d.String()))
+	return time.Duration(float64(p.Jitter) * float64(h.Sum32()) / (1 << 32))
+}
@@ -0,0 +1,120 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Recorder writes sessions in asciinema v2 format, so that sessions run by
+// automation can be replayed with an asciinema player. Set a Device's Recorder
+// field to record every session it runs; sessions are appended to the same
+// recording one after another.
+//
+// Passwords set by commands are redacted from recorded input as in audit
+// logs, and answers to login, password change, and enable prompts are not
+// recorded at all. The device's echo of a command is recorded as output
+// unchanged.
+//
+// A Recorder is safe for concurrent use, but output from concurrent sessions
+// is interleaved.
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	err   error
+}
+
+// NewRecorder writes an asciinema v2 header for a terminal of the given size
+// to w and returns a Recorder that appends events to it.
+func NewRecorder(w io.Writer, width, height int) (*Recorder, error) {
+	start := time.Now()
+	header, err := json.Marshal(struct {
+		Version   int   `json:"version"`
+		Width     int   `json:"width"`
+		Height    int   `json:"height"`
+		Timestamp int64 `json:"timestamp"`
+	}{2, width, height, start.Unix()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode recording header")
+	}
+	if _, err := w.Write(append(header, '\n')); err != nil {
+		return nil, errors.Wrap(err, "failed to write recording header")
+	}
+	return &Recorder{w: w, start: start}, nil
+}
+
+// Err returns the first error encountered while writing the recording.
+// Recording errors never cause a session to fail.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// event appends an event of the given type ("o" for output, "i" for input).
+func (r *Recorder) event(kind string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, kind, string(data)})
+	if err == nil {
+		_, err = r.w.Write(append(line, '\n'))
+	}
+	if err != nil {
+		r.err = errors.Wrap(err, "failed to write recording")
+	}
+}
+
+// stream returns a writer that records everything written to it as events of
+// the given type.
+func (r *Recorder) stream(kind string) io.Writer {
+	return recorderStream{r, kind}
+}
+
+type recorderStream struct {
+	r    *Recorder
+	kind string
+}
+
+func (s recorderStream) Write(p []byte) (int, error) {
+	s.r.event(s.kind, p)
+	return len(p), nil
+}
+
+// recordedInput is a shell's standard input with what is written to it
+// recorded.
+type recordedInput struct {
+	stdin  io.Writer
+	record io.Writer
+}
+
+func (in *recordedInput) Write(p []byte) (int, error) {
+	io.WriteString(in.record, redact(string(p)))
+	return in.stdin.Write(p)
+}
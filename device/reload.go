@@ -0,0 +1,173 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"time"
+)
+
+// ReloadAndWait reloads the device with the command of its driver's
+// drivers.Reloader, or with an IOS-style "reload" if it has no driver, waits
+// for the device to drop the connection, and then polls until it accepts SSH
+// connections again. On success the Device is reconnected using the address
+// and configuration it was dialed with. Changes that would trigger a save
+// prompt should be saved before reloading.
+//
+// The reload command and the answers to its prompts are sent in a session of
+// their own, ended with "exit", without waiting for the prompt in between,
+// even if the device is Persistent or sets AutoPage or Retries, since the
+// device asks for confirmation rather than returning to its prompt. The
+// persistent session, if any, is closed first.
+//
+// Errors from running the reload command, such as a PolicyError or a
+// RejectedError for a refused command, are returned at once, except for those
+// caused by the device dropping the connection and TimeoutError, since some
+// platforms take a while to close sessions once they start shutting down.
+//
+// ReloadAndWait must not be called while other goroutines are using the Device.
+func (d *Device) ReloadAndWait(timeout time.Duration) error {
+	if d.config == nil {
+		return errors.New("device was not dialed and cannot be reconnected")
+	}
+	cmds := []string{"reload", ""}
+	if drv := d.driver(); drv != nil {
+		reloader, ok := drv.(drivers.Reloader)
+		if !ok || len(reloader.Reload()) == 0 {
+			return errors.Errorf("%s: platform has no reload command", d)
+		}
+		cmds = append([]string(nil), reloader.Reload()...)
+	}
+	deadline := time.Now().Add(timeout)
+
+	d.CloseSession()
+	result, err := d.runWith(append(cmds, "exit"), d.sendReload)
+	if err == nil {
+		err = d.rejection(result)
+	}
+	if err != nil && !disconnected(err) {
+		return errors.Wrap(err, "failed to reload")
+	}
+
+	closed := make(chan error, 1)
+	go func(closed chan<- error) {
+		closed <- d.client().Wait()
+	}(closed)
+	select {
+	case <-closed:
+	case <-time.After(time.Until(deadline)):
+		d.client().Close()
+		return errors.Wrap(TimeoutError, "device did not reload")
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	dialer := d.dialer
+	if dialer == nil {
+		dialer = defaultDialer
+	}
+	netdev, err := dialer.WaitForSSH(ctx, d.addr, d.config, 5*time.Second)
+	if err != nil {
+		d.notify(SeverityError, "failure", "failed to reconnect after reload: %v", err)
+		return err
+	}
+	d.setClient(netdev.Client)
+	d.notify(SeverityInfo, "connect", "reconnected as %s after reload", d.config.User)
+	d.startKeepAlive()
+	return nil
+}
+
+// sendReload sends cmds, the reload command and the answers to its prompts,
+// in a session of their own without waiting for the prompt between them. It
+// pauses CommandDelay between commands like Run.
+func (d *Device) sendReload(cmds []string) (*Result, error) {
+	if err := d.permit(cmds); err != nil {
+		return nil, err
+	}
+	release := d.acquire()
+	defer release()
+	result := d.newResult(cmds)
+	sh, err := d.openShell()
+	if err != nil {
+		return nil, err
+	}
+	defer sh.close()
+	for i, cmd := range cmds {
+		line, err := d.encodeLine(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && d.CommandDelay > 0 {
+			time.Sleep(d.CommandDelay)
+		}
+		result.Commands[i] = CommandResult{Command: cmd, Sent: time.Now()}
+		if err := d.send(sh.out, line); err != nil {
+			return nil, errors.Wrapf(err, "failed to run %q", cmd)
+		}
+	}
+	return d.await(sh, result, cmds)
+}
+
+// disconnected reports whether err is what Run returns when the device drops
+// the connection or keeps the session open while it shuts down.
+func disconnected(err error) bool {
+	switch errors.Cause(err) {
+	case io.EOF, TimeoutError:
+		return true
+	}
+	return false
+}
+
+// WaitForSSH dials addr every interval until the remote host completes an SSH
+// handshake and authenticates the client, or until ctx is done. It is useful
+// after reloads, power cycles, and zero-touch provisioning, when the device
+// may accept TCP connections well before its SSH service is ready. The
+// connected Device is returned.
+//
+// Refused authentication counts against the dialer's Breaker, and WaitForSSH
+// returns the BreakerOpenError at once if the breaker opens for addr, rather
+// than retrying credentials an AAA server may be locking out. Handshakes the
+// host drops while its SSH service starts are not counted.
+func WaitForSSH(ctx context.Context, addr string, config *ssh.ClientConfig, interval time.Duration) (*Device, error) {
+	return defaultDialer.WaitForSSH(ctx, addr, config, interval)
+}
+
+// WaitForSSH is like the package-level WaitForSSH but dials with dl.
+func (dl *Dialer) WaitForSSH(ctx context.Context, addr string, config *ssh.ClientConfig, interval time.Duration) (*Device, error) {
+	for {
+		client, err := dl.connect(ctx, addr, config)
+		if err == nil {
+			return &Device{Client: client, addr: addr, config: config, dialer: dl}, nil
+		}
+		if _, ok := err.(*BreakerOpenError); ok {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "%s did not become reachable: %v", addr, err)
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+)
+
+// Result is the outcome of a call to Run.
+type Result struct {
+	// Output is the combined output of the remote shell's standard output and
+	// standard error, normalized unless RawOutput is set and trimmed if
+	// TrimEcho is set.
+	Output []byte
+
+	// Commands holds the timing, and where possible the output, of each
+	// command in the order they were run.
+	Commands []CommandResult
+
+	// Metadata describes the device the commands were run on, so that
+	// results from a fleet can be attributed to its inventory.
+	Metadata Metadata
+
+	Start    time.Time     // when the session was opened
+	Duration time.Duration // how long the session was open
+
+	BytesSent     int64 // bytes written to standard input
+	BytesReceived int64 // bytes read from standard output and standard error
+
+	Cipher     string   // cipher negotiated for the connection, if known
+	RemoteAddr net.Addr // address of the remote device
+
+	// Spool is the path of the temporary file holding the output if it was
+	// larger than the device's SpoolThreshold, in which case Output is nil.
+	// Close removes the file.
+	Spool string
+}
+
+// CommandResult describes a single command in a Result.
+type CommandResult struct {
+	Command string
+
+	// Output is the device's response to the command, without the echoed
+	// command line or prompt. It is nil if the response could not be told
+	// apart from the responses to other commands.
+	Output []byte
+
+	// Sent is when the command was written to the remote shell. Duration is
+	// measured from then until the device printed its next prompt when
+	// AutoPage is set, and until the next command was sent or the session
+	// ended otherwise.
+	Sent     time.Time
+	Duration time.Duration
+}
+
+// Open returns a reader for the output, whether it was spooled or is held in
+// Output.
+func (r *Result) Open() (io.ReadCloser, error) {
+	if r.Spool == "" {
+		return ioutil.NopCloser(bytes.NewReader(r.Output)), nil
+	}
+	f, err := os.Open(r.Spool)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open spooled output")
+	}
+	return f, nil
+}
+
+// Close removes the file output was spooled to, if any.
+func (r *Result) Close() error {
+	if r.Spool == "" {
+		return nil
+	}
+	return errors.Wrap(os.Remove(r.Spool), "failed to remove spooled output")
+}
+
+// String returns the output as a string. It is empty if the output was
+// spooled.
+func (r *Result) String() string {
+	return string(r.Output)
+}
@@ -0,0 +1,284 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"context"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shell is a remote shell session ready for commands.
+type shell struct {
+	session   *ssh.Session
+	stdin     io.WriteCloser
+	out       *collector
+	errOutput chan []byte // receives standard error once the session ends
+	setup     []string    // setup commands sent when the shell was opened
+
+	lockMu sync.Mutex
+	unlock func() // releases the configuration lock the session holds, if any
+}
+
+// output returns what the device has sent so far.
+func (sh *shell) output() []byte {
+	if sh.out == nil {
+		return nil
+	}
+	return sh.out.since(0)
+}
+
+// close ends the session.
+func (sh *shell) close() {
+	sh.stdin.Close()
+	sh.session.Close()
+	sh.release()
+}
+
+// hold records that the session holds the configuration lock until release
+// calls unlock.
+func (sh *shell) hold(unlock func()) {
+	sh.lockMu.Lock()
+	defer sh.lockMu.Unlock()
+	sh.unlock = unlock
+}
+
+// holds reports whether the session holds the configuration lock.
+func (sh *shell) holds() bool {
+	sh.lockMu.Lock()
+	defer sh.lockMu.Unlock()
+	return sh.unlock != nil
+}
+
+// release releases the configuration lock, if the session holds it.
+func (sh *shell) release() {
+	sh.lockMu.Lock()
+	defer sh.lockMu.Unlock()
+	if sh.unlock != nil {
+		sh.unlock()
+		sh.unlock = nil
+	}
+}
+
+// openShell starts a shell session and prepares it for commands, retrying as
+// configured by Busy if the device has no free lines.
+func (d *Device) openShell() (*shell, error) {
+	for attempt := 0; ; attempt++ {
+		sh, err := d.tryShell()
+		if _, ok := err.(*BusyError); !ok || attempt >= d.Busy.Retries {
+			return sh, err
+		}
+		if err := d.Busy.wait(context.Background(), attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryShell starts a shell session and prepares it for commands: it connects
+// through the console server, wakes the device, logs in, and sends the
+// driver's setup commands, as configured.
+func (d *Device) tryShell() (sh *shell, err error) {
+	session, err := d.client().NewSession()
+	if err != nil {
+		if busy := busyError(d.String(), err, nil); busy != nil {
+			return nil, busy
+		}
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+	stdin, stdout, stderr, err := pipeIO(session)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	sh = &shell{session: session, stdin: stdin, errOutput: make(chan []byte, 1)}
+	// The returns below set sh to nil, so close the shell through a copy.
+	opened := sh
+	defer func() {
+		if err != nil {
+			opened.close()
+			if busy := busyError(d.String(), err, opened.output()); busy != nil {
+				err = busy
+			}
+		}
+	}()
+	if err := session.Shell(); err != nil {
+		return nil, errors.Wrap(err, "failed to start remote shell")
+	}
+	var in io.Writer = stdin
+	if d.Recorder != nil {
+		in = &recordedInput{stdin: stdin, record: d.Recorder.stream("i")}
+		stdout = io.TeeReader(stdout, d.Recorder.stream("o"))
+		stderr = io.TeeReader(stderr, d.Recorder.stream("o"))
+	}
+	var prompt *regexp.Regexp
+	wake := d.Wake
+	drv := d.driver()
+	if drv != nil {
+		prompt, sh.setup = drv.Prompt(), drv.Setup()
+		if w, ok := drv.(drivers.Waker); ok && wake == "" {
+			wake = w.Wake()
+		}
+	}
+	if d.Prompt != nil {
+		prompt = d.Prompt
+	}
+	out := newCollector(in, stdout, prompt, d.pager())
+	sh.out = out
+	go func(errOutput chan<- []byte) {
+		output, _ := readAll(stderr)
+		errOutput <- output
+	}(sh.errOutput)
+
+	from := 0
+	if d.Console != nil {
+		if err := d.Console.hop(out, prompt, d.lineEnding(), d.timeout()); err != nil {
+			return nil, err
+		}
+		from = out.len()
+	}
+	if wake != "" {
+		from = out.len()
+		if err := out.write(wake); err != nil {
+			return nil, errors.Wrap(err, "failed to wake device")
+		}
+		if err := out.waitPrompt(from, time.Now().Add(d.timeout())); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.login(out, drv, from); err != nil {
+		return nil, err
+	}
+	if err := d.changePassword(out, from); err != nil {
+		return nil, err
+	}
+	if err := d.enable(out, drv, from); err != nil {
+		return nil, err
+	}
+	// A pager swallows commands typed ahead of it, so with AutoPage each
+	// command is sent only once the device is back at its prompt.
+	if wake == "" && d.stepwise() {
+		i, err := out.expect(from, time.Now().Add(d.timeout()), out.prompt)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			return nil, errors.Wrap(io.EOF, "session ended before the prompt")
+		}
+	}
+	for _, cmd := range sh.setup {
+		if err := d.sendCommand(out, cmd); err != nil {
+			return nil, err
+		}
+	}
+	return sh, nil
+}
+
+// runShared runs cmds in the persistent session, opening it if needed.
+func (d *Device) runShared(cmds []string) (*Result, error) {
+	d.shellMu.Lock()
+	defer d.shellMu.Unlock()
+	result := d.newResult(cmds)
+	if d.shared != nil && d.shared.out.finished() {
+		d.shared.close()
+		d.shared = nil
+	}
+	if d.shared == nil {
+		// The shared session takes a MaxSessions slot for as long as it is
+		// open, like any other.
+		slot := d.acquire()
+		sh, err := d.openShell()
+		if err != nil {
+			slot()
+			return nil, err
+		}
+		// Release the configuration lock and the slot even if the session
+		// ends without CloseSession, such as when the connection drops.
+		go func(sh *shell) {
+			sh.session.Wait()
+			sh.release()
+			slot()
+		}(sh)
+		d.shared = sh
+	}
+	sh := d.shared
+	// The lock is held from the command entering configuration mode until
+	// the session is seen to have left it.
+	if !sh.holds() && d.entersConfig(cmds) {
+		unlock, err := d.lock()
+		if err != nil {
+			return nil, err
+		}
+		sh.hold(unlock)
+	}
+	mark, sent := sh.out.mark(), atomic.LoadInt64(&sh.out.sent)
+	if err := d.sendCommands(sh.out, result, cmds); err != nil {
+		// The session is in an unknown state, so start over next time.
+		sh.close()
+		d.shared = nil
+		return nil, err
+	}
+	if inConfig, known := d.inConfigMode(sh); known && !inConfig {
+		sh.release()
+	}
+	result.BytesSent = atomic.LoadInt64(&sh.out.sent) - sent
+	return d.finish(result, sh.out.since(mark), nil, cmds)
+}
+
+// CloseSession ends the persistent session opened by Run when Persistent is
+// set. The next call to Run opens a new one.
+func (d *Device) CloseSession() {
+	d.shellMu.Lock()
+	defer d.shellMu.Unlock()
+	if d.shared != nil {
+		d.shared.close()
+		d.shared = nil
+	}
+}
+
+// InConfigMode reports whether the persistent session is at the prompt of
+// configuration mode, as told by the driver's drivers.ConfigPrompter. It is
+// false when no persistent session is open, since a new session starts in
+// operational mode.
+func (d *Device) InConfigMode() bool {
+	d.shellMu.Lock()
+	defer d.shellMu.Unlock()
+	if d.shared == nil {
+		return false
+	}
+	inConfig, _ := d.inConfigMode(d.shared)
+	return inConfig
+}
+
+// inConfigMode reports whether sh is at the prompt of configuration mode and
+// whether the driver can tell.
+func (d *Device) inConfigMode(sh *shell) (inConfig, known bool) {
+	prompter, ok := d.driver().(drivers.ConfigPrompter)
+	if !ok || prompter.ConfigPrompt() == nil {
+		return false, false
+	}
+	return prompter.ConfigPrompt().Match(sh.out.current()), true
+}
@@ -0,0 +1,146 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"encoding/json"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Snapshot is the output of a set of show commands captured at one point in
+// time, such as before and after a change. Snapshots can be stored as JSON
+// and compared later with CompareSnapshots.
+type Snapshot struct {
+	Device   string            `json:"device"`
+	Metadata Metadata          `json:"metadata"`
+	Time     time.Time         `json:"time"`
+	Commands []string          `json:"commands"`
+	Output   map[string]string `json:"output"` // keyed by command
+}
+
+// Snapshot runs cmds as one call to Run, ending the session with "exit" unless
+// the device is Persistent, and captures the output of each. The device must
+// echo commands for their output to be told apart.
+func (d *Device) Snapshot(cmds ...string) (*Snapshot, error) {
+	result, err := d.runSession(cmds...)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		Device:   d.String(),
+		Metadata: d.Metadata,
+		Time:     result.Start,
+		Commands: cmds,
+		Output:   make(map[string]string, len(cmds)),
+	}
+	for i, cmd := range result.Commands[:len(cmds)] {
+		if cmd.Output == nil && len(cmds) > 1 {
+			return nil, errors.Errorf("%s: could not separate the output of %q", d, cmd.Command)
+		}
+		snap.Output[cmds[i]] = string(cmd.Output)
+	}
+	if len(cmds) == 1 && result.Commands[0].Output == nil {
+		snap.Output[cmds[0]] = string(result.Output)
+	}
+	return snap, nil
+}
+
+// ReadSnapshot reads a snapshot stored with Snapshot.Write.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	snap := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(snap); err != nil {
+		return nil, errors.Wrap(err, "failed to read snapshot")
+	}
+	return snap, nil
+}
+
+// Write stores s as JSON.
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(s), "failed to write snapshot")
+}
+
+// Mask returns a copy of s with masks applied to the output of every command,
+// so that differences in volatile content are not reported when comparing.
+func (s *Snapshot) Mask(masks []drivers.Mask) *Snapshot {
+	masked := *s
+	masked.Output = make(map[string]string, len(s.Output))
+	for cmd, output := range s.Output {
+		masked.Output[cmd] = Mask(output, masks)
+	}
+	return &masked
+}
+
+// SnapshotDiff describes how the output of one command changed between two
+// snapshots.
+type SnapshotDiff struct {
+	Command string
+	Removed []string // lines only in the first snapshot
+	Added   []string // lines only in the second snapshot
+}
+
+// CompareSnapshots returns the differences between the output of the commands
+// in a and b, in the order the commands were captured. Commands whose output
+// is the same, ignoring trailing whitespace, are left out. A command captured
+// in only one snapshot shows all of its lines as removed or added.
+func CompareSnapshots(a, b *Snapshot) []SnapshotDiff {
+	cmds := append([]string(nil), a.Commands...)
+	for _, cmd := range b.Commands {
+		if _, ok := a.Output[cmd]; !ok {
+			cmds = append(cmds, cmd)
+		}
+	}
+	var diffs []SnapshotDiff
+	for _, cmd := range cmds {
+		diff := SnapshotDiff{Command: cmd}
+		for _, edit := range diffLines(lines(a.Output[cmd]), lines(b.Output[cmd])) {
+			switch edit.op {
+			case '-':
+				diff.Removed = append(diff.Removed, edit.line)
+			case '+':
+				diff.Added = append(diff.Added, edit.line)
+			}
+		}
+		if diff.Removed != nil || diff.Added != nil {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// lines splits output into lines without trailing whitespace, ignoring
+// trailing blank lines.
+func lines(output string) []string {
+	output = strings.TrimRight(output, " \t\r\n")
+	if output == "" {
+		return nil
+	}
+	split := strings.Split(output, "\n")
+	for i, line := range split {
+		split[i] = strings.TrimRight(line, " \t\r")
+	}
+	return split
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// spooler writes the output of a session to a temporary file once it grows
+// past a threshold, so that large outputs are not held in memory.
+type spooler struct {
+	dir       string
+	threshold int
+	clean     func([]byte) ([]byte, error) // applied to output before it is written
+
+	file     *os.File // nil until the threshold is first passed
+	received int64    // bytes spooled, before clean
+	err      error
+}
+
+// newSpooler returns a spooler for Run, or nil if SpoolThreshold is not set.
+func (d *Device) newSpooler() *spooler {
+	if d.SpoolThreshold <= 0 || d.Persistent {
+		return nil
+	}
+	return &spooler{dir: d.SpoolDir, threshold: d.SpoolThreshold, clean: d.clean}
+}
+
+// write appends complete lines of raw output to the spool file, creating it
+// on first use. The first error is kept and later writes are dropped.
+func (s *spooler) write(raw []byte) {
+	if s.err != nil {
+		return
+	}
+	if s.file == nil {
+		if s.file, s.err = ioutil.TempFile(s.dir, "device-output-"); s.err != nil {
+			return
+		}
+	}
+	s.received += int64(len(raw))
+	var cleaned []byte
+	if cleaned, s.err = s.clean(raw); s.err == nil {
+		_, s.err = s.file.Write(cleaned)
+	}
+}
+
+// close writes the rest of the output and closes the spool file. If anything
+// failed, the file is removed.
+func (s *spooler) close(rest []byte) error {
+	s.write(rest)
+	if s.file == nil {
+		return s.err
+	}
+	if err := s.file.Close(); s.err == nil {
+		s.err = err
+	}
+	if s.err != nil {
+		s.discard()
+	}
+	return s.err
+}
+
+// discard closes and removes the spool file, if there is one.
+func (s *spooler) discard() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+)
+
+// RunStatus runs cmd in a session of its own, followed by the command with
+// which the driver's shell reports the exit status, such as $LASTEXITCODE in
+// PowerShell. It returns the output of cmd and its exit status.
+func (d *Device) RunStatus(cmd string) (output string, status int, err error) {
+	statuser, ok := d.driver().(drivers.ExitStatuser)
+	if !ok {
+		return "", 0, errors.Errorf("%s: driver cannot report exit status", d)
+	}
+	show, parse := statuser.ExitStatus()
+	if show == "" {
+		return "", 0, errors.Errorf("%s: driver cannot report exit status", d)
+	}
+	result, err := d.runSession(cmd, show)
+	if err != nil {
+		return "", 0, err
+	}
+	output, statusOutput := string(result.Output), string(result.Output)
+	if result.Commands[0].Output != nil {
+		output, statusOutput = string(result.Commands[0].Output), string(result.Commands[1].Output)
+	}
+	status, ok = parse(statusOutput)
+	if !ok {
+		return output, 0, &ParseError{Device: d.String(), Command: show, Err: errors.New("no exit status in output")}
+	}
+	return output, status, nil
+}
@@ -0,0 +1,192 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severities of the syslog messages Devices send, as defined by RFC 5424.
+const (
+	SeverityError  = 3
+	SeverityNotice = 5
+	SeverityInfo   = 6
+)
+
+// DefaultSyslog, if set, receives the events of every device that does not
+// set its own Syslog.
+var DefaultSyslog *Syslog
+
+// Syslog sends RFC 5424 messages about automation events, such as connecting
+// to a device, changing its configuration, and failing to run commands, to a
+// syslog collector. It is safe for concurrent use.
+type Syslog struct {
+	Hostname string // HOSTNAME field; defaults to the local host name
+	AppName  string // APP-NAME field; defaults to "device"
+	Facility int    // facility code; DialSyslog sets 1, user-level messages
+
+	network, addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+	err  error
+}
+
+// SyslogEvent is a single message sent by a Syslog.
+type SyslogEvent struct {
+	Time     time.Time
+	Severity int    // such as SeverityError
+	MsgID    string // kind of event: "connect", "config", or "failure"
+	Message  string
+}
+
+// DialSyslog connects to the syslog collector at addr. Over datagram
+// networks, such as "udp", each message is sent in its own datagram;
+// over streams, such as "tcp", messages are framed by octet counting as
+// described in RFC 6587.
+func DialSyslog(network, addr string) (*Syslog, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to dial syslog collector")
+	}
+	hostname, _ := os.Hostname()
+	return &Syslog{
+		Hostname: hostname,
+		AppName:  "device",
+		Facility: 1,
+		network:  network,
+		addr:     addr,
+		conn:     conn,
+	}, nil
+}
+
+// Write sends event to the collector. If the connection has failed, Write
+// dials the collector again and retries once.
+func (s *Syslog) Write(event SyslogEvent) error {
+	msg := s.format(event)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.conn.Write(msg)
+	if err != nil {
+		s.conn.Close()
+		var conn net.Conn
+		if conn, err = net.Dial(s.network, s.addr); err == nil {
+			s.conn = conn
+			_, err = s.conn.Write(msg)
+		}
+	}
+	if err != nil {
+		s.err = errors.Wrap(err, "failed to write syslog message")
+		return s.err
+	}
+	return nil
+}
+
+// Err returns the most recent error encountered while sending messages.
+// Syslog failures never cause the operation being reported to fail.
+func (s *Syslog) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close closes the connection to the collector.
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// format returns event as an RFC 5424 message, framed for the network.
+func (s *Syslog) format(event SyslogEvent) []byte {
+	appName := s.AppName
+	if appName == "" {
+		appName = "device"
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		s.Facility*8+event.Severity,
+		event.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogField(s.Hostname, 255),
+		syslogField(appName, 48),
+		os.Getpid(),
+		syslogField(event.MsgID, 32),
+		event.Message,
+	)
+	switch s.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return []byte(msg)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+// syslogField makes s fit a header field of at most max printable ASCII
+// characters, using "-" for an empty field.
+func syslogField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+// notify sends an event about the device to its syslog collector, if it has
+// one.
+func (d *Device) notify(severity int, msgID, format string, args ...interface{}) {
+	s := d.Syslog
+	if s == nil {
+		s = DefaultSyslog
+	}
+	if s == nil {
+		return
+	}
+	s.Write(SyslogEvent{
+		Time:     time.Now(),
+		Severity: severity,
+		MsgID:    msgID,
+		Message:  redact(d.String() + ": " + fmt.Sprintf(format, args...)),
+	})
+}
+
+// notifyRun reports a failed call to Run, or one that changed the device's
+// configuration.
+func (d *Device) notifyRun(cmds []string, err error) {
+	if err != nil {
+		d.notify(SeverityError, "failure", "failed to run commands as %s: %v", d.operator(), err)
+		return
+	}
+	if d.entersConfig(cmds) {
+		d.notify(SeverityNotice, "config", "configuration changed by %s", d.operator())
+	}
+}
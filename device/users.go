@@ -0,0 +1,127 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+// Users returns the names of the local users configured on the device.
+func (d *Device) Users() ([]string, error) {
+	c, err := d.userConfigurer()
+	if err != nil {
+		return nil, err
+	}
+	return d.users(c)
+}
+
+// CreateUser creates the local user, or updates its password and role if it
+// exists, and confirms that the device lists it. The password is redacted
+// from the device's history and audit log.
+func (d *Device) CreateUser(user drivers.LocalUser) error {
+	c, err := d.userConfigurer()
+	if err != nil {
+		return err
+	}
+	if err := d.apply("create users", c.CreateUser(user)); err != nil {
+		return err
+	}
+	names, err := d.users(c)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name == user.Name {
+			return nil
+		}
+	}
+	return errors.Errorf("%s: user %s is not listed after creating it", d, user.Name)
+}
+
+// RemoveUser removes the local user name and confirms that the device no
+// longer lists it. Removing a user that does not exist is not an error.
+func (d *Device) RemoveUser(name string) error {
+	c, err := d.userConfigurer()
+	if err != nil {
+		return err
+	}
+	names, err := d.users(c)
+	if err != nil {
+		return err
+	}
+	if !contains(names, name) {
+		return nil
+	}
+	if err := d.apply("remove users", c.RemoveUser(name)); err != nil {
+		return err
+	}
+	if names, err = d.users(c); err != nil {
+		return err
+	}
+	if contains(names, name) {
+		return errors.Errorf("%s: user %s is still listed after removing it", d, name)
+	}
+	return nil
+}
+
+// AddSSHKey authorizes key to log in as the local user name.
+func (d *Device) AddSSHKey(name string, key ssh.PublicKey) error {
+	c, err := d.userConfigurer()
+	if err != nil {
+		return err
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	return d.apply("install "+key.Type()+" keys", c.AddSSHKey(name, authorizedKey))
+}
+
+// users lists the local users configured on the device with c.
+func (d *Device) users(c drivers.UserConfigurer) ([]string, error) {
+	cmd, parse := c.ListUsers()
+	if cmd == "" {
+		return nil, errors.Errorf("%s: driver cannot list users", d)
+	}
+	output, err := d.show(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parse(output), nil
+}
+
+// userConfigurer returns the device's driver as a UserConfigurer.
+func (d *Device) userConfigurer() (drivers.UserConfigurer, error) {
+	if c, ok := d.driver().(drivers.UserConfigurer); ok {
+		return c, nil
+	}
+	return nil, errors.Errorf("%s: driver cannot manage users", d)
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+)
+
+// placeholder matches a {{name}} variable reference.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// Expand replaces each {{name}} reference in cmds with the value of the named
+// variable. It returns an error naming the first variable that is not defined.
+func Expand(cmds []string, vars map[string]string) ([]string, error) {
+	expanded := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		var missing string
+		expanded[i] = placeholder.ReplaceAllStringFunc(cmd, func(ref string) string {
+			name := placeholder.FindStringSubmatch(ref)[1]
+			value, ok := vars[name]
+			if !ok && missing == "" {
+				missing = name
+			}
+			return value
+		})
+		if missing != "" {
+			return nil, errors.Errorf("undefined variable %q in %q", missing, cmd)
+		}
+	}
+	return expanded, nil
+}
+
+// RunVars expands the variables in cmds and runs them with Run. Variables are
+// looked up in vars, then in the device's Vars, and finally in its metadata as
+// name, platform, and site, so one command list can serve many devices.
+func (d *Device) RunVars(vars map[string]string, cmds ...string) (*Result, error) {
+	merged := map[string]string{
+		"name":     d.Name,
+		"platform": d.Platform,
+		"site":     d.Site,
+	}
+	for name, value := range d.Vars {
+		merged[name] = value
+	}
+	for name, value := range vars {
+		merged[name] = value
+	}
+	expanded, err := Expand(cmds, merged)
+	if err != nil {
+		return nil, err
+	}
+	return d.Run(expanded...)
+}
@@ -0,0 +1,126 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// Check is a condition the output of a command must meet, such as after a
+// change to confirm that it had the intended effect. A check passes if every
+// condition that is set holds.
+type Check struct {
+	Command string
+
+	Contains string         // the output must contain this text
+	Matches  *regexp.Regexp // the output must match this pattern
+
+	// Absent inverts Contains and Matches, so that the output must not
+	// contain the text or match the pattern.
+	Absent bool
+
+	// Func, if set, is called with the output and returns an error if the
+	// output is not as expected, for conditions on parsed fields.
+	Func func(output string) error
+}
+
+// CheckResult is the outcome of a Check.
+type CheckResult struct {
+	Check
+	Err error // nil if the check passed
+}
+
+// Verification is the outcome of the checks passed to Verify, in order.
+type Verification []CheckResult
+
+// Passed reports whether every check passed.
+func (v Verification) Passed() bool {
+	for _, result := range v {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// String reports the outcome of each check, one per line.
+func (v Verification) String() string {
+	var b strings.Builder
+	for _, result := range v {
+		if result.Err != nil {
+			fmt.Fprintf(&b, "FAIL %s: %v\n", result.Command, result.Err)
+		} else {
+			fmt.Fprintf(&b, "PASS %s\n", result.Command)
+		}
+	}
+	return b.String()
+}
+
+// Verify runs the commands of checks in one session, as Snapshot does, and
+// evaluates each check against its command's output. No session is opened if
+// there are no checks. The returned error reports only failures to run the
+// commands; use Passed to learn whether the checks passed.
+func (d *Device) Verify(checks ...Check) (Verification, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+	var cmds []string
+	seen := make(map[string]bool)
+	for _, check := range checks {
+		if !seen[check.Command] {
+			seen[check.Command] = true
+			cmds = append(cmds, check.Command)
+		}
+	}
+	snap, err := d.Snapshot(cmds...)
+	if err != nil {
+		return nil, err
+	}
+	results := make(Verification, len(checks))
+	for i, check := range checks {
+		results[i] = CheckResult{Check: check, Err: check.evaluate(snap.Output[check.Command])}
+	}
+	return results, nil
+}
+
+// evaluate returns an error describing the first condition output does not
+// meet.
+func (c *Check) evaluate(output string) error {
+	if c.Contains != "" && strings.Contains(output, c.Contains) == c.Absent {
+		if c.Absent {
+			return errors.Errorf("output contains %q", c.Contains)
+		}
+		return errors.Errorf("output does not contain %q", c.Contains)
+	}
+	if c.Matches != nil && c.Matches.MatchString(output) == c.Absent {
+		if c.Absent {
+			return errors.Errorf("output matches %q", c.Matches)
+		}
+		return errors.Errorf("output does not match %q", c.Matches)
+	}
+	if c.Func != nil {
+		return c.Func(output)
+	}
+	return nil
+}
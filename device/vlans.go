@@ -0,0 +1,109 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+)
+
+// VLANs returns the VLANs configured on the device.
+func (d *Device) VLANs() ([]drivers.VLAN, error) {
+	c, err := d.vlanConfigurer()
+	if err != nil {
+		return nil, err
+	}
+	return d.vlans(c)
+}
+
+// CreateVLAN creates VLAN id, or renames it if it exists, and confirms that
+// the device lists it. An empty name lets the driver choose a default.
+func (d *Device) CreateVLAN(id int, name string) error {
+	c, err := d.vlanConfigurer()
+	if err != nil {
+		return err
+	}
+	if err := d.apply("create VLANs", c.CreateVLAN(id, name)); err != nil {
+		return err
+	}
+	vlans, err := d.vlans(c)
+	if err != nil {
+		return err
+	}
+	for _, vlan := range vlans {
+		if vlan.ID == id && (name == "" || vlan.Name == name) {
+			return nil
+		}
+	}
+	return errors.Errorf("%s: VLAN %d is not listed after creating it", d, id)
+}
+
+// DeleteVLAN deletes VLAN id and confirms that the device no longer lists it.
+// Deleting a VLAN that does not exist is not an error.
+func (d *Device) DeleteVLAN(id int) error {
+	c, err := d.vlanConfigurer()
+	if err != nil {
+		return err
+	}
+	vlans, err := d.vlans(c)
+	if err != nil {
+		return err
+	}
+	for _, vlan := range vlans {
+		if vlan.ID != id {
+			continue
+		}
+		if err := d.apply("delete VLANs", c.DeleteVLAN(id, vlan.Name)); err != nil {
+			return err
+		}
+		if vlans, err = d.vlans(c); err != nil {
+			return err
+		}
+		for _, vlan := range vlans {
+			if vlan.ID == id {
+				return errors.Errorf("%s: VLAN %d is still listed after deleting it", d, id)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// vlans lists the VLANs configured on the device with c.
+func (d *Device) vlans(c drivers.VLANConfigurer) ([]drivers.VLAN, error) {
+	cmd, parse := c.ListVLANs()
+	if cmd == "" {
+		return nil, errors.Errorf("%s: driver cannot list VLANs", d)
+	}
+	output, err := d.show(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parse(output), nil
+}
+
+// vlanConfigurer returns the device's driver as a VLANConfigurer.
+func (d *Device) vlanConfigurer() (drivers.VLANConfigurer, error) {
+	if c, ok := d.driver().(drivers.VLANConfigurer); ok {
+		return c, nil
+	}
+	return nil, errors.Errorf("%s: driver cannot configure VLANs", d)
+}
@@ -0,0 +1,106 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package device
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// RunXML runs the show command cmd in a session of its own, asking the device
+// to print its output as XML, and decodes the output into v with
+// encoding/xml. The command is rewritten with the driver's
+// drivers.XMLFormatter, such as "show version | display xml" on Junos, and
+// the elements that wrap the output, such as Junos's rpc-reply, are skipped,
+// so that v describes the first element inside them, such as
+// software-information.
+func (d *Device) RunXML(cmd string, v interface{}) error {
+	formatter, ok := d.driver().(drivers.XMLFormatter)
+	if !ok {
+		return errors.Errorf("%s: driver cannot print output as XML", d)
+	}
+	cmd, wrappers := formatter.XML(cmd)
+	if cmd == "" {
+		return errors.Errorf("%s: driver cannot print output as XML", d)
+	}
+	result, err := d.runSession(cmd)
+	if err != nil {
+		return err
+	}
+	if err := d.rejection(result); err != nil {
+		return err
+	}
+	output := result.Commands[0].Output
+	if output == nil {
+		output = result.Output
+	}
+	if err := decodeXML(output, wrappers, v); err != nil {
+		if msg, ok := err.(xmlError); ok {
+			return &RejectedError{Device: d.String(), Message: string(msg)}
+		}
+		return &ParseError{Device: d.String(), Command: cmd, Err: err}
+	}
+	return nil
+}
+
+// xmlError is the message of an error element, in which Junos reports that
+// it refused a command in place of its output.
+type xmlError string
+
+func (e xmlError) Error() string { return string(e) }
+
+// decodeXML decodes the first element in output that is not one of wrappers
+// into v. The XML must start at the beginning of a line, after the echoed
+// command.
+func decodeXML(data []byte, wrappers []string, v interface{}) error {
+	start := 0
+	if !bytes.HasPrefix(data, []byte("<")) {
+		if start = bytes.Index(data, []byte("\n<")) + 1; start == 0 {
+			return errors.New("no XML in output")
+		}
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data[start:]))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return errors.New("no XML element in output")
+		}
+		if err != nil {
+			return err
+		}
+		elem, ok := token.(xml.StartElement)
+		if !ok || contains(wrappers, elem.Name.Local) {
+			continue
+		}
+		if elem.Name.Local == "error" {
+			var e struct {
+				Message string `xml:"message"`
+			}
+			decoder.DecodeElement(&e, &elem)
+			return xmlError(strings.TrimSpace(e.Message))
+		}
+		return decoder.DecodeElement(v, &elem)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package discover
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+)
+
+// maxPacket limits the size of the key exchange packet Algorithms accepts.
+const maxPacket = 256 * 1024
+
+// Algorithms lists the algorithms an SSH server offers, in its order of
+// preference. Ciphers and MACs combine both directions.
+type Algorithms struct {
+	KeyExchanges []string `json:"key_exchanges"`
+	HostKeys     []string `json:"host_keys"`
+	Ciphers      []string `json:"ciphers"`
+	MACs         []string `json:"macs"`
+}
+
+// kexInit is the SSH_MSG_KEXINIT message defined in RFC 4253, section 7.1.
+type kexInit struct {
+	Cookie                  [16]byte `sshtype:"20"`
+	KeyExchanges            []string
+	HostKeys                []string
+	CiphersClientServer     []string
+	CiphersServerClient     []string
+	MACsClientServer        []string
+	MACsServerClient        []string
+	CompressionClientServer []string
+	CompressionServerClient []string
+	LanguagesClientServer   []string
+	LanguagesServerClient   []string
+	FirstKexFollows         bool
+	Reserved                uint32
+}
+
+// Algorithms returns the algorithms offered by the SSH server at addr, read
+// from the first key exchange message it sends. An address without a port
+// uses the scanner's Port.
+func (s *Scanner) Algorithms(ctx context.Context, addr string) (*Algorithms, error) {
+	addr = s.withPort(addr)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "SSH-2.0-discover\r\n"); err != nil {
+		return nil, errors.Wrapf(err, "failed to probe %s", addr)
+	}
+	in := bufio.NewReader(conn)
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s sent no SSH banner", addr)
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			break
+		}
+	}
+	var header [5]byte
+	if _, err := io.ReadFull(in, header[:]); err != nil {
+		return nil, errors.Wrapf(err, "%s sent no key exchange", addr)
+	}
+	length, padding := binary.BigEndian.Uint32(header[:4]), uint32(header[4])
+	if length > maxPacket || padding+1 > length {
+		return nil, errors.Errorf("%s sent a malformed packet", addr)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(in, payload); err != nil {
+		return nil, errors.Wrapf(err, "%s sent no key exchange", addr)
+	}
+	var msg kexInit
+	if err := ssh.Unmarshal(payload[:length-padding-1], &msg); err != nil {
+		return nil, errors.Wrapf(err, "%s sent a malformed key exchange", addr)
+	}
+	return &Algorithms{
+		KeyExchanges: msg.KeyExchanges,
+		HostKeys:     msg.HostKeys,
+		Ciphers:      union(msg.CiphersClientServer, msg.CiphersServerClient),
+		MACs:         union(msg.MACsClientServer, msg.MACsServerClient),
+	}, nil
+}
+
+// union returns the names in a followed by those in b that are not in a.
+func union(a, b []string) []string {
+	names := append([]string(nil), a...)
+	for _, name := range b {
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CryptoAudit describes the weak algorithms one SSH server still offers.
+type CryptoAudit struct {
+	Addr       string
+	Algorithms *Algorithms // nil if the server could not be probed
+	Err        error
+
+	WeakCiphers      []string // CBC mode, RC4, and unencrypted ciphers
+	WeakKeyExchanges []string // SHA-1 key exchanges
+	SHA1HostKeysOnly bool     // RSA host keys are offered only with SHA-1 signatures
+}
+
+// Weak reports whether the server offers any weak algorithms.
+func (a *CryptoAudit) Weak() bool {
+	return len(a.WeakCiphers) > 0 || len(a.WeakKeyExchanges) > 0 || a.SHA1HostKeysOnly
+}
+
+// AuditCrypto probes the SSH servers at addrs, such as the addresses in an
+// inventory, and reports the weak algorithms each still offers. The results
+// are in the order of addrs.
+func (s *Scanner) AuditCrypto(ctx context.Context, addrs ...string) []CryptoAudit {
+	audits := make([]CryptoAudit, len(addrs))
+	for i, addr := range addrs {
+		audits[i] = CryptoAudit{Addr: s.withPort(addr), Err: ctx.Err()}
+	}
+	s.each(ctx, len(addrs), func(i int) {
+		audits[i].Algorithms, audits[i].Err = s.Algorithms(ctx, addrs[i])
+		if audits[i].Algorithms != nil {
+			audits[i].audit()
+		}
+	})
+	return audits
+}
+
+// audit finds the weak algorithms among those the server offers.
+func (a *CryptoAudit) audit() {
+	a.WeakCiphers, a.WeakKeyExchanges = nil, nil
+	for _, cipher := range a.Algorithms.Ciphers {
+		if strings.HasSuffix(cipher, "-cbc") || strings.HasSuffix(cipher, "-cbc@lysator.liu.se") ||
+			strings.HasPrefix(cipher, "arcfour") || cipher == "none" {
+			a.WeakCiphers = append(a.WeakCiphers, cipher)
+		}
+	}
+	for _, kex := range a.Algorithms.KeyExchanges {
+		if strings.HasSuffix(kex, "-sha1") {
+			a.WeakKeyExchanges = append(a.WeakKeyExchanges, kex)
+		}
+	}
+	a.SHA1HostKeysOnly = len(a.Algorithms.HostKeys) > 0
+	for _, algo := range a.Algorithms.HostKeys {
+		if algo != ssh.KeyAlgoRSA && algo != ssh.KeyAlgoDSA {
+			a.SHA1HostKeysOnly = false
+		}
+	}
+}
+
+// WriteCryptoReport writes audits as a JSON array for security teams, with
+// the algorithms each server offers and the weak ones among them.
+func WriteCryptoReport(w io.Writer, audits []CryptoAudit) error {
+	type entry struct {
+		Addr             string      `json:"addr"`
+		Weak             bool        `json:"weak"`
+		WeakCiphers      []string    `json:"weak_ciphers,omitempty"`
+		WeakKeyExchanges []string    `json:"weak_key_exchanges,omitempty"`
+		SHA1HostKeysOnly bool        `json:"sha1_host_keys_only,omitempty"`
+		Algorithms       *Algorithms `json:"algorithms,omitempty"`
+		Error            string      `json:"error,omitempty"`
+	}
+	report := make([]entry, len(audits))
+	for i := range audits {
+		a := &audits[i]
+		report[i] = entry{
+			Addr:             a.Addr,
+			Weak:             a.Weak(),
+			WeakCiphers:      a.WeakCiphers,
+			WeakKeyExchanges: a.WeakKeyExchanges,
+			SHA1HostKeysOnly: a.SHA1HostKeysOnly,
+			Algorithms:       a.Algorithms,
+		}
+		if a.Err != nil {
+			report[i].Error = a.Err.Error()
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(report), "failed to write crypto report")
+}
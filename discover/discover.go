@@ -0,0 +1,379 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package discover finds SSH-managed devices on a network. It scans address
+// ranges for open SSH ports and records what each server reveals before
+// authentication, such as its version banner and host key, to bootstrap
+// inventories for existing networks.
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxAddrs limits the size of the ranges Scan accepts.
+const maxAddrs = 1 << 16
+
+// Host describes an SSH server found by a scan.
+type Host struct {
+	Addr     string        // address and port of the server
+	Banner   string        // SSH version banner, such as "SSH-2.0-Cisco-1.25"
+	HostKey  ssh.PublicKey // nil if the handshake did not get that far
+	Platform string        // detected platform, if any
+}
+
+// Fingerprint returns the SHA256 fingerprint of the host's key, or an empty
+// string if it is not known.
+func (h *Host) Fingerprint() string {
+	if h.HostKey == nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(h.HostKey)
+}
+
+// A Scanner scans networks for SSH servers. The zero value is ready to use.
+type Scanner struct {
+	Port    int           // defaults to 22
+	Timeout time.Duration // per address; defaults to 2 seconds
+	Workers int           // addresses probed at once; defaults to 64
+
+	// Detect guesses the platform of each host from its banner. If nil, no
+	// detection is attempted; DetectPlatform is a reasonable choice.
+	Detect func(banner string) string
+
+	// Config, if set, is used to log in to each host and run "show version"
+	// over an exec channel, whose output DetectVersion classifies more
+	// precisely than a banner can, telling IOS from ASA for instance. Hosts
+	// that cannot be logged in to or that do not run commands over exec
+	// channels keep the platform detected from their banner.
+	Config *ssh.ClientConfig
+}
+
+// Scan probes every usable address in cidr and returns the SSH servers found,
+// in address order. It stops early if ctx is done.
+func (s *Scanner) Scan(ctx context.Context, cidr string) ([]Host, error) {
+	addrs, err := expand(cidr)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]*Host, len(addrs))
+	s.each(ctx, len(addrs), func(i int) {
+		found[i] = s.Probe(ctx, addrs[i])
+	})
+
+	var hosts []Host
+	for _, host := range found {
+		if host != nil {
+			hosts = append(hosts, *host)
+		}
+	}
+	return hosts, ctx.Err()
+}
+
+// each calls fn with 0 through n-1 from Workers goroutines, stopping early if
+// ctx is done.
+func (s *Scanner) each(ctx context.Context, n int, fn func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Probe connects to the SSH port of ip and returns what the server reveals
+// before authentication, or nil if nothing answers with an SSH banner.
+func (s *Scanner) Probe(ctx context.Context, ip string) *Host {
+	addr := net.JoinHostPort(ip, strconv.Itoa(s.port()))
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	rec := &recordingConn{Conn: conn}
+	host := &Host{Addr: addr}
+	config := &ssh.ClientConfig{
+		User: "discover",
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			host.HostKey = key
+			return errScanned
+		},
+	}
+	ssh.NewClientConn(rec, addr, config)
+	if host.Banner = rec.banner(); host.Banner == "" {
+		return nil
+	}
+	if s.Detect != nil {
+		host.Platform = s.Detect(host.Banner)
+	}
+	if s.Config != nil {
+		if output, err := s.showVersion(ctx, addr); err == nil {
+			if platform := DetectVersion(output); platform != "generic" {
+				host.Platform = platform
+			}
+		}
+	}
+	return host
+}
+
+// showVersion logs in to the SSH server at addr with Config and returns the
+// output of "show version".
+func (s *Scanner) showVersion(ctx context.Context, addr string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, s.Config)
+	if err != nil {
+		return "", err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	output, err := session.CombinedOutput("show version")
+	return string(output), err
+}
+
+// port returns the port to probe.
+func (s *Scanner) port() int {
+	if s.Port == 0 {
+		return 22
+	}
+	return s.Port
+}
+
+// timeout returns how long to spend on each address.
+func (s *Scanner) timeout() time.Duration {
+	if s.Timeout == 0 {
+		return 2 * time.Second
+	}
+	return s.Timeout
+}
+
+// workers returns how many addresses to probe at once.
+func (s *Scanner) workers() int {
+	if s.Workers <= 0 {
+		return 64
+	}
+	return s.Workers
+}
+
+// dial connects to addr with the deadline of ctx applied to the connection.
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// errScanned stops the handshake once the host key is known.
+var errScanned = errors.New("scanned")
+
+// recordingConn keeps the first bytes read from a connection, which hold the
+// server's version banner.
+type recordingConn struct {
+	net.Conn
+	head []byte
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if room := 512 - len(c.head); room > 0 {
+		if room > n {
+			room = n
+		}
+		c.head = append(c.head, p[:room]...)
+	}
+	return n, err
+}
+
+// banner returns the SSH version line the server sent, if any. Servers may
+// send other lines before it.
+func (c *recordingConn) banner() string {
+	for _, line := range bytes.Split(c.head, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			return string(bytes.TrimRight(line, "\r"))
+		}
+	}
+	return ""
+}
+
+// platforms maps patterns matching SSH banners to the platforms that send
+// them. Devices without a driver of their own, such as Huawei and Arista, are
+// recognized as network devices but get the generic driver.
+var platforms = []struct {
+	pattern  *regexp.Regexp
+	platform string
+}{
+	{regexp.MustCompile(`(?i)cisco-2\.`), "iosxr"},
+	{regexp.MustCompile(`(?i)cisco`), "ios"},
+	{regexp.MustCompile(`(?i)juniper`), "junos"},
+	{regexp.MustCompile(`(?i)huawei|comware|hpe?-|netscreen|arista`), "generic"},
+	{regexp.MustCompile(`ROSSSH`), "generic"},
+}
+
+// DetectPlatform guesses a device's platform from its SSH banner and returns
+// the name of a registered driver. It returns an empty string if the banner,
+// like that of a stock OpenSSH server, does not identify the platform, which
+// is the case on NX-OS and most Junos releases.
+//
+// Classic IOS XR sends "Cisco-2.0" banners, but IOS, IOS XE, and ASA all send
+// the same "Cisco-1.25", for which DetectPlatform returns "ios". Set
+// Scanner.Config to tell them apart with DetectVersion.
+func DetectPlatform(banner string) string {
+	for _, p := range platforms {
+		if p.pattern.MatchString(banner) {
+			return registered(p.platform)
+		}
+	}
+	return ""
+}
+
+// versions maps patterns matching the output of "show version" to the
+// platforms that print it, most specific first.
+var versions = []struct {
+	pattern  *regexp.Regexp
+	platform string
+}{
+	{regexp.MustCompile(`Cisco IOS XR`), "iosxr"},
+	{regexp.MustCompile(`Cisco Nexus Operating System|NX-OS`), "nxos"},
+	{regexp.MustCompile(`Cisco Adaptive Security Appliance`), "asa"},
+	{regexp.MustCompile(`Firepower Threat Defense|Cisco Firepower`), "ftd"},
+	{regexp.MustCompile(`Cisco IOS|IOS-XE`), "ios"},
+	{regexp.MustCompile(`(?i)\bjunos\b`), "junos"},
+	{regexp.MustCompile(`\bOS10\b`), "os10"},
+	{regexp.MustCompile(`Dell (?:EMC )?Networking OS|Force10`), "os9"},
+	{regexp.MustCompile(`ExtremeXOS`), "exos"},
+	{regexp.MustCompile(`EdgeOS|EdgeRouter`), "edgeos"},
+	{regexp.MustCompile(`VyOS`), "vyos"},
+}
+
+// DetectVersion identifies a device's platform from the output of its "show
+// version" command and returns the name of a registered driver, or "generic"
+// if the output is not recognized.
+func DetectVersion(output string) string {
+	for _, v := range versions {
+		if v.pattern.MatchString(output) {
+			return registered(v.platform)
+		}
+	}
+	return "generic"
+}
+
+// registered returns platform if a driver is registered for it, and "generic"
+// otherwise.
+func registered(platform string) string {
+	if _, err := drivers.Lookup(platform); err != nil {
+		return "generic"
+	}
+	return platform
+}
+
+// WriteInventory writes hosts as a CSV inventory skeleton with a header row
+// and the columns name, address, platform, and host key fingerprint. Names are
+// left for the operator to fill in.
+func WriteInventory(w io.Writer, hosts []Host) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"name", "address", "platform", "fingerprint"})
+	for i := range hosts {
+		host := &hosts[i]
+		out.Write([]string{"", host.Addr, host.Platform, host.Fingerprint()})
+	}
+	out.Flush()
+	return errors.Wrap(out.Error(), "failed to write inventory")
+}
+
+// expand returns the usable addresses in cidr, skipping the network and
+// broadcast addresses of IPv4 subnets larger than /31.
+func expand(cidr string) ([]string, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid network")
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones > 16 {
+		return nil, errors.Errorf("%s has more than %d addresses", cidr, maxAddrs)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	var addrs []string
+	ip = ip.Mask(network.Mask)
+	for i := 0; i < 1<<uint(bits-ones); i++ {
+		addrs = append(addrs, ip.String())
+		ip = successor(ip)
+	}
+	if bits == 32 && ones < 31 {
+		addrs = addrs[1 : len(addrs)-1]
+	}
+	return addrs, nil
+}
+
+// successor returns the address after ip.
+func successor(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
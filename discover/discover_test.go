@@ -0,0 +1,150 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package discover_test contains tests, benchmarks, and examples for package
+// discover.
+package discover_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/mwalto7/device/device/devicetest"
+	"github.com/mwalto7/device/discover"
+	"github.com/mwalto7/device/drivers"
+	"golang.org/x/crypto/ssh"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	tests := []struct {
+		banner, want string
+	}{
+		{"SSH-2.0-Cisco-1.25", "ios"},
+		{"SSH-2.0-Cisco-2.0", "iosxr"},
+		{"SSH-1.99-Cisco-1.25", "ios"},
+		{"SSH-2.0-HUAWEI-1.5", "generic"},
+		{"SSH-2.0-Comware-7.1.064", "generic"},
+		{"SSH-2.0-ROSSSH", "generic"},
+		{"SSH-2.0-NetScreen", "generic"},
+		{"SSH-2.0-OpenSSH_7.4", ""},
+	}
+	for _, tt := range tests {
+		got := discover.DetectPlatform(tt.banner)
+		if got != tt.want {
+			t.Errorf("DetectPlatform(%q) = %q, want %q", tt.banner, got, tt.want)
+		}
+		if got != "" {
+			if _, err := drivers.Lookup(got); err != nil {
+				t.Errorf("DetectPlatform(%q) = %q, which has no driver", tt.banner, got)
+			}
+		}
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	tests := []struct {
+		output, want string
+	}{
+		{"Cisco IOS Software, C2960 Software (C2960-LANBASEK9-M), Version 15.0(2)SE11", "ios"},
+		{"Cisco IOS XE Software, Version 16.09.03", "ios"},
+		{"Cisco IOS XR Software, Version 6.1.2[Default]", "iosxr"},
+		{"Cisco Nexus Operating System (NX-OS) Software", "nxos"},
+		{"Cisco Adaptive Security Appliance Software Version 9.8(2)", "asa"},
+		{"Model                     : Cisco Firepower 2110 Threat Defense", "ftd"},
+		{"Hostname: r1\nModel: mx480\nJunos: 18.2R1.9", "junos"},
+		{"Dell EMC Networking OS10 Enterprise", "os10"},
+		{"Dell Networking OS Version : 2.0", "os9"},
+		{"ExtremeXOS version 22.4.1.4", "exos"},
+		{"Version:          VyOS 1.2.0", "vyos"},
+		{"Version:      v1.10.0\nHW model:     EdgeRouter X 5-Port", "edgeos"},
+		{"Huawei Versatile Routing Platform Software", "generic"},
+	}
+	for _, tt := range tests {
+		if got := discover.DetectVersion(tt.output); got != tt.want {
+			t.Errorf("DetectVersion(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestScanner_Probe(t *testing.T) {
+	server := devicetest.NewServer(map[string]string{
+		"show version": "Cisco Adaptive Security Appliance Software Version 9.8(2)\n",
+	})
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := &discover.Scanner{Detect: discover.DetectPlatform}
+	scanner.Port, _ = strconv.Atoi(port)
+	if got := scanner.Probe(context.Background(), host); got.Platform != "" {
+		t.Errorf("Platform without Config = %q, want \"\"", got.Platform)
+	}
+	scanner.Config = &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("password")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if got := scanner.Probe(context.Background(), host); got.Platform != "asa" {
+		t.Errorf("Platform with Config = %q, want \"asa\"", got.Platform)
+	}
+}
+
+func ExampleScanner() {
+	scanner := &discover.Scanner{
+		Timeout: time.Second,
+		Detect:  discover.DetectPlatform,
+	}
+	hosts, err := scanner.Scan(context.Background(), "192.0.2.0/24")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := discover.WriteInventory(os.Stdout, hosts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDetectPlatform() {
+	fmt.Println(discover.DetectPlatform("SSH-2.0-Cisco-1.25"))
+	fmt.Println(discover.DetectPlatform("SSH-2.0-Cisco-2.0"))
+	// Output:
+	// ios
+	// iosxr
+}
+
+func ExampleScanner_ScanKeys() {
+	var scanner discover.Scanner
+	hosts := scanner.ScanKeys(context.Background(), "192.0.2.1", "192.0.2.2:2222")
+	mismatches, err := discover.CompareKnownHosts(hosts, os.ExpandEnv("$HOME/.ssh/known_hosts"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range mismatches {
+		fmt.Println(m.String())
+	}
+	if err := discover.WriteKnownHosts(os.Stdout, hosts, true); err != nil {
+		log.Fatal(err)
+	}
+}
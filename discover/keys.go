@@ -0,0 +1,226 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+	"strconv"
+)
+
+// KeyAlgorithms are the host key algorithms ScanKeys asks each server for by
+// default, one handshake each, so that every key a server holds is found.
+var KeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA,
+}
+
+// HostKeys holds the host keys collected from one server.
+type HostKeys struct {
+	Addr string
+	Keys []ssh.PublicKey // in the order of KeyAlgorithms, without duplicates
+	Err  error           // why no keys were collected, if none were
+}
+
+// ScanKeys collects the host keys of the servers at addrs, such as the
+// addresses in an inventory, without authenticating, like ssh-keyscan. An
+// address without a port uses the scanner's Port. The results are in the
+// order of addrs.
+func (s *Scanner) ScanKeys(ctx context.Context, addrs ...string) []HostKeys {
+	hosts := make([]HostKeys, len(addrs))
+	s.each(ctx, len(addrs), func(i int) {
+		hosts[i] = s.scanKeys(ctx, addrs[i])
+	})
+	for i := range hosts {
+		if hosts[i].Addr == "" {
+			hosts[i] = HostKeys{Addr: s.withPort(addrs[i]), Err: ctx.Err()}
+		}
+	}
+	return hosts
+}
+
+// scanKeys collects the host keys of the server at addr.
+func (s *Scanner) scanKeys(ctx context.Context, addr string) HostKeys {
+	host := HostKeys{Addr: s.withPort(addr)}
+	seen := make(map[string]bool)
+	for _, algo := range KeyAlgorithms {
+		key, err := s.hostKey(ctx, host.Addr, algo)
+		if _, unreachable := err.(*net.OpError); unreachable {
+			host.Err = err
+			break
+		} else if err != nil {
+			if host.Err == nil {
+				host.Err = err
+			}
+			continue
+		}
+		if id := string(key.Marshal()); !seen[id] {
+			seen[id] = true
+			host.Keys = append(host.Keys, key)
+		}
+	}
+	if len(host.Keys) > 0 {
+		host.Err = nil
+	}
+	return host
+}
+
+// hostKey returns the server's host key for algo.
+func (s *Scanner) hostKey(ctx context.Context, addr, algo string) (ssh.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:              "discover",
+		HostKeyAlgorithms: []string{algo},
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errScanned
+		},
+	}
+	if _, _, _, err := ssh.NewClientConn(conn, addr, config); key == nil {
+		return nil, errors.Wrapf(err, "%s offered no %s key", addr, algo)
+	}
+	return key, nil
+}
+
+// withPort adds the scanner's port to addr if it has none.
+func (s *Scanner) withPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(s.port()))
+}
+
+// WriteKnownHosts writes the collected keys as known_hosts lines, hashing the
+// host names if hash is set. Hosts without keys are skipped.
+func WriteKnownHosts(w io.Writer, hosts []HostKeys, hash bool) error {
+	var b bytes.Buffer
+	for _, host := range hosts {
+		name := knownhosts.Normalize(host.Addr)
+		if hash {
+			name = knownhosts.HashHostname(name)
+		}
+		for _, key := range host.Keys {
+			b.WriteString(knownhosts.Line([]string{name}, key) + "\n")
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return errors.Wrap(err, "failed to write known hosts")
+}
+
+// keyReport is the JSON form of HostKeys written by WriteKeyReport.
+type keyReport struct {
+	Addr  string      `json:"addr"`
+	Keys  []keyRecord `json:"keys"`
+	Error string      `json:"error,omitempty"`
+}
+
+type keyRecord struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Key         string `json:"key"` // in authorized_keys format
+}
+
+// WriteKeyReport writes the collected keys as a JSON array with the type,
+// SHA256 fingerprint, and authorized_keys form of each key.
+func WriteKeyReport(w io.Writer, hosts []HostKeys) error {
+	report := make([]keyReport, len(hosts))
+	for i, host := range hosts {
+		report[i] = keyReport{Addr: host.Addr, Keys: []keyRecord{}}
+		if host.Err != nil {
+			report[i].Error = host.Err.Error()
+		}
+		for _, key := range host.Keys {
+			report[i].Keys = append(report[i].Keys, keyRecord{
+				Type:        key.Type(),
+				Fingerprint: ssh.FingerprintSHA256(key),
+				Key:         string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(key))),
+			})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(report), "failed to write key report")
+}
+
+// KeyMismatch is a collected host key that contradicts a known_hosts file, as
+// happens when a device is replaced or a connection is intercepted.
+type KeyMismatch struct {
+	Addr  string
+	Key   ssh.PublicKey
+	Known []knownhosts.KnownKey // keys of the same type on record for the host
+}
+
+func (m *KeyMismatch) String() string {
+	return fmt.Sprintf("%s: %s key %s does not match %s:%d",
+		m.Addr, m.Key.Type(), ssh.FingerprintSHA256(m.Key), m.Known[0].Filename, m.Known[0].Line)
+}
+
+// CompareKnownHosts checks the collected keys against the known_hosts files
+// and returns those that contradict them. Hosts and key types with no entry
+// are not mismatches.
+func CompareKnownHosts(hosts []HostKeys, files ...string) ([]KeyMismatch, error) {
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read known hosts")
+	}
+	var mismatches []KeyMismatch
+	for _, host := range hosts {
+		remote, err := net.ResolveTCPAddr("tcp", host.Addr)
+		if err != nil {
+			remote = &net.TCPAddr{}
+		}
+		for _, key := range host.Keys {
+			err := callback(host.Addr, remote, key)
+			keyErr, ok := err.(*knownhosts.KeyError)
+			if !ok || len(keyErr.Want) == 0 {
+				continue
+			}
+			var known []knownhosts.KnownKey
+			for _, want := range keyErr.Want {
+				if want.Key.Type() == key.Type() {
+					known = append(known, want)
+				}
+			}
+			if len(known) > 0 {
+				mismatches = append(mismatches, KeyMismatch{Addr: host.Addr, Key: key, Known: known})
+			}
+		}
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,160 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"regexp"
+)
+
+func init() {
+	Register("asa", func() Driver { return asa })
+	RegisterAlias("cisco-asa", "asa")
+	Register("ftd", func() Driver { return ftd })
+	RegisterAlias("cisco-ftd", "ftd")
+	RegisterAlias("firepower", "ftd")
+}
+
+// asaBasic is the "basic" diagnostics profile of asa.
+var asaBasic = []string{
+	"show version",
+	"show running-config",
+	"show logging",
+	"show interface",
+	"show cpu usage",
+	"show memory",
+	"show failover",
+	"show conn count",
+}
+
+// asaPrompt matches the prompts of ASA, including the context and failover
+// state that may follow the host name, as in "fw/admin/pri/act#".
+var asaPrompt = `[\w.\-]+(?:/[\w.\-]+)*(?:\([\w.\-]+\))?[>#]`
+
+// asa drives Cisco ASA. Sessions start unprivileged and most commands,
+// including "terminal pager", need enable mode, whose password is blank on a
+// device that has never had one set. Changing to a context restores the
+// context's own pager setting, so the pager is turned off again after every
+// "changeto".
+var asa = &driver{
+	name:   "asa",
+	prompt: regexp.MustCompile(`^` + asaPrompt + ` ?$`),
+	setup:  []string{"terminal pager 0"},
+	enter:  []string{"configure terminal"},
+	exit:   []string{"end"},
+	save:   []string{"write memory"},
+	reload: []string{"reload noconfirm"},
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"hostname %[1]s"},
+			show:     "show running-config hostname",
+			present:  []string{"hostname %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"interface %[1]s", "description %[2]s"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"description %[2]s"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"interface %[1]s", "shutdown"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"shutdown"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"interface %[1]s", "no shutdown"},
+			show:     "show running-config interface %[1]s",
+			absent:   []string{"shutdown"},
+		},
+	},
+	users: &userSyntax{
+		show:    "show running-config username",
+		pattern: regexp.MustCompile(`(?m)^username (\S+)`),
+		roles:   map[string]string{"admin": "15", "read-only": "1"},
+		create:  []string{"username %[1]s password %[2]s privilege %[3]s"},
+		remove:  []string{"clear configure username %[1]s"},
+	},
+	services: map[string]serviceSyntax{
+		"ntp": {show: "show running-config ntp", prefix: "ntp server ", add: "ntp server %s"},
+	},
+	diagnostics: map[string][]string{
+		"basic": asaBasic,
+		"full":  append(append([]string(nil), asaBasic...), "show tech-support"),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(: Written by \S+ at ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)^(\S+ up ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b(password )\S+( (?:encrypted|pbkdf2))`), "${1}<secret>${2}"},
+		{regexp.MustCompile(`\b\d+ (pkts|bytes)/sec\b`), "<rate> $1/sec"},
+		{regexp.MustCompile(`\b\d+ (packets input|packets output|bytes|input errors|output errors|CRC|frame|overrun|ignored|abort|no buffer|underruns)\b`), "<count> $1"},
+	},
+	running:  &runningConfig{"show running-config", config.Indented},
+	rejected: regexp.MustCompile(`(?m)^(?:ERROR: |% (?:Invalid|Incomplete|Ambiguous))`),
+	contexts: &contextSyntax{
+		change: []string{"changeto context %[1]s", "terminal pager 0"},
+		system: []string{"changeto system", "terminal pager 0"},
+	},
+	enable: &enableSyntax{command: "enable", privileged: regexp.MustCompile(`#$`)},
+	caps: Capabilities{
+		Enable:       true,
+		FileTransfer: "scp",
+		Algorithms: Algorithms{
+			Ciphers:      []string{"aes128-cbc", "aes256-cbc", "3des-cbc"},
+			KeyExchanges: []string{"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1"},
+			HostKeys:     []string{"ssh-rsa"},
+		},
+	},
+}
+
+// ftdBasic is the "basic" diagnostics profile of ftd.
+var ftdBasic = []string{
+	"show version",
+	"show managers",
+	"show network",
+	"show running-config",
+	"show interface",
+	"show cpu usage",
+	"show memory",
+	"show failover",
+}
+
+// ftd drives the CLI of Cisco Firepower Threat Defense, whose "> " prompt
+// runs show commands but not configuration, which belongs to the device's
+// manager. The "diagnostic-cli" mode is the ASA CLI underneath, entered with
+// a blank enable password and left with Ctrl-A D; "expert" is the Linux
+// shell.
+var ftd = &driver{
+	name:   "ftd",
+	prompt: regexp.MustCompile(`^(?:>|` + asaPrompt + `|[\w.\-]+@[\w.\-]+:[^$#]*[$#]) ?$`),
+	reload: []string{"reboot", "YES"},
+	diagnostics: map[string][]string{
+		"basic": ftdBasic,
+		"full":  append(append([]string(nil), ftdBasic...), "show tech-support"),
+	},
+	masks: asa.masks,
+	modes: map[string]modeSyntax{
+		"diagnostic-cli": {
+			enter: []string{"system support diagnostic-cli", "enable", "", "terminal pager 0"},
+			exit:  []string{"\x01d"},
+		},
+		"expert": {enter: []string{"expert"}, exit: []string{"exit"}},
+	},
+	rejected: asa.rejected,
+}
@@ -0,0 +1,799 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"fmt"
+	"github.com/mwalto7/device/config"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("ios", func() Driver { return ios })
+	RegisterAlias("ios-xe", "ios")
+	RegisterAlias("iosxe", "ios")
+	RegisterAlias("cisco-ios", "ios")
+	RegisterAlias("cisco-ios-xe", "ios")
+	Register("junos", func() Driver { return junos })
+	RegisterAlias("juniper", "junos")
+	RegisterAlias("juniper-junos", "junos")
+}
+
+// driver is a Driver defined entirely by data. The built-in drivers are
+// instances of it.
+type driver struct {
+	name        string
+	prompt      *regexp.Regexp
+	setup       []string
+	enter, exit []string
+	commit      []string
+	save        []string
+	reload      []string
+	running     *runningConfig // nil if the configuration cannot be compared
+	member      string         // format of the command entering a member, if any
+	diagnostics map[string][]string
+	changes     map[string]changeFormat // keyed by the method generating them
+	quote       bool                    // values containing spaces must be quoted
+	vlans       *vlanList               // nil if the platform has no VLANs
+	banner      *bannerSyntax           // nil if banners cannot be set
+	users       *userSyntax             // nil if users cannot be managed
+	services    map[string]serviceSyntax
+	masks       []Mask       // applied before CommonMasks
+	stage       *stageSyntax // nil if changes cannot be staged
+	lineEnding  string       // empty means "\n"
+	exitStatus  *statusSyntax
+	json        string         // format of the command printing a command's output as JSON
+	xml         string         // format of the command printing a command's output as XML
+	xmlWrappers []string       // elements wrapping XML output, outermost first
+	checkpoint  string         // format of the command saving a checkpoint, given its name
+	rollback    string         // format of the command restoring a checkpoint, given its name
+	rejected    *regexp.Regexp // matches the output of a refused command
+	commitLabel []string       // formats of the commands committing with a label
+	modes       map[string]modeSyntax
+	contexts    *contextSyntax // nil if the platform has no contexts
+	enable      *enableSyntax  // nil if sessions start privileged
+	config      *regexp.Regexp // matches the prompt of configuration mode
+	caps        Capabilities
+}
+
+// changeFormat is a Change whose strings are formats taking the arguments of
+// the method that generates it.
+type changeFormat struct {
+	commands        []string
+	show            string
+	present, absent []string
+}
+
+// runningConfig describes how a platform shows its running configuration.
+type runningConfig struct {
+	show   string
+	format config.Format
+}
+
+// vlanList describes how to list a platform's VLANs: the lines of the
+// command's output matching pattern give the ID and name of a VLAN in the
+// submatches named "id" and "name".
+type vlanList struct {
+	show    string
+	pattern *regexp.Regexp
+}
+
+// bannerSyntax describes how a platform configures banners.
+type bannerSyntax struct {
+	names  map[string]string // the platform's name for each kind of banner
+	show   string            // format of the command displaying a banner, given its name
+	set    string            // format of the command setting a banner, given its name and text
+	remove string            // format of the command removing a banner, given its name
+
+	// delimited means that the text follows the set command on lines of its
+	// own and is ended by a delimiter, which set is given in place of the
+	// text, as in IOS. Otherwise the text is quoted, and pattern finds it in
+	// the output of show.
+	delimited bool
+	pattern   *regexp.Regexp
+}
+
+// userSyntax describes how a platform manages local users.
+type userSyntax struct {
+	show    string         // command listing the users
+	pattern *regexp.Regexp // submatch 1 of each match of show's output is a user name
+	roles   map[string]string
+
+	create []string // formats given the name, password, and role
+	remove []string // formats given the name
+
+	// addKey and endKey are formats given the name, the platform's keyword
+	// for the key's algorithm, and the key in authorized_keys format. If
+	// keyLine is positive, the key's base64 data is sent between them, on
+	// lines of at most keyLine characters.
+	addKey, endKey []string
+	keyLine        int
+	keyTypes       map[string]string
+}
+
+// serviceSyntax describes how a platform configures the servers of a network
+// service.
+type serviceSyntax struct {
+	show   string // command showing the configured servers
+	prefix string // start of each configuration line naming servers
+	multi  bool   // a line can name several servers, as in "ip name-server"
+	add    string // format of the command adding a server
+}
+
+// stageSyntax describes how a platform applies a change provisionally.
+type stageSyntax struct {
+	begin, end []string // formats of the commands around the change, given the minutes until rollback
+	finalize   []string
+	abort      []string
+	failed     *regexp.Regexp
+}
+
+// statusSyntax describes how a shell reports the exit status of the last
+// command: the output of show holds it in the first submatch of pattern.
+type statusSyntax struct {
+	show    string
+	pattern *regexp.Regexp
+}
+
+// modeSyntax describes how to enter and leave a command mode.
+type modeSyntax struct {
+	enter, exit []string
+}
+
+// contextSyntax describes how to move between a platform's contexts.
+type contextSyntax struct {
+	change []string // formats of the commands changing to a context, given its name
+	system []string // commands returning to the system context
+}
+
+// enableSyntax describes how to enter a platform's privileged mode, whose
+// password prompt is answered with the enable password.
+type enableSyntax struct {
+	command    string
+	privileged *regexp.Regexp // matches the prompt of privileged mode
+}
+
+// delimiters are tried in order for banners whose text is ended by one.
+const delimiters = "^#%~@$!|"
+
+// change formats the Change generated by the named method with args. It
+// returns an empty Change if the platform does not support it.
+func (d *driver) change(name string, args ...interface{}) Change {
+	f, ok := d.changes[name]
+	if !ok {
+		return Change{}
+	}
+	return Change{
+		Commands: formatAll(f.commands, args...),
+		Show:     format(f.show, args...),
+		Present:  formatAll(f.present, args...),
+		Absent:   formatAll(f.absent, args...),
+	}
+}
+
+// format is fmt.Sprintf, except that a format without verbs is returned as is
+// rather than with the arguments it does not use appended.
+func format(format string, args ...interface{}) string {
+	if !strings.Contains(format, "%") {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// formatAll calls format with args for each of formats.
+func formatAll(formats []string, args ...interface{}) []string {
+	var s []string
+	for _, f := range formats {
+		s = append(s, format(f, args...))
+	}
+	return s
+}
+
+// value quotes s if the platform requires it.
+func (d *driver) value(s string) string {
+	if d.quote && strings.ContainsAny(s, " \t;{}") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (d *driver) Hostname(name string) Change {
+	return d.change("Hostname", name)
+}
+
+func (d *driver) InterfaceDescription(intf, desc string) Change {
+	return d.change("InterfaceDescription", intf, d.value(desc))
+}
+
+func (d *driver) InterfaceVLAN(intf string, vlan int) Change {
+	return d.change("InterfaceVLAN", intf, vlan)
+}
+
+func (d *driver) ListVLANs() (cmd string, parse func(output string) []VLAN) {
+	if d.vlans == nil {
+		return "", nil
+	}
+	pattern := d.vlans.pattern
+	return d.vlans.show, func(output string) []VLAN {
+		var vlans []VLAN
+		for _, m := range pattern.FindAllStringSubmatch(output, -1) {
+			vlan := VLAN{Name: m[pattern.SubexpIndex("name")]}
+			vlan.ID, _ = strconv.Atoi(m[pattern.SubexpIndex("id")])
+			vlans = append(vlans, vlan)
+		}
+		return vlans
+	}
+}
+
+func (d *driver) CreateVLAN(id int, name string) Change {
+	if name == "" {
+		name = fmt.Sprintf("VLAN%04d", id)
+	}
+	return d.change("CreateVLAN", id, d.value(name))
+}
+
+func (d *driver) DeleteVLAN(id int, name string) Change {
+	return d.change("DeleteVLAN", id, d.value(name))
+}
+
+func (d *driver) Banner(kind string) (cmd string, parse func(output string) string) {
+	name, ok := d.bannerName(kind)
+	if !ok {
+		return "", nil
+	}
+	pattern := d.banner.pattern
+	return fmt.Sprintf(d.banner.show, name), func(output string) string {
+		if pattern == nil {
+			return strings.Trim(output, "\n")
+		}
+		m := pattern.FindStringSubmatch(output)
+		if m == nil {
+			return ""
+		}
+		text, err := strconv.Unquote(m[1])
+		if err != nil {
+			return m[1]
+		}
+		return text
+	}
+}
+
+func (d *driver) SetBanner(kind, text string) Change {
+	name, ok := d.bannerName(kind)
+	if !ok {
+		return Change{}
+	}
+	text = strings.Trim(text, "\n")
+	if text == "" {
+		return Change{Commands: []string{fmt.Sprintf(d.banner.remove, name)}}
+	}
+	if !d.banner.delimited {
+		return Change{Commands: []string{fmt.Sprintf(d.banner.set, name, strconv.Quote(text))}}
+	}
+	i := strings.IndexFunc(delimiters, func(r rune) bool { return !strings.ContainsRune(text, r) })
+	if i < 0 {
+		return Change{}
+	}
+	delim := delimiters[i : i+1]
+	cmds := []string{fmt.Sprintf(d.banner.set, name, delim)}
+	cmds = append(cmds, strings.Split(text, "\n")...)
+	return Change{Commands: append(cmds, delim)}
+}
+
+// bannerName returns the platform's name for the banner of kind.
+func (d *driver) bannerName(kind string) (string, bool) {
+	if d.banner == nil {
+		return "", false
+	}
+	name, ok := d.banner.names[kind]
+	return name, ok
+}
+
+func (d *driver) ListUsers() (cmd string, parse func(output string) []string) {
+	if d.users == nil {
+		return "", nil
+	}
+	pattern := d.users.pattern
+	return d.users.show, func(output string) []string {
+		var names []string
+		seen := make(map[string]bool)
+		for _, m := range pattern.FindAllStringSubmatch(output, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+		return names
+	}
+}
+
+func (d *driver) CreateUser(user LocalUser) Change {
+	if d.users == nil {
+		return Change{}
+	}
+	role := user.Role
+	if r, ok := d.users.roles[role]; ok {
+		role = r
+	}
+	return Change{Commands: formatAll(d.users.create, user.Name, d.value(user.Password), role)}
+}
+
+func (d *driver) RemoveUser(name string) Change {
+	if d.users == nil {
+		return Change{}
+	}
+	return Change{Commands: formatAll(d.users.remove, name)}
+}
+
+func (d *driver) AddSSHKey(name, authorizedKey string) Change {
+	fields := strings.Fields(authorizedKey)
+	if d.users == nil || len(fields) < 2 {
+		return Change{}
+	}
+	keyType, ok := d.users.keyTypes[fields[0]]
+	if !ok {
+		return Change{}
+	}
+	authorizedKey = strings.Join(fields, " ")
+	cmds := formatAll(d.users.addKey, name, keyType, strconv.Quote(authorizedKey))
+	if d.users.keyLine > 0 {
+		for data := fields[1]; data != ""; {
+			n := d.users.keyLine
+			if n > len(data) {
+				n = len(data)
+			}
+			cmds, data = append(cmds, data[:n]), data[n:]
+		}
+	}
+	return Change{Commands: append(cmds, formatAll(d.users.endKey, name, keyType, authorizedKey)...)}
+}
+
+func (d *driver) Servers(service string) (cmd string, parse func(output string) []string) {
+	s, ok := d.services[service]
+	if !ok {
+		return "", nil
+	}
+	return s.show, func(output string) []string {
+		var servers []string
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, s.prefix) {
+				continue
+			}
+			fields := strings.Fields(line[len(s.prefix):])
+			if len(fields) > 0 && !s.multi {
+				fields = fields[:1]
+			}
+			for _, server := range fields {
+				servers = append(servers, strings.Trim(server, `'"`))
+			}
+		}
+		return servers
+	}
+}
+
+func (d *driver) AddServers(service string, servers ...string) Change {
+	s, ok := d.services[service]
+	if !ok {
+		return Change{}
+	}
+	var cmds []string
+	for _, server := range servers {
+		cmds = append(cmds, fmt.Sprintf(s.add, server))
+	}
+	return Change{Commands: cmds}
+}
+
+func (d *driver) InterfaceShutdown(intf string, shutdown bool) Change {
+	if shutdown {
+		return d.change("InterfaceShutdown", intf)
+	}
+	return d.change("InterfaceNoShutdown", intf)
+}
+
+func (d *driver) Name() string                       { return d.name }
+func (d *driver) Prompt() *regexp.Regexp             { return d.prompt }
+func (d *driver) Setup() []string                    { return d.setup }
+func (d *driver) ConfigMode() (enter, exit []string) { return d.enter, d.exit }
+func (d *driver) Commit() []string                   { return d.commit }
+func (d *driver) Save() []string                     { return d.save }
+func (d *driver) Reload() []string                   { return d.reload }
+func (d *driver) Capabilities() Capabilities         { return d.caps }
+
+func (d *driver) Diagnostics(profile string) []string { return d.diagnostics[profile] }
+
+func (d *driver) RunningConfig() (cmd string, format config.Format) {
+	if d.running == nil {
+		return "", config.Indented
+	}
+	return d.running.show, d.running.format
+}
+
+func (d *driver) VolatileMasks() []Mask {
+	return append(append([]Mask(nil), d.masks...), CommonMasks...)
+}
+
+func (d *driver) Member(id string) (enter, exit []string) {
+	if d.member == "" {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf(d.member, id)}, []string{"exit"}
+}
+
+func (d *driver) Stage(cmds []string, minutes int) []string {
+	if d.stage == nil {
+		return nil
+	}
+	staged := formatAll(d.stage.begin, minutes)
+	staged = append(staged, cmds...)
+	return append(staged, formatAll(d.stage.end, minutes)...)
+}
+
+func (d *driver) Finalize() []string {
+	if d.stage == nil {
+		return nil
+	}
+	return d.stage.finalize
+}
+
+func (d *driver) Abort() []string {
+	if d.stage == nil {
+		return nil
+	}
+	return d.stage.abort
+}
+
+func (d *driver) StageFailed() *regexp.Regexp {
+	if d.stage == nil {
+		return nil
+	}
+	return d.stage.failed
+}
+
+func (d *driver) LineEnding() string {
+	if d.lineEnding == "" {
+		return "\n"
+	}
+	return d.lineEnding
+}
+
+func (d *driver) ExitStatus() (cmd string, parse func(output string) (int, bool)) {
+	if d.exitStatus == nil {
+		return "", nil
+	}
+	return d.exitStatus.show, func(output string) (int, bool) {
+		m := d.exitStatus.pattern.FindStringSubmatch(output)
+		if m == nil {
+			return 0, false
+		}
+		status, err := strconv.Atoi(m[1])
+		return status, err == nil
+	}
+}
+
+func (d *driver) JSON(cmd string) string {
+	if d.json == "" {
+		return ""
+	}
+	return fmt.Sprintf(d.json, cmd)
+}
+
+func (d *driver) XML(cmd string) (xmlCmd string, wrappers []string) {
+	if d.xml == "" {
+		return "", nil
+	}
+	return fmt.Sprintf(d.xml, cmd), d.xmlWrappers
+}
+
+func (d *driver) Checkpoint(name string) []string {
+	if d.checkpoint == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf(d.checkpoint, name)}
+}
+
+func (d *driver) Rollback(name string) []string {
+	if d.rollback == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf(d.rollback, name)}
+}
+
+func (d *driver) Rejected() *regexp.Regexp { return d.rejected }
+
+func (d *driver) LabeledCommit(label string) []string {
+	if d.commitLabel == nil {
+		return nil
+	}
+	return formatAll(d.commitLabel, d.value(label))
+}
+
+func (d *driver) Mode(name string) (enter, exit []string) {
+	mode, ok := d.modes[name]
+	if !ok {
+		return nil, nil
+	}
+	return mode.enter, mode.exit
+}
+
+func (d *driver) ConfigPrompt() *regexp.Regexp { return d.config }
+
+func (d *driver) Context(name string) (enter, exit []string) {
+	if d.contexts == nil {
+		return nil, nil
+	}
+	if name == "system" {
+		return d.contexts.system, nil
+	}
+	return formatAll(d.contexts.change, name), d.contexts.system
+}
+
+func (d *driver) Enable(password string) (cmd string, steps []Step, privileged *regexp.Regexp) {
+	if d.enable == nil {
+		return "", nil, nil
+	}
+	return d.enable.command, []Step{{Expect: passwordPrompt, Send: password + "\n"}}, d.enable.privileged
+}
+
+// iosBasic is the "basic" diagnostics profile of ios.
+var iosBasic = []string{
+	"show version",
+	"show running-config",
+	"show logging",
+	"show interfaces",
+	"show processes cpu sorted",
+	"show environment all",
+}
+
+// ios drives Cisco IOS and IOS XE.
+var ios = &driver{
+	name:   "ios",
+	prompt: regexp.MustCompile(`^[\w.\-@/:]+(?:\([\w.\-@/: ]+\))?[>#] ?$`),
+	setup:  []string{"terminal length 0", "terminal width 511"},
+	enter:  []string{"configure terminal"},
+	exit:   []string{"end"},
+	save:   []string{"write memory"},
+	reload: []string{"reload", ""},
+	member: "session %s",
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"hostname %[1]s"},
+			show:     "show running-config | include ^hostname",
+			present:  []string{"hostname %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"interface %[1]s", "description %[2]s"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"description %[2]s"},
+		},
+		"InterfaceVLAN": {
+			commands: []string{"interface %[1]s", "switchport mode access", "switchport access vlan %[2]d"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"switchport mode access", "switchport access vlan %[2]d"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"interface %[1]s", "shutdown"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"shutdown"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"interface %[1]s", "no shutdown"},
+			show:     "show running-config interface %[1]s",
+			absent:   []string{"shutdown"},
+		},
+		"CreateVLAN": {commands: []string{"vlan %[1]d", "name %[2]s"}},
+		"DeleteVLAN": {commands: []string{"no vlan %[1]d"}},
+	},
+	vlans: &vlanList{
+		show:    "show vlan brief",
+		pattern: regexp.MustCompile(`(?m)^(?P<id>\d+)\s+(?P<name>\S+)\s+(?:active|suspended|act/\S+|sus/\S+)`),
+	},
+	users: &userSyntax{
+		show:    "show running-config | include ^username",
+		pattern: regexp.MustCompile(`(?m)^username (\S+)`),
+		roles:   map[string]string{"admin": "15", "read-only": "1"},
+		create:  []string{"username %[1]s privilege %[3]s secret %[2]s"},
+		// Recent releases ask for confirmation before removing a user.
+		remove:   []string{"no username %[1]s", ""},
+		addKey:   []string{"ip ssh pubkey-chain", "username %[1]s", "key-string"},
+		endKey:   []string{"exit", "exit", "exit"},
+		keyLine:  72,
+		keyTypes: map[string]string{"ssh-rsa": "ssh-rsa", "ecdsa-sha2-nistp256": "ecdsa", "ecdsa-sha2-nistp384": "ecdsa", "ecdsa-sha2-nistp521": "ecdsa"},
+	},
+	services: map[string]serviceSyntax{
+		"ntp":    {show: "show running-config | include ^ntp server", prefix: "ntp server ", add: "ntp server %s"},
+		"dns":    {show: "show running-config | include ^ip name-server", prefix: "ip name-server ", multi: true, add: "ip name-server %s"},
+		"syslog": {show: "show running-config | include ^logging host", prefix: "logging host ", add: "logging host %s"},
+	},
+	banner: &bannerSyntax{
+		names:     map[string]string{"login": "login", "motd": "motd"},
+		show:      "show banner %s",
+		set:       "banner %s %s",
+		remove:    "no banner %s",
+		delimited: true,
+	},
+	diagnostics: map[string][]string{
+		"basic": iosBasic,
+		"full":  append(append([]string(nil), iosBasic...), "show tech-support"),
+	},
+	// Staging relies on the configuration archive, which must be set up with
+	// "archive path".
+	stage: &stageSyntax{
+		begin:    []string{"configure terminal revert timer %[1]d"},
+		end:      []string{"end"},
+		finalize: []string{"configure confirm", "write memory"},
+		abort:    []string{"configure revert now"},
+		failed:   regexp.MustCompile(`(?m)^% `),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(! (?:Last configuration change|NVRAM config last updated) at ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)^ntp clock-period \d+$`), "ntp clock-period <period>"},
+		{regexp.MustCompile(`(?m)\b(uptime is ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b((?:secret|password|key(?:-string)?) [5789] )\S+`), "${1}<secret>"},
+		{regexp.MustCompile(`(?m)\b(Last input ).*$`), "${1}<time>"},
+		{regexp.MustCompile(`(?m)\b(Last clearing of "show interface" counters ).*$`), "${1}<time>"},
+		{regexp.MustCompile(`\b\d+ (bits|packets)/sec\b`), "<rate> $1/sec"},
+		{regexp.MustCompile(`\b\d+ (packets input|packets output|bytes|input errors|output errors|CRC|frame|overrun|ignored|collisions|interface resets|broadcasts|runts|giants|throttles|unknown protocol drops|underruns)\b`), "<count> $1"},
+	},
+	running:  &runningConfig{"show running-config", config.Indented},
+	rejected: regexp.MustCompile(`(?m)^% (?:Invalid|Incomplete|Ambiguous|Unknown)`),
+	enable:   &enableSyntax{command: "enable", privileged: regexp.MustCompile(`#$`)},
+	config:   regexp.MustCompile(`\(config[^)]*\)#$`),
+	caps: Capabilities{
+		Enable:       true,
+		FileTransfer: "scp",
+		Algorithms: Algorithms{
+			Ciphers:      []string{"aes128-cbc", "3des-cbc"},
+			KeyExchanges: []string{"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1"},
+			HostKeys:     []string{"ssh-rsa"},
+		},
+	},
+}
+
+// junosBasic is the "basic" diagnostics profile of junos.
+var junosBasic = []string{
+	"show version",
+	"show configuration",
+	"show log messages",
+	"show interfaces extensive",
+	"show chassis alarms",
+	"show system core-dumps",
+}
+
+// junos drives Juniper Junos.
+var junos = &driver{
+	name:   "junos",
+	prompt: regexp.MustCompile(`^[\w.\-]+@[\w.\-]+[>#%] ?$`),
+	setup:  []string{"set cli screen-length 0", "set cli screen-width 0"},
+	enter:  []string{"configure"},
+	exit:   []string{"exit configuration-mode"},
+	commit: []string{"commit"},
+	reload: []string{"request system reboot", "yes"},
+	member: "request routing-engine login %s",
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"set system host-name %[1]s"},
+			show:     "show configuration system host-name | display set",
+			present:  []string{"set system host-name %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"set interfaces %[1]s description %[2]s"},
+			show:     "show configuration interfaces %[1]s | display set",
+			present:  []string{"set interfaces %[1]s description %[2]s"},
+		},
+		"InterfaceVLAN": {
+			commands: []string{
+				"set interfaces %[1]s unit 0 family ethernet-switching interface-mode access",
+				"set interfaces %[1]s unit 0 family ethernet-switching vlan members %[2]d",
+			},
+			show: "show configuration interfaces %[1]s | display set",
+			present: []string{
+				"set interfaces %[1]s unit 0 family ethernet-switching interface-mode access",
+				"set interfaces %[1]s unit 0 family ethernet-switching vlan members %[2]d",
+			},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"set interfaces %[1]s disable"},
+			show:     "show configuration interfaces %[1]s | display set",
+			present:  []string{"set interfaces %[1]s disable"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"delete interfaces %[1]s disable"},
+			show:     "show configuration interfaces %[1]s | display set",
+			absent:   []string{"set interfaces %[1]s disable"},
+		},
+		"CreateVLAN": {commands: []string{"set vlans %[2]s vlan-id %[1]d"}},
+		"DeleteVLAN": {commands: []string{"delete vlans %[2]s"}},
+	},
+	vlans: &vlanList{
+		show:    "show configuration vlans | display set",
+		pattern: regexp.MustCompile(`(?m)^set vlans (?P<name>\S+) vlan-id (?P<id>\d+)\s*$`),
+	},
+	users: &userSyntax{
+		show:    "show configuration system login | display set",
+		pattern: regexp.MustCompile(`(?m)^set system login user (\S+) `),
+		roles:   map[string]string{"admin": "super-user", "read-only": "read-only"},
+		create: []string{
+			"set system login user %[1]s class %[3]s",
+			"set system login user %[1]s authentication plain-text-password-value %[2]s",
+		},
+		remove: []string{"delete system login user %[1]s"},
+		addKey: []string{"set system login user %[1]s authentication %[2]s %[3]s"},
+		keyTypes: map[string]string{
+			"ssh-rsa":             "ssh-rsa",
+			"ssh-ed25519":         "ssh-ed25519",
+			"ecdsa-sha2-nistp256": "ssh-ecdsa",
+			"ecdsa-sha2-nistp384": "ssh-ecdsa",
+			"ecdsa-sha2-nistp521": "ssh-ecdsa",
+		},
+	},
+	services: map[string]serviceSyntax{
+		"ntp":    {show: "show configuration system ntp | display set", prefix: "set system ntp server ", add: "set system ntp server %s"},
+		"dns":    {show: "show configuration system name-server | display set", prefix: "set system name-server ", add: "set system name-server %s"},
+		"syslog": {show: "show configuration system syslog | display set", prefix: "set system syslog host ", add: "set system syslog host %s any notice"},
+	},
+	banner: &bannerSyntax{
+		names:   map[string]string{"login": "message", "motd": "announcement"},
+		show:    "show configuration system login %s",
+		set:     "set system login %s %s",
+		remove:  "delete system login %s",
+		pattern: regexp.MustCompile(`(?m)^\s*\S+ (".*"|\S+);\s*$`),
+	},
+	quote: true,
+	diagnostics: map[string][]string{
+		"basic": junosBasic,
+		"full":  append(append([]string(nil), junosBasic...), "request support information"),
+	},
+	stage: &stageSyntax{
+		begin:    []string{"configure"},
+		end:      []string{"commit confirmed %[1]d", "exit configuration-mode"},
+		finalize: []string{"configure", "commit", "exit configuration-mode"},
+		abort:    []string{"configure", "rollback 1", "commit", "exit configuration-mode"},
+		failed:   regexp.MustCompile(`(?m)^error: |commit failed|syntax error`),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(## Last (?:commit|changed): ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)^((?:Current time|System booted|Protocols started|Last configured): ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`"\$(\d+)\$[^"]*"`), `"$$${1}$$<secret>"`},
+		{regexp.MustCompile(`\b((?:Input|Output) (?:packets|bytes|errors)\s*:\s*)\d+(?: +\d+ [bp]ps)?`), "${1}<count>"},
+		{regexp.MustCompile(`(?m)\b(Last flapped\s*: ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)\b(Statistics last cleared: ).*$`), "${1}<timestamp>"},
+	},
+	json:        "%s | display json",
+	xml:         "%s | display xml",
+	xmlWrappers: []string{"rpc-reply"},
+	commitLabel: []string{"commit comment %[1]s"},
+	running:     &runningConfig{"show configuration | display set", config.Set},
+	rejected:    regexp.MustCompile(`(?m)^(?:error: |syntax error|unknown command)`),
+	config:      regexp.MustCompile(`#$`),
+	caps: Capabilities{
+		Commit:       true,
+		Rollback:     true,
+		JSON:         true,
+		XML:          true,
+		FileTransfer: "scp",
+		Algorithms: Algorithms{
+			HostKeys: []string{"ssh-rsa"},
+		},
+	},
+}
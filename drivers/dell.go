@@ -0,0 +1,213 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"regexp"
+)
+
+func init() {
+	Register("os10", func() Driver { return os10 })
+	RegisterAlias("dellos10", "os10")
+	RegisterAlias("dell-os10", "os10")
+	Register("os9", func() Driver { return os9 })
+	RegisterAlias("dellos9", "os9")
+	RegisterAlias("dell-os9", "os9")
+	RegisterAlias("ftos", "os9")
+	RegisterAlias("force10", "os9")
+}
+
+// dellPrompt matches the prompts of both Dell operating systems, such as
+// "OS10#" and "Dell(conf-if-te-0/1)#".
+var dellPrompt = regexp.MustCompile(`^[\w.\-]+(?:\([\w.\-/: ]+\))?[>#] ?$`)
+
+// os10Basic is the "basic" diagnostics profile of os10.
+var os10Basic = []string{
+	"show version",
+	"show running-configuration",
+	"show logging log-file",
+	"show interface",
+	"show processes node-id 1",
+	"show environment",
+	"show system",
+}
+
+// os10 drives Dell EMC Networking OS10, whose commands spell out
+// "running-configuration" in full.
+var os10 = &driver{
+	name:   "os10",
+	prompt: dellPrompt,
+	setup:  []string{"terminal length 0"},
+	enter:  []string{"configure terminal"},
+	exit:   []string{"end"},
+	save:   []string{"copy running-configuration startup-configuration"},
+	reload: []string{"reload", "yes"},
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"hostname %[1]s"},
+			show:     "show running-configuration | grep hostname",
+			present:  []string{"hostname %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"interface %[1]s", "description %[2]s"},
+			show:     "show running-configuration interface %[1]s",
+			present:  []string{"description %[2]s"},
+		},
+		"InterfaceVLAN": {
+			commands: []string{"interface %[1]s", "switchport mode access", "switchport access vlan %[2]d"},
+			show:     "show running-configuration interface %[1]s",
+			present:  []string{"switchport access vlan %[2]d"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"interface %[1]s", "shutdown"},
+			show:     "show running-configuration interface %[1]s",
+			present:  []string{"shutdown"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"interface %[1]s", "no shutdown"},
+			show:     "show running-configuration interface %[1]s",
+			present:  []string{"no shutdown"},
+		},
+		"CreateVLAN": {commands: []string{"interface vlan %[1]d", "description %[2]s"}},
+		"DeleteVLAN": {commands: []string{"no interface vlan %[1]d"}},
+	},
+	// OS10 names VLANs with their description, which is blank for VLANs
+	// without one.
+	vlans: &vlanList{
+		show:    "show vlan",
+		pattern: regexp.MustCompile(`(?m)^\*?[ \t]+(?P<id>\d+)[ \t]+(?:Active|Inactive) {1,4}(?P<name>\S*)`),
+	},
+	users: &userSyntax{
+		show:    "show running-configuration | grep username",
+		pattern: regexp.MustCompile(`(?m)^username (\S+)`),
+		roles:   map[string]string{"admin": "sysadmin", "read-only": "netoperator"},
+		create:  []string{"username %[1]s password %[2]s role %[3]s"},
+		remove:  []string{"no username %[1]s"},
+	},
+	services: map[string]serviceSyntax{
+		"ntp":    {show: "show running-configuration | grep ntp", prefix: "ntp server ", add: "ntp server %s"},
+		"dns":    {show: "show running-configuration | grep name-server", prefix: "ip name-server ", multi: true, add: "ip name-server %s"},
+		"syslog": {show: "show running-configuration | grep logging", prefix: "logging server ", add: "logging server %s"},
+	},
+	diagnostics: map[string][]string{
+		"basic": os10Basic,
+		"full":  append(append([]string(nil), os10Basic...), "show tech-support"),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(! Last configuration change at ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)^(Up Time: ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b(password )\$\S+`), "${1}<secret>"},
+		{regexp.MustCompile(`\b\d+ (Mbits|packets)/sec\b`), "<rate> $1/sec"},
+		{regexp.MustCompile(`\b\d+ (packets|octets|CRC|runts|giants|throttles|input errors|output errors|discarded|collisions)\b`), "<count> $1"},
+	},
+	running:  &runningConfig{"show running-configuration", config.Indented},
+	rejected: regexp.MustCompile(`(?m)^% (?:Error|Invalid|Incomplete|Ambiguous)`),
+	caps: Capabilities{
+		FileTransfer: "scp",
+	},
+}
+
+// os9Basic is the "basic" diagnostics profile of os9.
+var os9Basic = []string{
+	"show version",
+	"show running-config",
+	"show logging",
+	"show interfaces",
+	"show processes cpu",
+	"show environment",
+}
+
+// os9 drives Dell Networking OS9, formerly FTOS, whose sessions start
+// unprivileged like those of IOS. Ports join a VLAN from the VLAN's
+// interface rather than their own.
+var os9 = &driver{
+	name:   "os9",
+	prompt: dellPrompt,
+	setup:  []string{"terminal length 0"},
+	enter:  []string{"configure terminal"},
+	exit:   []string{"end"},
+	save:   []string{"write memory"},
+	reload: []string{"reload", "yes"},
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"hostname %[1]s"},
+			show:     "show running-config | grep hostname",
+			present:  []string{"hostname %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"interface %[1]s", "description %[2]s"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"description %[2]s"},
+		},
+		"InterfaceVLAN": {
+			commands: []string{"interface %[1]s", "switchport", "exit", "interface vlan %[2]d", "untagged %[1]s"},
+			show:     "show running-config interface vlan %[2]d",
+			present:  []string{"untagged %[1]s"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"interface %[1]s", "shutdown"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"shutdown"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"interface %[1]s", "no shutdown"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"no shutdown"},
+		},
+		"CreateVLAN": {commands: []string{"interface vlan %[1]d", "name %[2]s"}},
+		"DeleteVLAN": {commands: []string{"no interface vlan %[1]d"}},
+	},
+	// The name column of "show vlan brief" starts in the sixth column, and
+	// is blank for VLANs without one.
+	vlans: &vlanList{
+		show:    "show vlan brief",
+		pattern: regexp.MustCompile(`(?m)^(?P<id>\d+) {1,4}(?P<name>\S*)`),
+	},
+	users: &userSyntax{
+		show:    "show running-config | grep username",
+		pattern: regexp.MustCompile(`(?m)^username (\S+)`),
+		roles:   map[string]string{"admin": "15", "read-only": "1"},
+		create:  []string{"username %[1]s password %[2]s privilege %[3]s"},
+		remove:  []string{"no username %[1]s"},
+	},
+	services: map[string]serviceSyntax{
+		"ntp": {show: "show running-config ntp", prefix: "ntp server ", add: "ntp server %s"},
+		"dns": {show: "show running-config | grep name-server", prefix: "ip name-server ", multi: true, add: "ip name-server %s"},
+	},
+	diagnostics: map[string][]string{
+		"basic": os9Basic,
+		"full":  append(append([]string(nil), os9Basic...), "show tech-support"),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(! (?:Last configuration change|Startup-config last updated) at ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)\b(uptime is ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b((?:secret|password) [57] )\S+`), "${1}<secret>"},
+		{regexp.MustCompile(`\b\d+ (Mbits|packets)/sec\b`), "<rate> $1/sec"},
+		{regexp.MustCompile(`\b\d+ (packets|bytes|CRC|runts|giants|throttles|input errors|output errors|discarded|collisions)\b`), "<count> $1"},
+	},
+	running:  &runningConfig{"show running-config", config.Indented},
+	rejected: regexp.MustCompile(`(?m)^% (?:Error|Invalid|Incomplete|Ambiguous)`),
+	enable:   &enableSyntax{command: "enable", privileged: regexp.MustCompile(`#$`)},
+	caps: Capabilities{
+		Enable: true,
+	},
+}
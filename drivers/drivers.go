@@ -0,0 +1,529 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package drivers describes how to automate the command line of each family
+// of network operating systems. A Driver knows what the device's prompt looks
+// like, how to prepare a session for automation, and how to enter, commit,
+// leave, and save configuration mode.
+//
+// Drivers are registered by name, so that inventories can refer to them by
+// platform string and third-party packages can add support for more platforms
+// without modifying this one:
+//
+//	func init() {
+//		drivers.Register("acmeos", func() drivers.Driver { return &acme{} })
+//	}
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Driver describes how to interact with the command line of a family of
+// network operating systems.
+type Driver interface {
+	// Name returns the name the driver is registered under.
+	Name() string
+
+	// Prompt returns a pattern matching a line that holds only the device's
+	// prompt, in any mode.
+	Prompt() *regexp.Regexp
+
+	// Setup returns the commands that prepare a new session for automation,
+	// such as disabling paging.
+	Setup() []string
+
+	// ConfigMode returns the commands that enter and leave configuration
+	// mode.
+	ConfigMode() (enter, exit []string)
+
+	// Commit returns the commands, run in configuration mode, that activate
+	// pending changes. Platforms that apply changes immediately return none.
+	Commit() []string
+
+	// Save returns the commands, run after leaving configuration mode, that
+	// persist the running configuration across reloads.
+	Save() []string
+
+	// Capabilities describes the features of the platform, so that generic
+	// tooling can adapt without knowing which platform it is talking to.
+	Capabilities() Capabilities
+}
+
+// Waker is implemented by drivers of devices that present a prompt only after
+// receiving input, such as those reached through some console servers.
+type Waker interface {
+	// Wake returns the sequence, such as "\r\n", that makes the device print
+	// its prompt.
+	Wake() string
+}
+
+// MemberSwitcher is implemented by drivers of platforms made up of several
+// members sharing one management address, such as switch stacks and chassis
+// with redundant routing engines.
+type MemberSwitcher interface {
+	// Member returns the commands that move the session to the member
+	// identified by id, such as "2" or "other-routing-engine", and the
+	// commands that return it to the primary.
+	Member(id string) (enter, exit []string)
+}
+
+// ModeSwitcher is implemented by drivers of platforms with command modes
+// beyond configuration mode, such as the admin mode of IOS XR.
+type ModeSwitcher interface {
+	// Mode returns the commands that enter the named mode and those that
+	// leave it, or nil if the platform has no such mode.
+	Mode(name string) (enter, exit []string)
+}
+
+// ConfigPrompter is implemented by drivers of platforms whose prompt shows
+// whether the session is in configuration mode, such as VyOS, whose prompt
+// ends in "$" in operational mode and "#" in configuration mode.
+type ConfigPrompter interface {
+	// ConfigPrompt returns a pattern matching the prompt of configuration
+	// mode.
+	ConfigPrompt() *regexp.Regexp
+}
+
+// ContextSwitcher is implemented by drivers of platforms that partition a
+// device into virtual devices sharing one management session, such as the
+// security contexts of ASA.
+type ContextSwitcher interface {
+	// Context returns the commands that move the session to the named
+	// context and those that return it to the system context, or nil if the
+	// platform has no contexts.
+	Context(name string) (enter, exit []string)
+}
+
+// Enabler is implemented by drivers of platforms whose sessions start in an
+// unprivileged mode, left with "enable" or its equivalent before most
+// commands can be run.
+type Enabler interface {
+	// Enable returns the command that enters privileged mode, the steps
+	// that answer its prompts with password, and a pattern matching the
+	// prompt of privileged mode. The command is empty if the platform has
+	// no privileged mode.
+	Enable(password string) (cmd string, steps []Step, privileged *regexp.Regexp)
+}
+
+// Reloader is implemented by drivers that know how to reload their platform.
+type Reloader interface {
+	// Reload returns the command that reloads the device followed by the
+	// replies that confirm it, or nil if the platform cannot be reloaded
+	// from its shell.
+	Reload() []string
+}
+
+// RunningConfiger is implemented by drivers that can show the running
+// configuration in a syntax that the commands changing it share, so that the
+// two can be compared.
+type RunningConfiger interface {
+	// RunningConfig returns the command that shows the running
+	// configuration and the format of its output. The command is empty if
+	// the platform cannot show its configuration that way.
+	RunningConfig() (cmd string, format config.Format)
+}
+
+// Diagnostician is implemented by drivers that know which commands gather the
+// information vendors ask for in support cases.
+type Diagnostician interface {
+	// Diagnostics returns the commands of the named profile, or nil if the
+	// driver has no such profile. Drivers should provide "basic", a quick
+	// overview, and "full", which adds the platform's complete support
+	// bundle, such as "show tech-support".
+	Diagnostics(profile string) []string
+}
+
+// Change is a configuration change generated by a driver: the commands that
+// make it, run in configuration mode, and how to confirm it took effect.
+type Change struct {
+	Commands []string
+
+	// Show is a command that displays the affected configuration. Once the
+	// change is made, every line of Present, and none of Absent, appears in
+	// its output, ignoring surrounding whitespace.
+	Show            string
+	Present, Absent []string
+}
+
+// InterfaceConfigurer is implemented by drivers that can generate the changes
+// that provision a single interface. A Change with no Commands means the
+// platform does not support it.
+type InterfaceConfigurer interface {
+	InterfaceDescription(intf, desc string) Change
+	InterfaceVLAN(intf string, vlan int) Change
+	InterfaceShutdown(intf string, shutdown bool) Change
+}
+
+// VLAN is a VLAN configured on a switch.
+type VLAN struct {
+	ID   int
+	Name string
+}
+
+// VLANConfigurer is implemented by drivers that can list, create, and delete
+// VLANs.
+type VLANConfigurer interface {
+	// ListVLANs returns the command that lists the configured VLANs and a
+	// function parsing its output.
+	ListVLANs() (cmd string, parse func(output string) []VLAN)
+
+	// CreateVLAN returns the change creating VLAN id, or renaming it if it
+	// exists. An empty name means "VLAN" and the zero-padded ID, such as
+	// "VLAN0010".
+	CreateVLAN(id int, name string) Change
+
+	// DeleteVLAN returns the change deleting VLAN id, which is named name.
+	DeleteVLAN(id int, name string) Change
+}
+
+// BannerConfigurer is implemented by drivers that can read and set banners.
+// Kind is "login", shown before authentication, or "motd", shown after it.
+type BannerConfigurer interface {
+	// Banner returns the command that displays the banner of kind and a
+	// function extracting its text from the command's output. The command is
+	// empty if the platform has no such banner.
+	Banner(kind string) (cmd string, parse func(output string) string)
+
+	// SetBanner returns the change setting the banner of kind to text, which
+	// may span several lines, or removing it if text is empty.
+	SetBanner(kind, text string) Change
+}
+
+// LocalUser is an account defined in a device's configuration.
+type LocalUser struct {
+	Name     string
+	Password string
+
+	// Role is "admin" or "read-only", which drivers translate into the
+	// platform's privilege level or login class, or a platform-specific
+	// value, such as "7" on IOS, used as is.
+	Role string
+}
+
+// UserConfigurer is implemented by drivers that can manage local users.
+type UserConfigurer interface {
+	// ListUsers returns the command that lists the local users and a function
+	// parsing their names from its output.
+	ListUsers() (cmd string, parse func(output string) []string)
+
+	CreateUser(user LocalUser) Change
+	RemoveUser(name string) Change
+
+	// AddSSHKey returns the change authorizing the public key, in
+	// authorized_keys format, to log in as the user name.
+	AddSSHKey(name, authorizedKey string) Change
+}
+
+// HostnameConfigurer is implemented by drivers that can set a device's host
+// name.
+type HostnameConfigurer interface {
+	Hostname(name string) Change
+}
+
+// ServiceConfigurer is implemented by drivers that can configure the servers a
+// device uses for network services. Service is "ntp", "dns", or "syslog".
+type ServiceConfigurer interface {
+	// Servers returns the command that shows the servers configured for
+	// service and a function parsing them from its output. The command is
+	// empty if the platform does not support service.
+	Servers(service string) (cmd string, parse func(output string) []string)
+
+	// AddServers returns the change that adds servers to those configured
+	// for service.
+	AddServers(service string, servers ...string) Change
+}
+
+// Step is one exchange of an interactive sequence: once the device prints
+// output whose last line matches Expect, Send is written to it verbatim.
+type Step struct {
+	Expect *regexp.Regexp
+	Send   string
+}
+
+// Stager is implemented by drivers of platforms that can apply a change
+// provisionally, such as with a confirmed commit that is rolled back unless
+// confirmed in time, so that changes to several devices can be committed
+// together or not at all.
+type Stager interface {
+	// Stage returns the commands that apply cmds provisionally, to be rolled
+	// back by the device after minutes unless finalized.
+	Stage(cmds []string, minutes int) []string
+
+	// Finalize returns the commands that make a staged change permanent.
+	Finalize() []string
+
+	// Abort returns the commands that roll a staged change back at once.
+	Abort() []string
+
+	// StageFailed returns a pattern matching output showing that a change
+	// was not staged, such as a commit error.
+	StageFailed() *regexp.Regexp
+}
+
+// LineEnder is implemented by drivers of devices that expect commands to end
+// in something other than a line feed, such as the carriage return and line
+// feed of Windows consoles.
+type LineEnder interface {
+	LineEnding() string
+}
+
+// ExitStatuser is implemented by drivers of shells that can report whether a
+// command succeeded, such as PowerShell with $LASTEXITCODE.
+type ExitStatuser interface {
+	// ExitStatus returns the command that prints the exit status of the
+	// command before it and a function parsing the status from its output.
+	// The command is empty if the shell cannot report it.
+	ExitStatus() (cmd string, parse func(output string) (int, bool))
+}
+
+// CommitLabeler is implemented by drivers of platforms that can label a
+// commit, so that it can be found in the commit history and rolled back to.
+type CommitLabeler interface {
+	// LabeledCommit returns the commands that replace those of Commit to
+	// commit with label, or nil if the platform does not label commits.
+	LabeledCommit(label string) []string
+}
+
+// JSONFormatter is implemented by drivers of platforms that can print the
+// output of show commands as JSON.
+type JSONFormatter interface {
+	// JSON returns the command that prints the output of cmd as JSON, or an
+	// empty string if it cannot.
+	JSON(cmd string) string
+}
+
+// XMLFormatter is implemented by drivers of platforms that can print the
+// output of show commands as XML, which on some platforms is richer than their
+// JSON.
+type XMLFormatter interface {
+	// XML returns the command that prints the output of cmd as XML, or an
+	// empty string if it cannot, and the names of the elements that wrap the
+	// output, such as "rpc-reply" on Junos, outermost first.
+	XML(cmd string) (xmlCmd string, wrappers []string)
+}
+
+// Checkpointer is implemented by drivers of platforms that can save the
+// running configuration as a named checkpoint and roll back to it later.
+type Checkpointer interface {
+	Checkpoint(name string) []string
+	Rollback(name string) []string
+}
+
+// Rejecter is implemented by drivers that can tell when the device refused a
+// command, which most platforms report only in their output.
+type Rejecter interface {
+	// Rejected returns a pattern matching a line of output in which the
+	// device reports that a command failed.
+	Rejected() *regexp.Regexp
+}
+
+// A Mask replaces the text matching Pattern with Replacement, which may refer
+// to submatches as in regexp.Regexp.ReplaceAllString.
+type Mask struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// VolatileMasker is implemented by drivers that know which parts of their
+// platform's output change on their own, such as timestamps, uptimes,
+// counters, and encrypted secrets, so that they can be masked before output is
+// compared.
+type VolatileMasker interface {
+	// VolatileMasks returns the masks to apply, in order.
+	VolatileMasks() []Mask
+}
+
+// LoginSequencer is implemented by drivers of devices that ask for
+// credentials again inside the shell after SSH authentication, as happens with
+// TACACS+ fallbacks and console concentrators.
+type LoginSequencer interface {
+	// LoginSequence returns the steps that log in as user with password.
+	LoginSequence(user, password string) []Step
+}
+
+// DefaultLogin returns the login sequence used for drivers that do not
+// implement LoginSequencer: it answers "Username:" and "Password:" prompts.
+func DefaultLogin(user, password string) []Step {
+	return []Step{
+		{Expect: usernamePrompt, Send: user + "\n"},
+		{Expect: passwordPrompt, Send: password + "\n"},
+	}
+}
+
+// DefaultPasswordChange returns the steps that answer a forced change of an
+// expired password: prompts for the current password are answered with old,
+// and prompts to choose or confirm a new one with new.
+func DefaultPasswordChange(old, new string) []Step {
+	return []Step{
+		{Expect: newPasswordPrompt, Send: new + "\n"},
+		{Expect: oldPasswordPrompt, Send: old + "\n"},
+	}
+}
+
+// CommonMasks are the masks used for drivers that do not implement
+// VolatileMasker, and that the built-in drivers apply after their own: they
+// mask dates and times of day.
+var CommonMasks = []Mask{
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<timestamp>"},
+	{regexp.MustCompile(`\b(?:(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) )?(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d{1,2}(?: \d{4})? \d{1,2}:\d{2}:\d{2}(?:\.\d+)?(?: [A-Z]{3,4})?(?: \d{4})?`), "<timestamp>"},
+	{regexp.MustCompile(`\b\d{1,2}:\d{2}:\d{2}(?:\.\d+)?\b`), "<time>"},
+}
+
+// VolatileMasks returns the volatile masks of driver, or CommonMasks if it
+// does not implement VolatileMasker.
+func VolatileMasks(driver Driver) []Mask {
+	if masker, ok := driver.(VolatileMasker); ok {
+		return masker.VolatileMasks()
+	}
+	return CommonMasks
+}
+
+var (
+	usernamePrompt    = regexp.MustCompile(`(?i)(?:user ?name|login): ?$`)
+	passwordPrompt    = regexp.MustCompile(`(?i)password: ?$`)
+	oldPasswordPrompt = regexp.MustCompile(`(?i)(?:old|current|existing|unix)\b.*password: ?$`)
+	newPasswordPrompt = regexp.MustCompile(`(?i)(?:new|retype|re-?enter|confirm|verify)\b.*password.*: ?$|password again: ?$`)
+)
+
+// Capabilities describes the features a platform supports.
+type Capabilities struct {
+	Commit   bool // changes take effect only once committed
+	Rollback bool // previous configurations can be restored
+	JSON     bool // show commands can produce JSON output
+	XML      bool // show commands can produce XML output
+	Enable   bool // configuration requires entering privileged mode first
+
+	// FileTransfer names the protocol used to copy files to the device, such
+	// as "scp" or "sftp", or is empty if files cannot be copied.
+	FileTransfer string
+
+	// Algorithms lists SSH algorithms that devices of the platform may
+	// require beyond those an SSH client offers by default, typically legacy
+	// ciphers and key exchanges on older releases.
+	Algorithms Algorithms
+}
+
+// Algorithms lists SSH algorithms by their protocol names.
+type Algorithms struct {
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+	HostKeys     []string
+}
+
+// Factory returns a Driver. It is called each time the driver is looked up, so
+// drivers that keep per-session state can return a fresh instance.
+type Factory func() Driver
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+	aliases   = make(map[string]string)
+)
+
+// normalize converts a name or platform string, such as "Cisco_IOS", into the
+// form it is registered under, such as "cisco-ios".
+func normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "-", "_", "-").Replace(name)
+}
+
+// Register makes a driver available by name. It panics if the name is empty,
+// if factory is nil, or if the name is already registered.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	name = normalize(name)
+	if name == "" || factory == nil {
+		panic("drivers: Register requires a name and a factory")
+	}
+	if _, dup := factories[name]; dup {
+		panic("drivers: Register called twice for driver " + name)
+	}
+	if _, dup := aliases[name]; dup {
+		panic("drivers: Register called with alias " + name)
+	}
+	factories[name] = factory
+}
+
+// RegisterAlias makes the driver registered as name also available as alias,
+// so that platform strings used by inventories, such as "cisco_ios", resolve
+// to it. It panics if alias is already registered.
+func RegisterAlias(alias, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	alias, name = normalize(alias), normalize(name)
+	if _, dup := factories[alias]; dup {
+		panic("drivers: RegisterAlias called with driver name " + alias)
+	}
+	if _, dup := aliases[alias]; dup {
+		panic("drivers: RegisterAlias called twice for alias " + alias)
+	}
+	aliases[alias] = name
+}
+
+// Lookup returns the driver registered under name or one of its aliases.
+// Names are matched regardless of case, and spaces and underscores match
+// hyphens.
+func Lookup(name string) (Driver, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	key := normalize(name)
+	if target, ok := aliases[key]; ok {
+		key = target
+	}
+	factory, ok := factories[key]
+	if !ok {
+		return nil, errors.Errorf("unknown driver %q", name)
+	}
+	return factory(), nil
+}
+
+// Names returns the sorted names of the registered drivers, not including
+// aliases.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configure returns the full sequence of commands that applies lines with
+// driver: entering configuration mode, the lines themselves, committing,
+// leaving configuration mode, and saving.
+func Configure(driver Driver, lines ...string) []string {
+	enter, exit := driver.ConfigMode()
+	var cmds []string
+	cmds = append(cmds, enter...)
+	cmds = append(cmds, lines...)
+	cmds = append(cmds, driver.Commit()...)
+	cmds = append(cmds, exit...)
+	return append(cmds, driver.Save()...)
+}
@@ -0,0 +1,97 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package drivers_test contains tests, benchmarks, and examples for package
+// drivers.
+package drivers_test
+
+import (
+	"fmt"
+	"github.com/mwalto7/device/drivers"
+	"log"
+)
+
+func ExampleLookup() {
+	driver, err := drivers.Lookup("Cisco_IOS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(driver.Name())
+	fmt.Println(driver.Prompt().MatchString("sw1(config-if)#"))
+	// Output:
+	// ios
+	// true
+}
+
+func ExampleLookupOrGeneric() {
+	driver := drivers.LookupOrGeneric("acmeos")
+	fmt.Println(driver.Name())
+	for _, line := range []string{"sw1(config)#", "<sw2>", "[admin@fw1 ~]$", "Total: 12 >", "100%"} {
+		fmt.Println(driver.Prompt().MatchString(line))
+	}
+	// Output:
+	// generic
+	// true
+	// true
+	// true
+	// false
+	// false
+}
+
+func ExampleConfigure() {
+	driver, err := drivers.Lookup("junos")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, cmd := range drivers.Configure(driver, "set system host-name r1") {
+		fmt.Println(cmd)
+	}
+	// Output:
+	// configure
+	// set system host-name r1
+	// commit
+	// exit configuration-mode
+}
+
+func ExampleInterfaceConfigurer() {
+	driver, err := drivers.Lookup("junos")
+	if err != nil {
+		log.Fatal(err)
+	}
+	change := driver.(drivers.InterfaceConfigurer).InterfaceDescription("ge-0/0/1", "uplink to core")
+	fmt.Println(change.Commands[0])
+	fmt.Println(change.Show)
+	// Output:
+	// set interfaces ge-0/0/1 description "uplink to core"
+	// show configuration interfaces ge-0/0/1 | display set
+}
+
+func ExampleDriver_Capabilities() {
+	for _, name := range []string{"ios", "junos"} {
+		driver, err := drivers.Lookup(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if driver.Capabilities().Commit {
+			fmt.Println(name, "requires commit")
+		}
+	}
+	// Output: junos requires commit
+}
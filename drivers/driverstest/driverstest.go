@@ -0,0 +1,294 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package driverstest checks that a driver handles prompts, paging,
+// configuration mode, and refused commands like the built-in drivers do, by
+// running it against a devicetest.Server that imitates its platform. Authors
+// of third-party drivers can use it to test them without hardware:
+//
+//	func TestDriver(t *testing.T) {
+//		driverstest.Run(t, &acme{}, driverstest.Fixture{
+//			Prompt:       "acme1#",
+//			ConfigPrompt: "acme1(config)#",
+//			Pager:        "--More--",
+//			PagerOff:     "terminal length 0",
+//			Rejected:     "% Unknown command",
+//		})
+//	}
+package driverstest
+
+import (
+	"github.com/mwalto7/device/device"
+	"github.com/mwalto7/device/device/devicetest"
+	"github.com/mwalto7/device/drivers"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Fixture describes how devices of a driver's platform behave.
+type Fixture struct {
+	// Prompt is the platform's prompt at the start of a session, and
+	// ConfigPrompt, if set, its prompt in configuration mode.
+	Prompt       string
+	ConfigPrompt string
+
+	// Output is typical output of a show command, none of whose lines may
+	// be taken for a prompt or a refused command. If empty, DefaultOutput is
+	// used.
+	Output string
+
+	// Pager, if set, is the pager prompt at which the platform cuts long
+	// output short until PagerOff, which must be one of the driver's setup
+	// commands, turns paging off.
+	Pager    string
+	PagerOff string
+
+	// Rejected, if set, is the line with which the platform refuses a
+	// command, which the driver must recognize as a drivers.Rejecter.
+	Rejected string
+}
+
+// DefaultOutput is the show command output used for fixtures without one.
+const DefaultOutput = `GigabitEthernet0/1 is up, line protocol is up
+  Description: uplink to core #1 > core #2
+  5 minute input rate 1000 bits/sec, 2 packets/sec
+  Last clearing of counters never
+Total entries displayed: 1
+`
+
+// Commands the server knows besides the driver's own.
+const (
+	showCommand   = "show conformance"
+	changeCommand = "hostname conformance"
+	bogusCommand  = "conformance bogus"
+)
+
+// invalid is what a devicetest.Server prints for commands it does not know.
+const invalid = "% Invalid input detected"
+
+// Run checks driver against fixture, reporting each problem found as an
+// error of t.
+func Run(t testing.TB, driver drivers.Driver, fixture Fixture) {
+	t.Helper()
+	for _, err := range Check(driver, fixture) {
+		t.Error(err)
+	}
+}
+
+// Check checks driver against fixture and returns the problems found.
+func Check(driver drivers.Driver, fixture Fixture) []error {
+	if fixture.Output == "" {
+		fixture.Output = DefaultOutput
+	}
+	errs := checkPatterns(driver, fixture)
+	if driver.Prompt() == nil || fixture.Prompt == "" {
+		return append(errs, errors.New("a prompt pattern and a fixture prompt are required to run sessions"))
+	}
+	server := newServer(driver, fixture)
+	defer server.Close()
+	d, err := device.Dial(server.Addr, "conformance", device.Password("conformance"),
+		device.WithDriver(driver), device.WithCommandTimeout(5*time.Second))
+	if err != nil {
+		return append(errs, errors.Wrap(err, "failed to connect to the test server"))
+	}
+	defer d.Close()
+	errs = append(errs, checkShow(d, fixture)...)
+	errs = append(errs, checkConfigure(d, driver, fixture)...)
+	return append(errs, checkRejected(d, driver, fixture)...)
+}
+
+// checkPatterns checks the driver's patterns against the fixture's lines.
+func checkPatterns(driver drivers.Driver, fixture Fixture) []error {
+	var errs []error
+	prompt := driver.Prompt()
+	if prompt == nil {
+		return []error{errors.New("the driver has no prompt pattern")}
+	}
+	for _, p := range []string{fixture.Prompt, fixture.ConfigPrompt} {
+		if p != "" && !prompt.MatchString(p) && !prompt.MatchString(strings.TrimRight(p, " ")) {
+			errs = append(errs, errors.Errorf("the prompt pattern does not match %q", p))
+		}
+	}
+	lines := strings.Split(strings.TrimRight(fixture.Output, "\n"), "\n")
+	for _, line := range lines {
+		if prompt.MatchString(line) {
+			errs = append(errs, errors.Errorf("the prompt pattern matches the output line %q", line))
+		}
+	}
+	if prompter, ok := driver.(drivers.ConfigPrompter); ok && prompter.ConfigPrompt() != nil {
+		config := prompter.ConfigPrompt()
+		if fixture.ConfigPrompt != "" && !config.MatchString(strings.TrimRight(fixture.ConfigPrompt, " ")) {
+			errs = append(errs, errors.Errorf("the configuration prompt pattern does not match %q", fixture.ConfigPrompt))
+		}
+		if config.MatchString(strings.TrimRight(fixture.Prompt, " ")) {
+			errs = append(errs, errors.Errorf("the configuration prompt pattern matches %q", fixture.Prompt))
+		}
+	}
+	if fixture.PagerOff != "" && !contains(driver.Setup(), fixture.PagerOff) {
+		errs = append(errs, errors.Errorf("setup does not turn paging off with %q", fixture.PagerOff))
+	}
+	if fixture.Rejected == "" {
+		return errs
+	}
+	rejecter, ok := driver.(drivers.Rejecter)
+	if !ok || rejecter.Rejected() == nil {
+		return append(errs, errors.New("the driver does not recognize refused commands"))
+	}
+	if !rejecter.Rejected().MatchString(fixture.Rejected) {
+		errs = append(errs, errors.Errorf("the refused command pattern does not match %q", fixture.Rejected))
+	}
+	for _, line := range lines {
+		if rejecter.Rejected().MatchString(line) {
+			errs = append(errs, errors.Errorf("the refused command pattern matches the output line %q", line))
+		}
+	}
+	return errs
+}
+
+// checkShow runs a show command in a session set up by the driver.
+func checkShow(d *device.Device, fixture Fixture) []error {
+	result, err := d.Run(showCommand, "exit")
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to run a show command")}
+	}
+	var errs []error
+	if strings.Contains(string(result.Output), invalid) {
+		errs = append(errs, errors.New("setup sent a command the platform does not know"))
+	}
+	if fixture.Pager != "" && strings.Contains(string(result.Output), fixture.Pager) {
+		errs = append(errs, errors.New("setup did not turn paging off"))
+	}
+	output := result.Commands[0].Output
+	if output == nil {
+		return append(errs, errors.New("the output of a show command could not be told apart"))
+	}
+	if strings.TrimSpace(string(output)) != strings.TrimSpace(fixture.Output) {
+		errs = append(errs, errors.Errorf("the output of a show command is %q, not %q", output, fixture.Output))
+	}
+	return errs
+}
+
+// checkConfigure makes a change with the driver's configuration sequence.
+func checkConfigure(d *device.Device, driver drivers.Driver, fixture Fixture) []error {
+	result, err := d.Configure(changeCommand)
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to configure")}
+	}
+	var errs []error
+	if strings.Contains(string(result.Output), invalid) {
+		errs = append(errs, errors.New("configuration sent a command the platform does not know"))
+	}
+	enter, _ := driver.ConfigMode()
+	for _, cmd := range result.Commands {
+		if cmd.Output == nil {
+			errs = append(errs, errors.Errorf("the output of %q could not be told apart", cmd.Command))
+		}
+	}
+	if len(enter) > 0 && fixture.ConfigPrompt != "" && !strings.Contains(string(result.Output), strings.TrimSpace(fixture.ConfigPrompt)) {
+		errs = append(errs, errors.New("configuration mode was not entered"))
+	}
+	if rejecter, ok := driver.(drivers.Rejecter); ok && rejecter.Rejected() != nil {
+		if line := rejecter.Rejected().FindString(string(result.Output)); line != "" {
+			errs = append(errs, errors.Errorf("a successful change was taken as refused: %q", line))
+		}
+	}
+	return errs
+}
+
+// checkRejected runs a command the platform refuses.
+func checkRejected(d *device.Device, driver drivers.Driver, fixture Fixture) []error {
+	rejecter, ok := driver.(drivers.Rejecter)
+	if fixture.Rejected == "" || !ok || rejecter.Rejected() == nil {
+		return nil
+	}
+	result, err := d.Run(bogusCommand, "exit")
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to run a refused command")}
+	}
+	if output := result.Commands[0].Output; !rejecter.Rejected().Match(output) {
+		return []error{errors.Errorf("the refusal %q was not recognized", output)}
+	}
+	return nil
+}
+
+// newServer starts a server imitating the fixture's platform, which knows the
+// driver's commands and the conformance commands. Entering configuration
+// mode brings up the configuration prompt, if the fixture has one, until the
+// driver leaves it.
+func newServer(driver drivers.Driver, fixture Fixture) *devicetest.Server {
+	s := devicetest.NewUnstartedServer(map[string]string{
+		changeCommand: "",
+		bogusCommand:  fixture.Rejected + "\n",
+	})
+	s.Prompt = fixture.Prompt
+	enter, exit := driver.ConfigMode()
+	for _, cmds := range [][]string{driver.Setup(), enter, exit, driver.Commit(), driver.Save()} {
+		for _, cmd := range cmds {
+			s.Commands[strings.TrimSpace(cmd)] = ""
+		}
+	}
+	if len(enter) > 0 {
+		config := fixture.ConfigPrompt
+		if config == "" {
+			config = fixture.Prompt
+		}
+		s.Modes = map[string]string{strings.TrimSpace(enter[len(enter)-1]): config}
+		for _, cmd := range exit {
+			s.Leave = append(s.Leave, strings.TrimSpace(cmd))
+		}
+	}
+	var mu sync.Mutex
+	paging := fixture.Pager != ""
+	body := strings.Replace(fixture.Output, "\n", "\r\n", -1)
+	s.Handlers = map[string]func(io.Writer){
+		showCommand: func(w io.Writer) {
+			mu.Lock()
+			defer mu.Unlock()
+			if paging {
+				first := strings.SplitAfterN(body, "\r\n", 2)[0]
+				io.WriteString(w, first+fixture.Pager+"\r\n")
+				return
+			}
+			io.WriteString(w, body)
+		},
+	}
+	if fixture.PagerOff != "" {
+		s.Handlers[fixture.PagerOff] = func(io.Writer) {
+			mu.Lock()
+			defer mu.Unlock()
+			paging = false
+		}
+	}
+	s.Start()
+	return s
+}
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package driverstest_test contains tests and examples for package
+// driverstest.
+package driverstest_test
+
+import (
+	"fmt"
+	"github.com/mwalto7/device/drivers"
+	"github.com/mwalto7/device/drivers/driverstest"
+	"log"
+)
+
+func ExampleCheck() {
+	driver, err := drivers.Lookup("ios")
+	if err != nil {
+		log.Fatal(err)
+	}
+	errs := driverstest.Check(driver, driverstest.Fixture{
+		Prompt:       "sw1#",
+		ConfigPrompt: "sw1(config)#",
+		Pager:        " --More-- ",
+		PagerOff:     "terminal length 0",
+		Rejected:     "% Invalid input detected at '^' marker.",
+	})
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	fmt.Println(len(errs), "problems")
+	// Output: 0 problems
+}
@@ -0,0 +1,98 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"regexp"
+)
+
+func init() {
+	Register("exos", func() Driver { return exos })
+	RegisterAlias("extreme-exos", "exos")
+	RegisterAlias("extremexos", "exos")
+}
+
+// exosBasic is the "basic" diagnostics profile of exos.
+var exosBasic = []string{
+	"show version",
+	"show switch",
+	"show configuration",
+	"show log",
+	"show ports information",
+	"show fans",
+	"show temperature",
+	"show power",
+}
+
+// exos drives Extreme Networks EXOS. It has no configuration mode: every
+// configuration command takes effect at once and is kept across reboots only
+// once saved, which the prompt shows by starting with "* " until then. The
+// prompt also counts the commands run, which is masked.
+//
+// Setup turns off the confirmation prompts of commands such as "save
+// configuration", which otherwise wait for an answer.
+var exos = &driver{
+	name:   "exos",
+	prompt: regexp.MustCompile(`^(?:\* )?(?:\([\w\- ]+\) )?(?:Slot-\d+ )?[\w.\-]+\.\d+ [>#] ?$`),
+	setup:  []string{"disable clipaging", "disable cli prompting"},
+	save:   []string{"save configuration"},
+	reload: []string{"reboot"}, // setup disables the confirmation prompt
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{`configure snmp sysName "%[1]s"`},
+			show:     "show configuration snmp",
+			present:  []string{`configure snmp sysName "%[1]s"`},
+		},
+		"InterfaceDescription": {commands: []string{`configure ports %[1]s description-string "%[2]s"`}},
+		"InterfaceVLAN":        {commands: []string{"configure vlan %[2]d add ports %[1]s untagged"}},
+		"InterfaceShutdown":    {commands: []string{"disable ports %[1]s"}},
+		"InterfaceNoShutdown":  {commands: []string{"enable ports %[1]s"}},
+		"CreateVLAN":           {commands: []string{"create vlan %[2]s tag %[1]d"}},
+		"DeleteVLAN":           {commands: []string{"delete vlan %[2]s"}},
+	},
+	vlans: &vlanList{
+		show:    "show vlan",
+		pattern: regexp.MustCompile(`(?m)^(?P<name>[\w.\-]+)[ \t]+(?P<id>\d{1,4})[ \t]`),
+	},
+	users: &userSyntax{
+		show:    "show accounts",
+		pattern: regexp.MustCompile(`(?m)^([\w.\-]+)\s+R/[WO]\b`),
+		roles:   map[string]string{"admin": "admin", "read-only": "user"},
+		create:  []string{"create account %[3]s %[1]s %[2]s"},
+		remove:  []string{"delete account %[1]s"},
+	},
+	diagnostics: map[string][]string{
+		"basic": exosBasic,
+		"full":  append(append([]string(nil), exosBasic...), "show tech"),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(?:\* )?((?:Slot-\d+ )?[\w.\-]+)\.\d+ ([>#] )`), "${1}.<n> ${2}"},
+		{regexp.MustCompile(`(?m)^(System UpTime: ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b(encrypted (?:"[^"]*" )?)"[^"]*"`), `${1}"<secret>"`},
+		{regexp.MustCompile(`\b\d+ (pkts|bytes)/sec\b`), "<rate> $1/sec"},
+	},
+	running:  &runningConfig{"show configuration", config.Indented},
+	rejected: regexp.MustCompile(`(?m)^(?:Error: |%% (?:Invalid|Incomplete|Ambiguous|Unrecognized))`),
+	caps: Capabilities{
+		FileTransfer: "scp",
+	},
+}
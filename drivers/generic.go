@@ -0,0 +1,61 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import "regexp"
+
+func init() {
+	Register("generic", func() Driver { return generic })
+	RegisterAlias("unknown", "generic")
+}
+
+// generic drives devices of platforms no other driver knows, on a best-effort
+// basis. Its prompt is a guess: a line of name-like characters, possibly
+// followed by a mode in parentheses, ending in "#", ">", or "$"; a line of
+// just one of those or "%"; or a name wrapped in angle brackets or square
+// brackets, as on Huawei and Comware. A "%" after a name is not taken as a
+// prompt, so that progress lines such as "100%" are not mistaken for one.
+// Setup tries the paging commands of common platforms; those the device does
+// not know fail with an error message that is ignored, like all of setup's
+// output. Configuration commands are run as given, and no output is taken as
+// a sign of failure.
+var generic = &driver{
+	name:   "generic",
+	prompt: regexp.MustCompile(`^(?:<[\w.\-@:~()]+>|\[[\w.\-@:~/() ]+\][#$%]?|[\w.\-@:~/*]+(?:\([\w.\-@:~/ ]*\))? ?[#>$]| ?[#>$%]) ?$`),
+	setup: []string{
+		"terminal length 0",
+		"terminal pager 0",
+		"set cli screen-length 0",
+		"screen-length 0 temporary",
+		"disable clipaging",
+		"no page",
+	},
+}
+
+// LookupOrGeneric returns the driver registered as name, or the generic
+// driver, registered as "generic", if there is none.
+func LookupOrGeneric(name string) Driver {
+	driver, err := Lookup(name)
+	if err != nil {
+		return generic
+	}
+	return driver
+}
@@ -0,0 +1,123 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"regexp"
+)
+
+func init() {
+	Register("iosxr", func() Driver { return iosxr })
+	RegisterAlias("ios-xr", "iosxr")
+	RegisterAlias("cisco-iosxr", "iosxr")
+	RegisterAlias("cisco-ios-xr", "iosxr")
+}
+
+// iosxrBasic is the "basic" diagnostics profile of iosxr.
+var iosxrBasic = []string{
+	"show version",
+	"show running-config",
+	"show logging",
+	"show interfaces",
+	"show processes cpu",
+	"show environment all",
+}
+
+// iosxr drives Cisco IOS XR. Changes are made to a target configuration that
+// takes effect only once committed; a failed commit leaves it pending, so
+// the reasons are shown and the target configuration is then discarded with
+// "abort", which after a successful commit merely leaves configuration mode.
+var iosxr = &driver{
+	name:   "iosxr",
+	prompt: regexp.MustCompile(`^(?:RP/\d+/\w+/CPU\d+:)?[\w.\-@:]+(?:\([\w.\-@/: ]+\))?[>#] ?$`),
+	setup:  []string{"terminal length 0", "terminal width 512"},
+	enter:  []string{"configure terminal"},
+	commit: []string{"commit", "show configuration failed"},
+	exit:   []string{"abort"},
+	reload: []string{"reload", ""},
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"hostname %[1]s"},
+			show:     "show running-config hostname",
+			present:  []string{"hostname %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"interface %[1]s", "description %[2]s"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"description %[2]s"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"interface %[1]s", "shutdown"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"shutdown"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"interface %[1]s", "no shutdown"},
+			show:     "show running-config interface %[1]s",
+			absent:   []string{"shutdown"},
+		},
+	},
+	users: &userSyntax{
+		show:    "show running-config username",
+		pattern: regexp.MustCompile(`(?m)^username (\S+)`),
+		roles:   map[string]string{"admin": "root-lr", "read-only": "operator"},
+		create:  []string{"username %[1]s", "group %[3]s", "secret %[2]s", "exit"},
+		remove:  []string{"no username %[1]s"},
+	},
+	services: map[string]serviceSyntax{
+		"ntp":    {show: "show running-config ntp", prefix: "server ", add: "ntp server %s"},
+		"dns":    {show: "show running-config domain", prefix: "domain name-server ", add: "domain name-server %s"},
+		"syslog": {show: "show running-config logging | include ^logging [0-9]", prefix: "logging ", add: "logging %s"},
+	},
+	diagnostics: map[string][]string{
+		"basic": iosxrBasic,
+		"full":  append(append([]string(nil), iosxrBasic...), "show tech-support"),
+	},
+	stage: &stageSyntax{
+		begin:    []string{"configure terminal"},
+		end:      []string{"commit confirmed minutes %[1]d", "show configuration failed", "abort"},
+		finalize: []string{"configure terminal", "commit", "abort"},
+		abort:    []string{"rollback configuration last 1"},
+		failed:   regexp.MustCompile(`(?m)^(?:% (?:Failed|Invalid|Incomplete|Ambiguous)|!!% )`),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(!! Last configuration change at ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)\b(uptime is ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b((?:secret|password) (?:5|7|8|9|10) )\S+`), "${1}<secret>"},
+		{regexp.MustCompile(`\b\d+ (bits|packets)/sec\b`), "<rate> $1/sec"},
+		{regexp.MustCompile(`\b\d+ (packets input|packets output|bytes|total input drops|total output drops|input errors|output errors|CRC)\b`), "<count> $1"},
+	},
+	commitLabel: []string{"commit label %[1]s", "show configuration failed"},
+	xml:         "%s | xml",
+	xmlWrappers: []string{"Response", "Get", "Operational", "Configuration"},
+	modes: map[string]modeSyntax{
+		"admin": {enter: []string{"admin"}, exit: []string{"exit"}},
+	},
+	running:  &runningConfig{"show running-config", config.Indented},
+	rejected: regexp.MustCompile(`(?m)^(?:% (?:Failed|Invalid|Incomplete|Ambiguous)|!!% )`),
+	caps: Capabilities{
+		Commit:       true,
+		Rollback:     true,
+		XML:          true,
+		FileTransfer: "scp",
+	},
+}
@@ -0,0 +1,136 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"regexp"
+)
+
+func init() {
+	Register("nxos", func() Driver { return nxos })
+	RegisterAlias("nx-os", "nxos")
+	RegisterAlias("cisco-nxos", "nxos")
+	RegisterAlias("cisco-nx-os", "nxos")
+}
+
+// nxosBasic is the "basic" diagnostics profile of nxos.
+var nxosBasic = []string{
+	"show version",
+	"show running-config",
+	"show logging logfile",
+	"show interface",
+	"show processes cpu sort",
+	"show environment",
+}
+
+// nxos drives Cisco NX-OS. Its command line resembles IOS, but it can print
+// show output as JSON and roll back to named checkpoints.
+var nxos = &driver{
+	name:   "nxos",
+	prompt: regexp.MustCompile(`^[\w.\-@/:]+(?:\([\w.\-@/: ]+\))?[>#] ?$`),
+	setup:  []string{"terminal length 0", "terminal width 511"},
+	enter:  []string{"configure terminal"},
+	exit:   []string{"end"},
+	save:   []string{"copy running-config startup-config"},
+	reload: []string{"reload", "y"},
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"hostname %[1]s"},
+			show:     "show running-config | include ^hostname",
+			present:  []string{"hostname %[1]s"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"interface %[1]s", "description %[2]s"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"description %[2]s"},
+		},
+		"InterfaceVLAN": {
+			commands: []string{"interface %[1]s", "switchport", "switchport mode access", "switchport access vlan %[2]d"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"switchport access vlan %[2]d"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"interface %[1]s", "shutdown"},
+			show:     "show running-config interface %[1]s",
+			present:  []string{"shutdown"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"interface %[1]s", "no shutdown"},
+			show:     "show running-config interface %[1]s",
+			absent:   []string{"shutdown"},
+		},
+		"CreateVLAN": {commands: []string{"vlan %[1]d", "name %[2]s"}},
+		"DeleteVLAN": {commands: []string{"no vlan %[1]d"}},
+	},
+	vlans: &vlanList{
+		show:    "show vlan brief",
+		pattern: regexp.MustCompile(`(?m)^(?P<id>\d+)\s+(?P<name>\S+)\s+(?:active|suspended|act/\S+|sus/\S+)`),
+	},
+	users: &userSyntax{
+		show:    "show running-config | include ^username",
+		pattern: regexp.MustCompile(`(?m)^username (\S+)`),
+		roles:   map[string]string{"admin": "network-admin", "read-only": "network-operator"},
+		create:  []string{"username %[1]s password %[2]s role %[3]s"},
+		remove:  []string{"no username %[1]s"},
+		endKey:  []string{"username %[1]s sshkey %[3]s"},
+		keyTypes: map[string]string{
+			"ssh-rsa":             "ssh-rsa",
+			"ssh-ed25519":         "ssh-ed25519",
+			"ecdsa-sha2-nistp256": "ecdsa-sha2-nistp256",
+			"ecdsa-sha2-nistp384": "ecdsa-sha2-nistp384",
+			"ecdsa-sha2-nistp521": "ecdsa-sha2-nistp521",
+		},
+	},
+	services: map[string]serviceSyntax{
+		"ntp":    {show: "show running-config | include ^ntp server", prefix: "ntp server ", add: "ntp server %s"},
+		"dns":    {show: "show running-config | include ^ip name-server", prefix: "ip name-server ", multi: true, add: "ip name-server %s"},
+		"syslog": {show: "show running-config | include ^logging server", prefix: "logging server ", add: "logging server %s"},
+	},
+	banner: &bannerSyntax{
+		names:     map[string]string{"motd": "motd"},
+		show:      "show banner %s",
+		set:       "banner %s %s",
+		remove:    "no banner %s",
+		delimited: true,
+	},
+	diagnostics: map[string][]string{
+		"basic": nxosBasic,
+		"full":  append(append([]string(nil), nxosBasic...), "show tech-support details"),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(!(?:Time|Running configuration last done at|Startup config saved at): ).*$`), "${1}<timestamp>"},
+		{regexp.MustCompile(`(?m)\b(uptime is ).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b((?:password|key) [5789] )\S+`), "${1}<secret>"},
+		{regexp.MustCompile(`\b\d+ (bits|packets)/sec\b`), "<rate> $1/sec"},
+		{regexp.MustCompile(`\b\d+ (unicast packets|multicast packets|broadcast packets|input packets|output packets|bytes|input error|output error|CRC|runts|giants)\b`), "<count> $1"},
+	},
+	json:       "%s | json",
+	checkpoint: "checkpoint %s",
+	rollback:   "rollback running-config checkpoint %s",
+	running:    &runningConfig{"show running-config", config.Indented},
+	rejected:   regexp.MustCompile(`(?m)^(?:% (?:Invalid|Incomplete|Ambiguous)|ERROR: |Syntax error)`),
+	caps: Capabilities{
+		Rollback:     true,
+		JSON:         true,
+		FileTransfer: "scp",
+	},
+}
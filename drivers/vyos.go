@@ -0,0 +1,130 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import (
+	"github.com/mwalto7/device/config"
+	"regexp"
+)
+
+func init() {
+	Register("vyos", func() Driver { return vyos })
+	Register("edgeos", func() Driver { return edgeos })
+	RegisterAlias("ubiquiti-edgeos", "edgeos")
+	RegisterAlias("edgerouter", "edgeos")
+}
+
+// vyosBasic is the "basic" diagnostics profile of vyos and edgeos.
+var vyosBasic = []string{
+	"show version",
+	"show configuration commands",
+	"show log",
+	"show interfaces",
+	"show system memory",
+	"show system storage",
+}
+
+// vyos drives VyOS. Its prompt ends in "$" in operational mode and "#" in
+// configuration mode. A failed commit leaves the changes pending, and
+// configuration mode refuses a plain "exit" while changes are pending, so it
+// is left with "exit discard", which after a successful commit merely
+// leaves. "save" is a configuration mode command.
+var vyos = &driver{
+	name:   "vyos",
+	prompt: regexp.MustCompile(`^[\w.\-]+@[\w.\-]+(?::[^$#]*)?[$#] ?$`),
+	setup:  []string{"set terminal length 0", "set terminal width 0"},
+	enter:  []string{"configure"},
+	commit: []string{"commit"},
+	exit:   []string{"exit discard"},
+	save:   []string{"configure", "save", "exit"},
+	reload: []string{"reboot", "y"},
+	changes: map[string]changeFormat{
+		"Hostname": {
+			commands: []string{"set system host-name '%[1]s'"},
+			show:     "show configuration commands | grep host-name",
+			present:  []string{"set system host-name '%[1]s'"},
+		},
+		"InterfaceDescription": {
+			commands: []string{"set interfaces ethernet %[1]s description '%[2]s'"},
+			show:     "show configuration commands | grep 'interfaces ethernet %[1]s '",
+			present:  []string{"set interfaces ethernet %[1]s description '%[2]s'"},
+		},
+		"InterfaceShutdown": {
+			commands: []string{"set interfaces ethernet %[1]s disable"},
+			show:     "show configuration commands | grep 'interfaces ethernet %[1]s '",
+			present:  []string{"set interfaces ethernet %[1]s disable"},
+		},
+		"InterfaceNoShutdown": {
+			commands: []string{"delete interfaces ethernet %[1]s disable"},
+			show:     "show configuration commands | grep 'interfaces ethernet %[1]s '",
+			absent:   []string{"set interfaces ethernet %[1]s disable"},
+		},
+	},
+	users: &userSyntax{
+		show:    "show configuration commands | grep 'system login user'",
+		pattern: regexp.MustCompile(`(?m)^set system login user '?([^'\s]+)`),
+		create:  []string{"set system login user %[1]s authentication plaintext-password %[2]s"},
+		remove:  []string{"delete system login user %[1]s"},
+	},
+	services: map[string]serviceSyntax{
+		"ntp": {show: "show configuration commands | grep 'system ntp server'", prefix: "set system ntp server ", add: "set system ntp server %s"},
+		"dns": {show: "show configuration commands | grep 'system name-server'", prefix: "set system name-server ", add: "set system name-server %s"},
+	},
+	diagnostics: map[string][]string{
+		"basic": vyosBasic,
+		"full":  append(append([]string(nil), vyosBasic...), "generate tech-support archive"),
+	},
+	masks: []Mask{
+		{regexp.MustCompile(`(?m)^(Uptime: +).*$`), "${1}<uptime>"},
+		{regexp.MustCompile(`\b(encrypted-password )'?[^'\s]+'?`), "${1}'<secret>'"},
+	},
+	running:  &runningConfig{"show configuration commands", config.Set},
+	rejected: regexp.MustCompile(`(?m)^(?:Invalid command:|Set failed|Delete failed|Commit failed|\s*Configuration path: .* is not valid)`),
+	config:   regexp.MustCompile(`#$`),
+	caps: Capabilities{
+		Commit:       true,
+		Rollback:     true,
+		FileTransfer: "scp",
+	},
+}
+
+// edgeos drives Ubiquiti EdgeOS, a descendant of Vyatta like VyOS, whose
+// operational mode sets the terminal without "set".
+var edgeos = func() *driver {
+	d := *vyos
+	d.name = "edgeos"
+	d.setup = []string{"terminal length 0", "terminal width 0"}
+	d.users = &userSyntax{
+		show:    vyos.users.show,
+		pattern: vyos.users.pattern,
+		roles:   map[string]string{"admin": "admin", "read-only": "operator"},
+		create: []string{
+			"set system login user %[1]s authentication plaintext-password %[2]s",
+			"set system login user %[1]s level %[3]s",
+		},
+		remove: vyos.users.remove,
+	}
+	d.diagnostics = map[string][]string{
+		"basic": vyosBasic,
+		"full":  append(append([]string(nil), vyosBasic...), "show tech-support"),
+	}
+	return &d
+}()
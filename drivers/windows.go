@@ -0,0 +1,62 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package drivers
+
+import "regexp"
+
+func init() {
+	Register("windows", func() Driver { return windows })
+	RegisterAlias("windows-cmd", "windows")
+	Register("powershell", func() Driver { return powershell })
+	RegisterAlias("windows-powershell", "powershell")
+	RegisterAlias("pwsh", "powershell")
+}
+
+// windows drives the cmd.exe shell that Windows OpenSSH starts by default.
+var windows = &driver{
+	name:       "windows",
+	prompt:     regexp.MustCompile(`^[A-Za-z]:\\[^>]*> ?$`),
+	lineEnding: "\r\n",
+	reload:     []string{"shutdown /r /t 0"},
+	exitStatus: &statusSyntax{
+		show:    "echo exit=%ERRORLEVEL%",
+		pattern: regexp.MustCompile(`(?m)^exit=(-?\d+)\s*$`),
+	},
+	caps: Capabilities{FileTransfer: "sftp"},
+}
+
+// powershell drives PowerShell, started by Windows OpenSSH when it is the
+// configured default shell.
+var powershell = &driver{
+	name:   "powershell",
+	prompt: regexp.MustCompile(`^PS [^>]*> ?$`),
+	// Progress bars redraw the screen and would clutter the output.
+	setup:      []string{"$ProgressPreference = 'SilentlyContinue'"},
+	lineEnding: "\r\n",
+	reload:     []string{"Restart-Computer -Force"},
+	// $LASTEXITCODE is only set by native programs, so the success of
+	// cmdlets is reported from $? instead.
+	exitStatus: &statusSyntax{
+		show:    `if ($?) { "exit=0" } elseif ($LASTEXITCODE) { "exit=$LASTEXITCODE" } else { "exit=1" }`,
+		pattern: regexp.MustCompile(`(?m)^exit=(-?\d+)\s*$`),
+	},
+	caps: Capabilities{FileTransfer: "sftp"},
+}